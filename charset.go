@@ -0,0 +1,83 @@
+package negotiator
+
+import (
+	"strings"
+
+	"github.com/rickb777/negotiator/header"
+	"github.com/rickb777/negotiator/processor"
+)
+
+// acceptsCharset tests whether the processor's charset is acceptable according to the
+// Accept-Charset values, following RFC 7231 section 5.3.3.
+//
+// * If there is no Accept-Charset header, any charset (usually utf-8) is acceptable.
+//
+// * A listed charset is acceptable unless its quality is zero, e.g. "iso-8859-1;q=0".
+//
+// * "*" matches any charset that is not listed, so "*;q=0" means only the listed charsets
+// are acceptable. Without "*", charsets that are not listed are not acceptable.
+//
+// Processors whose content type has no charset parameter are always acceptable.
+func acceptsCharset(charsets header.PrecedenceValues, p processor.ResponseProcessor) bool {
+	if len(charsets) == 0 {
+		return true
+	}
+
+	charset := charsetOf(p.ContentType())
+	if charset == "" {
+		return true
+	}
+
+	wildcard := false
+	for _, accepted := range charsets {
+		if accepted.Value == "*" {
+			wildcard = accepted.Quality > 0
+		} else if strings.EqualFold(accepted.Value, charset) {
+			return accepted.Quality > 0
+		}
+	}
+
+	return wildcard
+}
+
+// honoursCharset tests whether the processor can produce the charset that is a parameter of
+// the accepted media range, e.g. "application/json; charset=utf-8". This only applies with
+// strict Accept parsing; otherwise, the charset parameter is ignored when matching. As for
+// acceptsCharset, processors whose content type has no charset parameter are always acceptable.
+func (n *Negotiator) honoursCharset(accepted header.MediaRange, p processor.ResponseProcessor) bool {
+	if !n.strictAccept {
+		return true
+	}
+
+	requested := paramValue(accepted.Params, "charset")
+	if requested == "" {
+		return true
+	}
+
+	charset := charsetOf(p.ContentType())
+	return charset == "" || strings.EqualFold(requested, charset)
+}
+
+// paramValue gets the value of a parameter, or blank if there is none.
+func paramValue(params []header.KV, key string) string {
+	for _, kv := range params {
+		if strings.EqualFold(strings.TrimSpace(kv.Key), key) {
+			return strings.Trim(strings.TrimSpace(kv.Value), `"`)
+		}
+	}
+	return ""
+}
+
+// charsetOf gets the charset parameter of a content type, or blank if there is none.
+func charsetOf(contentType string) string {
+	_, params := split(contentType, ';')
+	for params != "" {
+		var param string
+		param, params = split(params, ';')
+		k, v := split(param, '=')
+		if strings.EqualFold(strings.TrimSpace(k), "charset") {
+			return strings.Trim(strings.TrimSpace(v), `"`)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,86 @@
+package negotiator
+
+import (
+	"net/http"
+	"strings"
+)
+
+// IfMatch is the request header for optimistic concurrency control (RFC 7232).
+const IfMatch = "If-Match"
+
+// WithConditionalRequests enables checking the If-Match request header against the ETag of
+// the chosen offer (see Offer.ETag). If they do not match, the response is 412-Precondition
+// Failed via the error handler, instead of the offer being rendered. This is mainly useful
+// for PUT and PATCH requests, to detect concurrent changes. Requests without an If-Match
+// header, and offers without an ETag, are not affected.
+func (n *Negotiator) WithConditionalRequests() *Negotiator {
+	c := n.Clone()
+	c.conditional = true
+	return c
+}
+
+// checkPreconditions checks the If-Match header, if there is one, against the ETag of the
+// chosen offer.
+func (n *Negotiator) checkPreconditions(rv requestValues, r *renderer) CodedRender {
+	if rv.req == nil || r.offer.ETag == "" {
+		return r
+	}
+
+	ifMatch := headerValue(rv.req, IfMatch)
+	if ifMatch == "" || matchesETag(ifMatch, entityTag(r.offer.ETag)) {
+		return r
+	}
+
+	info2("412 precondition failed", "If-Match", ifMatch, "ETag", r.offer.ETag)
+	eh, contentType := n.errorHandlerFor(rv, Offers{r.offer})
+	return preconditionFailed{errorHandler: eh, contentType: contentType, reason: rv.reason(PreconditionFailed, "")}
+}
+
+// matchesETag tests whether an If-Match header value lists an entity tag, using the strong
+// comparison of RFC 7232 section 2.3.2, so weak entity tags never match.
+func matchesETag(ifMatch, etag string) bool {
+	if strings.HasPrefix(etag, "W/") {
+		return false
+	}
+
+	for _, v := range strings.Split(ifMatch, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || v == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// entityTag quotes an ETag unless it is already quoted.
+func entityTag(etag string) string {
+	if strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return `"` + etag + `"`
+}
+
+//-------------------------------------------------------------------------------------------------
+
+type preconditionFailed struct {
+	errorHandler ErrorHandler
+	contentType  string
+	reason       Reason
+}
+
+func (r preconditionFailed) Empty() bool {
+	return false
+}
+
+func (r preconditionFailed) StatusCode() int {
+	return http.StatusPreconditionFailed
+}
+
+func (r preconditionFailed) WriteContentType(w http.ResponseWriter) {
+	writeErrorContentType(w, r.contentType)
+}
+
+func (r preconditionFailed) Render(w http.ResponseWriter) error {
+	r.errorHandler(w, "the entity tag does not match", http.StatusPreconditionFailed)
+	return nil
+}
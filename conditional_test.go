@@ -0,0 +1,65 @@
+package negotiator_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/onsi/gomega"
+	"github.com/rickb777/negotiator"
+	"github.com/rickb777/negotiator/processor"
+)
+
+func Test_should_check_if_match_against_offer_etag(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.JSON()).WithConditionalRequests()
+
+	offer := negotiator.Of("foo").As("application/json").WithETag("v2")
+
+	cases := []struct {
+		ifMatch string
+		code    int
+	}{
+		{"", http.StatusOK},
+		{`"v2"`, http.StatusOK},
+		{`"v1", "v2"`, http.StatusOK},
+		{`*`, http.StatusOK},
+		{`"v1"`, http.StatusPreconditionFailed},
+		{`W/"v2"`, http.StatusPreconditionFailed},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("PUT", "/", nil)
+		req.Header.Set(negotiator.Accept, "application/json")
+		if c.ifMatch != "" {
+			req.Header.Set(negotiator.IfMatch, c.ifMatch)
+		}
+		recorder := httptest.NewRecorder()
+
+		err := n.Negotiate(recorder, req, offer)
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Code).To(gomega.Equal(c.code), c.ifMatch)
+		if c.code == http.StatusOK {
+			g.Expect(recorder.Header().Get("ETag")).To(gomega.Equal(`"v2"`))
+			g.Expect(recorder.Body.String()).To(gomega.Equal("\"foo\"\n"))
+		}
+	}
+}
+
+func Test_should_ignore_if_match_unless_conditional_requests_are_enabled(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.JSON())
+
+	req, _ := http.NewRequest("PUT", "/", nil)
+	req.Header.Set(negotiator.Accept, "application/json")
+	req.Header.Set(negotiator.IfMatch, `"v1"`)
+	recorder := httptest.NewRecorder()
+
+	err := n.Negotiate(recorder, req, negotiator.Of("foo").As("application/json").WithETag("v2"))
+
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK))
+}
@@ -0,0 +1,96 @@
+package negotiator
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rickb777/negotiator/processor"
+)
+
+// CanConsume tests whether the request body has a media type that can be handled by one of
+// the processors, based on its Content-Type header. This uses the same media type matching
+// as for responses, so a Negotiator with processor.JSON() can consume "application/json".
+// A request without a Content-Type cannot be consumed.
+func (n *Negotiator) CanConsume(req *http.Request) bool {
+	mediaType, _ := split(req.Header.Get(ContentType), ';')
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	if mediaType == "" {
+		return false
+	}
+
+	for _, p := range n.processors {
+		if p.CanProcess(mediaType, "*") {
+			return true
+		}
+	}
+	return false
+}
+
+// ConsumableTypes lists the media types of the processors, without any parameters such as
+// charset. Duplicates are omitted.
+func (n *Negotiator) ConsumableTypes() []string {
+	var types []string
+	for _, p := range n.processors {
+		mediaType, _ := split(p.ContentType(), ';')
+		types = appendUnique(types, strings.TrimSpace(mediaType))
+	}
+	return types
+}
+
+// RequireConsumable checks that the request body can be consumed using CanConsume. If it
+// cannot, a 415-Unsupported Media Type response is sent via the error handler, with an
+// Accept header listing the consumable types, and the result is false.
+func (n *Negotiator) RequireConsumable(w http.ResponseWriter, req *http.Request) bool {
+	if n.CanConsume(req) {
+		return true
+	}
+
+	info2("415 unsupported media type", "Content-Type", req.Header.Get(ContentType))
+	w.Header().Set(Accept, strings.Join(n.ConsumableTypes(), ", "))
+	eh, contentType := n.errorHandlerFor(requestValues{req: req, accept: n.accept(req)}, nil)
+	writeErrorContentType(w, contentType)
+	eh(w, "the request content type is not supported by the server", http.StatusUnsupportedMediaType)
+	return false
+}
+
+// DecodeRequest unmarshals the request body into a value, which should be a pointer. The
+// first processor that can process the request's Content-Type and is a processor.Decoder
+// is used, e.g. processor.JSON() for "application/json". This is the counterpart of
+// negotiating the response.
+//
+// If no processor can decode the request's Content-Type, the result is an
+// *UnsupportedMediaTypeError, which could be reported using RequireConsumable.
+func (n *Negotiator) DecodeRequest(req *http.Request, into interface{}) error {
+	mediaType, _ := split(req.Header.Get(ContentType), ';')
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+
+	if mediaType != "" {
+		for _, p := range n.processors {
+			if d, ok := p.(processor.Decoder); ok && p.CanProcess(mediaType, "*") {
+				return d.Decode(req.Body, into)
+			}
+		}
+	}
+
+	info2("415 unsupported media type", "Content-Type", req.Header.Get(ContentType))
+	return &UnsupportedMediaTypeError{ContentType: req.Header.Get(ContentType)}
+}
+
+// UnsupportedMediaTypeError is the error from DecodeRequest when the request body has a
+// media type that cannot be decoded.
+type UnsupportedMediaTypeError struct {
+	ContentType string
+}
+
+func (e *UnsupportedMediaTypeError) Error() string {
+	if e.ContentType == "" {
+		return "the request has no content type"
+	}
+	return fmt.Sprintf("the request content type is not supported by the server: %s", e.ContentType)
+}
+
+// StatusCode is 415-Unsupported Media Type.
+func (e *UnsupportedMediaTypeError) StatusCode() int {
+	return http.StatusUnsupportedMediaType
+}
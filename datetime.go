@@ -0,0 +1,51 @@
+package negotiator
+
+import "time"
+
+// WithDatetimeNegotiation enables selection between offers by their Datetime, according to
+// the Accept-Datetime request header (RFC 7089 Memento). The offers with the latest Datetime
+// that is not after the requested datetime are kept and the others are disregarded, before
+// the usual negotiation by media type and language. If the requested datetime is before all
+// of them, the earliest are kept instead. Offers without a Datetime are only used if no
+// offer has one.
+//
+// Requests without an Accept-Datetime header are negotiated as usual. If the header is
+// malformed, the response is 400-Bad Request.
+func (n *Negotiator) WithDatetimeNegotiation() *Negotiator {
+	c := n.Clone()
+	c.datetimes = true
+	return c
+}
+
+// selectByDatetime keeps the offers whose Datetime is the closest to, but not after, the
+// requested time.
+func selectByDatetime(offers Offers, requested time.Time) Offers {
+	var chosen, earliest time.Time
+	for _, offer := range offers {
+		dt := offer.Datetime
+		if dt.IsZero() {
+			continue
+		}
+		if !dt.After(requested) && (chosen.IsZero() || dt.After(chosen)) {
+			chosen = dt
+		}
+		if earliest.IsZero() || dt.Before(earliest) {
+			earliest = dt
+		}
+	}
+
+	if chosen.IsZero() {
+		if earliest.IsZero() {
+			return offers // nothing is dated
+		}
+		chosen = earliest
+	}
+
+	selected := make(Offers, 0, len(offers))
+	for _, offer := range offers {
+		if offer.Datetime.Equal(chosen) {
+			selected = append(selected, offer)
+		}
+	}
+	return selected
+}
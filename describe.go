@@ -0,0 +1,145 @@
+package negotiator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rickb777/negotiator/encoding"
+	"github.com/rickb777/negotiator/processor"
+)
+
+// Describe returns a human-readable summary of the configuration, e.g. for logging at
+// startup or when investigating why requests are not acceptable. It lists the processors
+// in the order they are tried, with their content types and the optional interfaces that
+// they implement, followed by the settings that differ from the defaults.
+func (n *Negotiator) Describe() string {
+	buf := &strings.Builder{}
+	fmt.Fprintf(buf, "%d processors\n", len(n.processors))
+	for i, p := range n.processors {
+		fmt.Fprintf(buf, "  %d: %s (%T)", i, p.ContentType(), p)
+		if caps := capabilities(p); len(caps) > 0 {
+			fmt.Fprintf(buf, " [%s]", strings.Join(caps, ", "))
+		}
+		buf.WriteByte('\n')
+	}
+
+	if len(n.defaultTypes) > 0 {
+		fmt.Fprintf(buf, "default subtypes: %s\n", strings.Join(n.defaultTypes, ", "))
+	}
+	if len(n.preferredLangs) > 0 {
+		fmt.Fprintf(buf, "preferred languages: %s\n", strings.Join(n.preferredLangs, ", "))
+	}
+	if len(n.codings) > 0 {
+		fmt.Fprintf(buf, "encodings: %s\n", codingNames(n.codings))
+	}
+	if len(n.decoders) > 0 {
+		fmt.Fprintf(buf, "decodings: %s\n", codingNames(n.decoders))
+	}
+	if n.maxBodySize > 0 {
+		fmt.Fprintf(buf, "max body size: %d\n", n.maxBodySize)
+	}
+	if n.defaultAccept != "" {
+		fmt.Fprintf(buf, "default accept: %s\n", n.defaultAccept)
+	}
+	for _, h := range []struct{ configured, standard string }{
+		{n.acceptHeader, Accept},
+		{n.languageHeader, AcceptLanguage},
+		{n.charsetHeader, AcceptCharset},
+		{n.encodingHeader, AcceptEncoding},
+	} {
+		if h.configured != "" {
+			fmt.Fprintf(buf, "%s header: %s\n", h.standard, h.configured)
+		}
+	}
+	if n.requestIDHeader != "" {
+		fmt.Fprintf(buf, "request ID header: %s\n", n.requestIDHeader)
+	}
+	if n.formatParam != "" {
+		fmt.Fprintf(buf, "format parameter: %s\n", n.formatParam)
+	}
+	if options := n.options(); len(options) > 0 {
+		fmt.Fprintf(buf, "options: %s\n", strings.Join(options, ", "))
+	}
+	return buf.String()
+}
+
+func (n *Negotiator) options() []string {
+	var options []string
+	flags := []struct {
+		set  bool
+		name string
+	}{
+		{n.buffered, "buffered output"},
+		{n.datetimes, "datetime negotiation"},
+		{n.emptyCollections, "empty collections give no content"},
+		{n.strictAccept, "strict accept parsing"},
+		{n.strictLanguage, "strict language exclusion"},
+		{n.echoLanguage, "echo requested language"},
+		{n.conditional, "conditional requests"},
+		{n.ranges, "range requests"},
+		{n.hideOffered, "without available types"},
+		{n.tieBreak == ClientOrder, "client order tie-break"},
+		{n.multipleChoices, "multiple choices"},
+		{n.dedupOffers, "dedup offers"},
+		{n.errorFunc != nil, "error handler func"},
+		{n.errorTemplate != nil, "error template"},
+		{n.tracer != nil, "tracing"},
+		{n.metrics != nil, "metrics"},
+	}
+	for _, f := range flags {
+		if f.set {
+			options = append(options, f.name)
+		}
+	}
+	return options
+}
+
+// capabilities lists the optional interfaces that a processor implements.
+func capabilities(p processor.ResponseProcessor) []string {
+	var caps []string
+	add := func(ok bool, name string) {
+		if ok {
+			caps = append(caps, name)
+		}
+	}
+
+	_, ok := p.(processor.Renderer)
+	add(ok, "Renderer")
+	_, ok = p.(processor.Decoder)
+	add(ok, "Decoder")
+	_, ok = p.(processor.MediaRangeAware)
+	add(ok, "MediaRangeAware")
+	_, ok = p.(processor.LanguageAware)
+	add(ok, "LanguageAware")
+	_, ok = p.(processor.TemplateAware)
+	add(ok, "TemplateAware")
+	_, ok = p.(processor.RequestAware)
+	add(ok, "RequestAware")
+	_, ok = p.(processor.Validator)
+	add(ok, "Validator")
+	_, ok = p.(processor.ContentTypeSettable)
+	add(ok, "ContentTypeSettable")
+	_, ok = p.(processor.TrailingNewlineSettable)
+	add(ok, "TrailingNewlineSettable")
+	_, ok = p.(processor.EchoSettable)
+	add(ok, "EchoSettable")
+	_, ok = p.(processor.TableSettable)
+	add(ok, "TableSettable")
+	_, ok = p.(processor.BOMSettable)
+	add(ok, "BOMSettable")
+	if d, ok := p.(processor.Downloadable); ok && d.IsDownload() {
+		caps = append(caps, "Downloadable")
+	}
+	if v, ok := p.(processor.Verbatim); ok && v.IsVerbatim() {
+		caps = append(caps, "Verbatim")
+	}
+	return caps
+}
+
+func codingNames(codings []encoding.Coding) string {
+	names := make([]string, len(codings))
+	for i, c := range codings {
+		names[i] = c.Name
+	}
+	return strings.Join(names, ", ")
+}
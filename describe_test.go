@@ -0,0 +1,33 @@
+package negotiator_test
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	"github.com/rickb777/negotiator"
+	"github.com/rickb777/negotiator/encoding"
+	"github.com/rickb777/negotiator/processor"
+)
+
+func Test_describe_should_list_processors_and_settings(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.TXT(), processor.CSV()).
+		WithEncoding(encoding.Gzip, encoding.Deflate).
+		WithBufferedOutput().
+		WithStrictAcceptParsing()
+
+	g.Expect(n.Describe()).To(gomega.Equal(`2 processors
+  0: text/plain; charset=utf-8 (*processor.txtProcessor) [Renderer, Validator, ContentTypeSettable]
+  1: text/csv; charset=utf-8 (*processor.csvProcessor) [Renderer, MediaRangeAware, ContentTypeSettable, TableSettable, BOMSettable, Downloadable]
+encodings: gzip, deflate
+options: buffered output, strict accept parsing
+`))
+}
+
+func Test_describe_should_list_no_processors(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+
+	g.Expect(negotiator.New().Describe()).To(gomega.Equal("0 processors\n"))
+}
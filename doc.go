@@ -48,4 +48,16 @@
 // sending a 406 (Not Acceptable) response.  However, the latter is not
 // encouraged, as doing so can prevent users from accessing content that
 // they might be able to use (with translation software, for example).
+//
+// Accept-Charset - from https://tools.ietf.org/html/rfc7231#section-5.3.3:
+//
+// The "Accept-Charset" header field can be sent by a user agent to
+// indicate what charsets are acceptable in textual response content.
+// The special value "*", if present in the Accept-Charset field, matches
+// every charset that is not mentioned elsewhere in the Accept-Charset field.
+//
+// A request without any Accept-Charset header field implies that the user
+// agent will accept any charset in response. This negotiator honours the
+// header field by sending a 406 (Not Acceptable) response if the charset of
+// every matching response processor is not acceptable.
 package negotiator
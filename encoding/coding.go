@@ -0,0 +1,144 @@
+// package encoding provides the content codings, such as gzip, that can be negotiated
+// using the Accept-Encoding request header (RFC 7231 section 5.3.4).
+//
+// Other codings can be added by declaring a Coding. For example, Brotli can be supported
+// using github.com/andybalholm/brotli:
+//
+//	var Brotli = encoding.Coding{
+//		Name: "br",
+//		NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+//			return brotli.NewWriter(w), nil
+//		},
+//	}
+//
+// This package does not include it so that the dependency is only needed when it is used.
+package encoding
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"strings"
+
+	"github.com/rickb777/negotiator/header"
+)
+
+// Coding is a content coding that compresses the response body.
+type Coding struct {
+	// Name is the content coding token, e.g. "gzip", used in the Content-Encoding header.
+	Name string
+	// NewWriter wraps the response writer with a compressor. This is nil for Identity.
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+	// NewReader wraps a reader with a decompressor. This is optional; it is needed only
+	// for decoding pre-encoded data for clients that do not accept the coding.
+	NewReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+// Identity is the coding that does not alter the response body.
+var Identity = Coding{Name: "identity"}
+
+// Gzip is the gzip coding using the default compression level.
+var Gzip = Coding{
+	Name: "gzip",
+	NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriter(w), nil
+	},
+	NewReader: func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	},
+}
+
+// GzipLevel is the gzip coding using a particular compression level, from gzip.BestSpeed to
+// gzip.BestCompression, e.g.
+//
+//	n.WithEncoding(encoding.GzipLevel(gzip.BestSpeed))
+//
+// Faster levels use less CPU but give larger responses; see BenchmarkGzipLevels.
+// An invalid level causes an error when a response is rendered.
+func GzipLevel(level int) Coding {
+	return Coding{
+		Name: "gzip",
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriterLevel(w, level)
+		},
+		NewReader: Gzip.NewReader,
+	}
+}
+
+// Deflate is the deflate coding using the default compression level.
+var Deflate = Coding{
+	Name: "deflate",
+	NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(w, flate.DefaultCompression)
+	},
+	NewReader: func(r io.Reader) (io.ReadCloser, error) {
+		return flate.NewReader(r), nil
+	},
+}
+
+// DeflateLevel is the deflate coding using a particular compression level, from
+// flate.BestSpeed to flate.BestCompression. An invalid level causes an error when
+// a response is rendered.
+func DeflateLevel(level int) Coding {
+	return Coding{
+		Name: "deflate",
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(w, level)
+		},
+		NewReader: Deflate.NewReader,
+	}
+}
+
+// IsIdentity tests whether the coding leaves the response body unaltered.
+func (c Coding) IsIdentity() bool {
+	return c.NewWriter == nil
+}
+
+// Select chooses the coding that the client prefers, based on the parsed Accept-Encoding
+// header. Codings with equal quality are chosen in the order given, which is the server's
+// preference. "*" matches any coding that is not listed and "x-gzip" is treated as "gzip".
+//
+// If there is no Accept-Encoding header or none of the codings is acceptable, Identity is
+// returned because the uncompressed response is the usual fallback.
+func Select(accepted header.PrecedenceValues, codings []Coding) Coding {
+	best := Identity
+	bestQ := 0.0
+	for _, c := range codings {
+		q := qualityOf(accepted, c.Name)
+		if q > bestQ {
+			best, bestQ = c, q
+		}
+	}
+	return best
+}
+
+// Accepts tests whether the client accepts a coding, based on the parsed Accept-Encoding
+// header. As for Select, a client without an Accept-Encoding header accepts only Identity.
+func Accepts(accepted header.PrecedenceValues, name string) bool {
+	return strings.EqualFold(name, Identity.Name) || qualityOf(accepted, name) > 0
+}
+
+// qualityOf gets the quality given to a coding, which is zero if it is not acceptable.
+func qualityOf(accepted header.PrecedenceValues, name string) float64 {
+	wildcard := 0.0
+	for _, a := range accepted {
+		if strings.EqualFold(a.Value, name) || strings.EqualFold(alias(a.Value), name) {
+			return a.Quality
+		} else if a.Value == "*" {
+			wildcard = a.Quality
+		}
+	}
+	return wildcard
+}
+
+// alias gets the coding for "x-gzip" and "x-compress", which RFC 7230 section 4.2 says are
+// equivalent to "gzip" and "compress". Other names are unchanged.
+func alias(value string) string {
+	switch strings.ToLower(value) {
+	case "x-gzip":
+		return "gzip"
+	case "x-compress":
+		return "compress"
+	}
+	return value
+}
@@ -0,0 +1,193 @@
+package encoding_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/rickb777/negotiator/encoding"
+	"github.com/rickb777/negotiator/header"
+)
+
+// fakeBrotli stands in for a Brotli coding, which would need an extra dependency.
+var fakeBrotli = encoding.Coding{
+	Name: "br",
+	NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+		return nopCloser{w}, nil
+	},
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+func TestSelectShouldChooseClientPreference(t *testing.T) {
+	g := NewGomegaWithT(t)
+	cases := []struct {
+		acceptEncoding string
+		codings        []encoding.Coding
+		expected       string
+	}{
+		{"", []encoding.Coding{encoding.Gzip}, "identity"},
+		{"gzip", nil, "identity"},
+		{"gzip", []encoding.Coding{encoding.Gzip}, "gzip"},
+		{"x-gzip", []encoding.Coding{encoding.Gzip}, "gzip"},
+		{"GZIP", []encoding.Coding{encoding.Gzip}, "gzip"},
+		{"Gzip ; q = 0.5 , DEFLATE", []encoding.Coding{encoding.Gzip, encoding.Deflate}, "deflate"},
+		{" x-GZIP ,  deflate;q=0.1", []encoding.Coding{encoding.Deflate, encoding.Gzip}, "gzip"},
+		{"gzip", []encoding.Coding{{Name: "GZIP", NewWriter: encoding.Gzip.NewWriter}}, "GZIP"},
+		{"gzip;q=0", []encoding.Coding{encoding.Gzip}, "identity"},
+		{"compress", []encoding.Coding{encoding.Gzip}, "identity"},
+		{"*", []encoding.Coding{encoding.Gzip}, "gzip"},
+		{"*;q=0.5, gzip;q=0", []encoding.Coding{encoding.Gzip, encoding.Deflate}, "deflate"},
+		{"gzip, deflate, br", []encoding.Coding{fakeBrotli, encoding.Gzip}, "br"},
+		{"gzip, deflate, br", []encoding.Coding{encoding.Gzip, fakeBrotli}, "gzip"},
+		{"gzip;q=0.8, br", []encoding.Coding{encoding.Gzip, fakeBrotli}, "br"},
+		{"gzip, br;q=0.8", []encoding.Coding{fakeBrotli, encoding.Gzip}, "gzip"},
+		{"gzip, deflate", []encoding.Coding{fakeBrotli, encoding.Gzip}, "gzip"},
+		{"gzip, deflate", []encoding.Coding{encoding.Gzip, encoding.Deflate}, "gzip"},
+		{"deflate, gzip", []encoding.Coding{encoding.Gzip, encoding.Deflate}, "gzip"},
+		{"x-foo", []encoding.Coding{{Name: "x-foo", NewWriter: encoding.Gzip.NewWriter}}, "x-foo"},
+		{"x-foo", []encoding.Coding{{Name: "foo", NewWriter: encoding.Gzip.NewWriter}}, "identity"},
+		{"x-deflate", []encoding.Coding{encoding.Deflate}, "identity"},
+	}
+
+	for _, c := range cases {
+		actual := encoding.Select(header.Parse(c.acceptEncoding), c.codings)
+		g.Expect(actual.Name).To(Equal(c.expected), c.acceptEncoding)
+	}
+}
+
+func TestGzipShouldCompress(t *testing.T) {
+	g := NewGomegaWithT(t)
+	buf := &bytes.Buffer{}
+
+	w, err := encoding.Gzip.NewWriter(buf)
+	g.Expect(err).NotTo(HaveOccurred())
+	w.Write([]byte("hello"))
+	g.Expect(w.Close()).NotTo(HaveOccurred())
+
+	r, err := gzip.NewReader(buf)
+	g.Expect(err).NotTo(HaveOccurred())
+	b, err := ioutil.ReadAll(r)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(b)).To(Equal("hello"))
+	g.Expect(encoding.Gzip.IsIdentity()).To(BeFalse())
+	g.Expect(encoding.Identity.IsIdentity()).To(BeTrue())
+}
+
+func TestAcceptsShouldFollowClientPreference(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(encoding.Accepts(header.Parse("gzip, br"), "gzip")).To(BeTrue())
+	g.Expect(encoding.Accepts(header.Parse("x-gzip"), "gzip")).To(BeTrue())
+	g.Expect(encoding.Accepts(header.Parse("x-compress"), "compress")).To(BeTrue())
+	g.Expect(encoding.Accepts(header.Parse("x-foo"), "x-foo")).To(BeTrue())
+	g.Expect(encoding.Accepts(header.Parse("x-foo"), "foo")).To(BeFalse())
+	g.Expect(encoding.Accepts(header.Parse("*"), "gzip")).To(BeTrue())
+	g.Expect(encoding.Accepts(header.Parse("gzip;q=0, *"), "gzip")).To(BeFalse())
+	g.Expect(encoding.Accepts(header.Parse(""), "gzip")).To(BeFalse())
+	g.Expect(encoding.Accepts(header.Parse(""), "identity")).To(BeTrue())
+}
+
+func TestGzipShouldDecompress(t *testing.T) {
+	g := NewGomegaWithT(t)
+	buf := &bytes.Buffer{}
+
+	w, err := encoding.Gzip.NewWriter(buf)
+	g.Expect(err).NotTo(HaveOccurred())
+	w.Write([]byte("hello"))
+	g.Expect(w.Close()).NotTo(HaveOccurred())
+
+	r, err := encoding.Gzip.NewReader(buf)
+	g.Expect(err).NotTo(HaveOccurred())
+	b, err := ioutil.ReadAll(r)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(b)).To(Equal("hello"))
+}
+
+func TestGzipLevelShouldCompressAtThatLevel(t *testing.T) {
+	g := NewGomegaWithT(t)
+	payload := jsonPayload()
+
+	fast := compressedSize(t, encoding.GzipLevel(gzip.BestSpeed), payload)
+	best := compressedSize(t, encoding.GzipLevel(gzip.BestCompression), payload)
+
+	g.Expect(fast).To(BeNumerically("<", len(payload)))
+	g.Expect(best).To(BeNumerically("<", fast))
+
+	_, err := encoding.GzipLevel(42).NewWriter(&bytes.Buffer{})
+	g.Expect(err).To(HaveOccurred())
+}
+
+// BenchmarkGzipLevels compares the speed of the gzip levels for a typical JSON payload.
+// The compressed size is reported as a percentage of the original size.
+func BenchmarkGzipLevels(b *testing.B) {
+	payload := jsonPayload()
+	levels := []struct {
+		name  string
+		level int
+	}{
+		{"BestSpeed", gzip.BestSpeed},
+		{"Default", gzip.DefaultCompression},
+		{"BestCompression", gzip.BestCompression},
+	}
+
+	for _, l := range levels {
+		coding := encoding.GzipLevel(l.level)
+		b.Run(l.name, func(b *testing.B) {
+			b.SetBytes(int64(len(payload)))
+			size := 0
+			for i := 0; i < b.N; i++ {
+				size = compressedSize(b, coding, payload)
+			}
+			b.ReportMetric(float64(100*size)/float64(len(payload)), "%size")
+		})
+	}
+}
+
+func compressedSize(tb testing.TB, coding encoding.Coding, payload []byte) int {
+	buf := &bytes.Buffer{}
+	w, err := coding.NewWriter(buf)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	w.Write(payload)
+	if err := w.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Len()
+}
+
+func jsonPayload() []byte {
+	type user struct {
+		ID      int      `json:"id"`
+		Name    string   `json:"name"`
+		Email   string   `json:"email"`
+		Active  bool     `json:"active"`
+		Balance float64  `json:"balance"`
+		Tags    []string `json:"tags"`
+	}
+
+	users := make([]user, 1000)
+	for i := range users {
+		users[i] = user{
+			ID:      i,
+			Name:    fmt.Sprintf("User %d", i),
+			Email:   fmt.Sprintf("user%d@example.com", i),
+			Active:  i%3 != 0,
+			Balance: float64(i*37%1000) / 7,
+			Tags:    []string{"customer", fmt.Sprintf("region-%d", i%5)},
+		}
+	}
+
+	b, _ := json.Marshal(users)
+	return b
+}
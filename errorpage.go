@@ -0,0 +1,56 @@
+package negotiator
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+
+	"github.com/rickb777/negotiator/header"
+)
+
+const htmlContentType = "text/html; charset=utf-8"
+
+// ErrorPage is the data passed to the error template set by WithErrorTemplate.
+type ErrorPage struct {
+	StatusCode int    // e.g. 406
+	Status     string // e.g. "Not Acceptable"
+	Message    string
+	RequestID  string // blank unless WithRequestIDHeader is used
+}
+
+// WithErrorTemplate sets an HTML template for error responses. When the client prefers
+// text/html, e.g. a browser, the body of 400-Bad Request and 406-Not Acceptable responses
+// is rendered from the template, which is given an ErrorPage. Other clients still get the
+// plain text from the error handler. The Negotiator does not itself send 500 responses,
+// so these are not affected.
+//
+// An ErrorHandlerFunc, if set, takes precedence over the template.
+func (n *Negotiator) WithErrorTemplate(tpl *template.Template) *Negotiator {
+	c := n.Clone()
+	c.errorTemplate = tpl
+	return c
+}
+
+// prefersHTML tests whether the most preferred media range in the Accept header is text/html.
+func prefersHTML(accept string) bool {
+	mrs := header.ParseMediaRanges(accept)
+	return len(mrs) > 0 && mrs[0].Type == "text" && mrs[0].Subtype == "html" && mrs[0].Quality > 0
+}
+
+// templateErrorHandler gets an error handler that renders the error template.
+// If the template fails, the fallback error handler is used instead.
+func templateErrorHandler(tpl *template.Template, fallback ErrorHandler, requestID string) ErrorHandler {
+	return func(w http.ResponseWriter, error string, code int) {
+		buf := &bytes.Buffer{}
+		err := tpl.Execute(buf, ErrorPage{StatusCode: code, Status: http.StatusText(code), Message: error, RequestID: requestID})
+		if err != nil {
+			info2("error template failed", "Error", err)
+			fallback(w, error, code)
+			return
+		}
+
+		writeErrorContentType(w, htmlContentType)
+		w.WriteHeader(code)
+		w.Write(buf.Bytes())
+	}
+}
@@ -0,0 +1,56 @@
+package negotiator
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Handler creates an http.Handler for the common case of an endpoint that offers a single
+// data model. The model function is called for each request; its result is negotiated using
+// n as a single offer. If the model function returns an error, the error handler is used
+// instead to send a 500-Internal Server Error response.
+//
+// Any error when rendering the response happens after the headers have been sent, so it is
+// passed to the Printer.
+func Handler(n *Negotiator, model func(req *http.Request) (interface{}, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, err := model(req)
+		if err != nil {
+			eh, contentType := n.errorHandlerFor(requestValues{req: req, accept: n.accept(req)}, nil)
+			writeErrorContentType(w, contentType)
+			eh(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = n.Negotiate(w, req, Offer{Data: data})
+		if err != nil {
+			Printer('E', "render failed", map[string]interface{}{"Error": err})
+		}
+	})
+}
+
+// OptionsHandler creates an http.Handler for OPTIONS requests. As RFC 7231 section 4.3.7
+// expects, the response has an Allow header listing the methods of the resource, which are
+// GET, HEAD and OPTIONS unless others are given; OPTIONS is always included. The content
+// types that n can produce, as listed by ContentTypes, are also advertised in the
+// X-Available-Types header. The response is 204-No Content.
+func (n *Negotiator) OptionsHandler(methods ...string) http.Handler {
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodHead}
+	}
+
+	var allowed []string
+	for _, m := range methods {
+		allowed = appendUnique(allowed, strings.ToUpper(strings.TrimSpace(m)))
+	}
+	allow := strings.Join(appendUnique(allowed, http.MethodOptions), ", ")
+
+	available := strings.Join(n.ContentTypes(), ", ")
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set(Allow, allow)
+		if available != "" {
+			w.Header().Set(XAvailableTypes, available)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
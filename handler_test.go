@@ -0,0 +1,85 @@
+package negotiator_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/onsi/gomega"
+	"github.com/rickb777/negotiator"
+	"github.com/rickb777/negotiator/processor"
+)
+
+func Test_handler_should_negotiate_the_model(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.JSON())
+
+	h := negotiator.Handler(n, func(req *http.Request) (interface{}, error) {
+		return "hello", nil
+	})
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set(negotiator.Accept, "application/json")
+	recorder := httptest.NewRecorder()
+
+	h.ServeHTTP(recorder, req)
+
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK))
+	g.Expect(recorder.Header().Get("Content-Type")).To(gomega.Equal("application/json; charset=utf-8"))
+	g.Expect(recorder.Body.String()).To(gomega.Equal("\"hello\"\n"))
+}
+
+func Test_handler_should_use_error_handler_for_model_errors(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+
+	var code int
+	n := negotiator.New(processor.JSON()).WithErrorHandler(func(w http.ResponseWriter, error string, c int) {
+		code = c
+		http.Error(w, error, c)
+	})
+
+	h := negotiator.Handler(n, func(req *http.Request) (interface{}, error) {
+		return nil, errors.New("database is down")
+	})
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	recorder := httptest.NewRecorder()
+
+	h.ServeHTTP(recorder, req)
+
+	g.Expect(code).To(gomega.Equal(http.StatusInternalServerError))
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusInternalServerError))
+	g.Expect(recorder.Body.String()).To(gomega.Equal("database is down\n"))
+}
+
+func Test_options_handler_should_list_unique_content_types(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.JSON(), processor.SmartJSON(), processor.XML(), processor.CSV())
+
+	g.Expect(n.ContentTypes()).To(gomega.Equal([]string{
+		"application/json; charset=utf-8",
+		"application/xml; charset=utf-8",
+		"text/csv; charset=utf-8",
+	}))
+
+	req, _ := http.NewRequest("OPTIONS", "/", nil)
+	recorder := httptest.NewRecorder()
+
+	n.OptionsHandler().ServeHTTP(recorder, req)
+
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusNoContent))
+	g.Expect(recorder.Header().Get(negotiator.Allow)).To(gomega.Equal("GET, HEAD, OPTIONS"))
+	g.Expect(recorder.Header().Get(negotiator.XAvailableTypes)).To(gomega.Equal(
+		"application/json; charset=utf-8, application/xml; charset=utf-8, text/csv; charset=utf-8"))
+	g.Expect(recorder.Body.Len()).To(gomega.Equal(0))
+
+	recorder = httptest.NewRecorder()
+	n.OptionsHandler("get", "PUT", "options", "GET").ServeHTTP(recorder, req)
+
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusNoContent))
+	g.Expect(recorder.Header().Get(negotiator.Allow)).To(gomega.Equal("GET, PUT, OPTIONS"))
+}
@@ -0,0 +1,28 @@
+//go:build go1.18
+// +build go1.18
+
+package header
+
+import (
+	"strings"
+	"testing"
+)
+
+func FuzzParseMediaRanges(f *testing.F) {
+	f.Add(`text/html, application/json; q=0.9, */*; q=0.1`)
+	f.Add(`type/sub; p="a;b,c"; q=0.5`)
+	f.Add(`type/sub; p="unterminated, text/plain`)
+	f.Add(`type/sub; p="\"escaped\\"`)
+
+	f.Fuzz(func(t *testing.T, acceptHeader string) {
+		mrs := ParseMediaRanges(acceptHeader)
+		if len(mrs) > strings.Count(acceptHeader, ",")+1 {
+			t.Errorf("%q gave %d media ranges", acceptHeader, len(mrs))
+		}
+
+		pvs := Parse(acceptHeader)
+		if len(pvs) > strings.Count(acceptHeader, ",")+1 {
+			t.Errorf("%q gave %d values", acceptHeader, len(pvs))
+		}
+	})
+}
@@ -17,7 +17,7 @@ const qualityParam = "q"
 
 // Parse splits a prioritised "Accept-Language", "Accept-Encoding" or "Accept-Charset"
 // header value and sorts the parts. These are returned in order with the most
-// preferred first.
+// preferred first. Values with equal quality keep the order in which they were sent.
 func Parse(acceptXyzHeader string) PrecedenceValues {
 	wvs := splitHeaderParts(strings.ToLower(acceptXyzHeader))
 	sort.Stable(wvByPrecedence(wvs))
@@ -29,11 +29,14 @@ func splitHeaderParts(acceptHeader string) PrecedenceValues {
 		return nil
 	}
 
-	parts := strings.Split(acceptHeader, ",")
+	parts := splitQuoted(acceptHeader, ',')
 	wvs := make(PrecedenceValues, 0, len(parts))
 
 	for _, part := range parts {
-		valueAndParams := strings.Split(part, ";")
+		valueAndParams := splitQuoted(part, ';')
+		if strings.TrimSpace(valueAndParams[0]) == "" {
+			continue // empty list elements are allowed (RFC 7230 section 7)
+		}
 		if len(valueAndParams) == 1 {
 			wvs = append(wvs, PrecedenceValue{Value: strings.TrimSpace(valueAndParams[0]), Quality: DefaultQuality})
 		} else {
@@ -59,8 +62,63 @@ func handlePartWithParams(value string, acceptParams []string) PrecedenceValue {
 	return *wv
 }
 
+// splitQuoted splits a header value at each separator, except for separators inside
+// quoted strings, which may contain backslash-escaped characters (RFC 7230 §3.2.6).
+func splitQuoted(value string, sep byte) []string {
+	if strings.IndexByte(value, '"') < 0 {
+		return strings.Split(value, string(sep))
+	}
+
+	var parts []string
+	quoted, escaped := false, false
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case escaped:
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case !quoted && c == sep:
+			parts = append(parts, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, value[start:])
+}
+
+// unquote removes the quotes and escapes from a quoted string. Other values are
+// returned unchanged.
+func unquote(value string) string {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return value
+	}
+
+	buf := &strings.Builder{}
+	escaped := false
+	for i := 1; i < len(value)-1; i++ {
+		c := value[i]
+		if c == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		buf.WriteByte(c)
+	}
+	return buf.String()
+}
+
+// quote adds quotes and escapes to a parameter value if it is not a token.
+func quote(value string) string {
+	if !strings.ContainsAny(value, "\"\\(),/:;<=>?@[]{} \t") {
+		return value
+	}
+	return strconv.Quote(value)
+}
+
 func parseQuality(qstring string) float64 {
-	q64, err := strconv.ParseFloat(qstring, 64)
+	q64, err := strconv.ParseFloat(strings.TrimSpace(qstring), 64)
 	if err != nil {
 		q64 = 1.0
 	}
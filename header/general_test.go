@@ -102,6 +102,20 @@ func TestParseAcceptXyzHeader_special_cases(t *testing.T) {
 			actual:   "en-gb, en-us, en;q=0.7",
 			expected: []PrecedenceValue{{Value: "en-gb", Quality: DefaultQuality}, {Value: "en-us", Quality: DefaultQuality}, {Value: "en", Quality: 0.7}},
 		},
+
+		// mixed case and stray whitespace
+		{
+			actual:   "GZIP , Deflate ;q = 0.5,\tbr ; Q=0.8 ",
+			expected: []PrecedenceValue{{Value: "gzip", Quality: DefaultQuality}, {Value: "br", Quality: 0.8}, {Value: "deflate", Quality: 0.5}},
+		},
+		{
+			actual:   " UTF-8 ; q=0.9 , Iso-8859-1",
+			expected: []PrecedenceValue{{Value: "iso-8859-1", Quality: DefaultQuality}, {Value: "utf-8", Quality: 0.9}},
+		},
+
+		// empty elements
+		{actual: "gzip,,br", expected: []PrecedenceValue{{Value: "gzip", Quality: DefaultQuality}, {Value: "br", Quality: DefaultQuality}}},
+		{actual: " , ", expected: []PrecedenceValue{}},
 	}
 
 	for _, c := range cases {
@@ -109,3 +123,40 @@ func TestParseAcceptXyzHeader_special_cases(t *testing.T) {
 		g.Expect(actual).To(Equal(c.expected))
 	}
 }
+
+func TestParseAcceptXyzHeader_keeps_first_of_equal_quality_first(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(Parse("gzip, deflate").String()).To(Equal("gzip, deflate"))
+	g.Expect(Parse("deflate, gzip").String()).To(Equal("deflate, gzip"))
+	g.Expect(Parse("gzip;q=0.5, deflate;q=0.5, br").String()).To(Equal("br, gzip;q=0.5, deflate;q=0.5"))
+}
+
+func TestParseAcceptXyzHeader_preserves_order_of_equal_quality(t *testing.T) {
+	g := NewGomegaWithT(t)
+	// enough values that an unstable sort would not use insertion sort throughout
+	encodings := []string{"gzip", "br", "deflate", "compress", "zstd", "x-gzip", "x-compress",
+		"exi", "pack200-gzip", "aes128gcm", "identity", "lz4", "snappy", "xz", "bzip2", "lzma"}
+
+	header := ""
+	var expected PrecedenceValues
+	for i, e := range encodings {
+		if i%4 == 3 {
+			header += e + ";q=0.5, "
+		} else {
+			header += e + ";q=0.8, "
+			expected = append(expected, PrecedenceValue{Value: e, Quality: 0.8})
+		}
+	}
+	for i, e := range encodings {
+		if i%4 == 3 {
+			expected = append(expected, PrecedenceValue{Value: e, Quality: 0.5})
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		actual := Parse(header + "*;q=0.1")
+		g.Expect(actual[:len(expected)]).To(Equal(expected))
+		g.Expect(actual[len(expected)].Value).To(Equal("*"))
+	}
+}
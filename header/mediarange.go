@@ -59,7 +59,7 @@ func (mr MediaRange) Value() string {
 	buf := &strings.Builder{}
 	fmt.Fprintf(buf, "%s/%s", mr.Type, mr.Subtype)
 	for _, p := range mr.Params {
-		fmt.Fprintf(buf, ";%s=%s", p.Key, p.Value)
+		fmt.Fprintf(buf, ";%s=%s", p.Key, quote(p.Value))
 	}
 	return buf.String()
 }
@@ -68,20 +68,26 @@ func (mr MediaRange) String() string {
 	buf := &strings.Builder{}
 	fmt.Fprintf(buf, "%s/%s", mr.Type, mr.Subtype)
 	for _, p := range mr.Params {
-		fmt.Fprintf(buf, ";%s=%s", p.Key, p.Value)
+		fmt.Fprintf(buf, ";%s=%s", p.Key, quote(p.Value))
 	}
 	if mr.Quality < DefaultQuality {
 		fmt.Fprintf(buf, ";q=%g", mr.Quality)
 	}
 	for _, p := range mr.Extensions {
-		fmt.Fprintf(buf, ";%s=%s", p.Key, p.Value)
+		fmt.Fprintf(buf, ";%s=%s", p.Key, quote(p.Value))
 	}
 	return buf.String()
 }
 
+// defaultMediaRanges is shared by all callers of WithDefault, so it must not be modified.
+var defaultMediaRanges = MediaRanges{{Type: "*", Subtype: "*", Quality: DefaultQuality}}
+
+// WithDefault gets the media ranges, or "*/*" if there are none, as when the request has no
+// Accept header. The default is shared to avoid allocation, so the result must be treated as
+// read-only.
 func (mrs MediaRanges) WithDefault() MediaRanges {
 	if len(mrs) == 0 {
-		return []MediaRange{{Type: "*", Subtype: "*", Quality: DefaultQuality}}
+		return defaultMediaRanges
 	}
 	return mrs
 }
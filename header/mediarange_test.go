@@ -62,6 +62,39 @@ func TestParseAcceptHeader_sorts_by_decending_quality(t *testing.T) {
 	g.Expect(mr[2].Quality).To(BeNumerically("~", 0.1, 1e-4))
 }
 
+func TestParseMediaRanges_preserves_order_of_equal_precedence(t *testing.T) {
+	g := NewGomegaWithT(t)
+	// enough values that an unstable sort would not use insertion sort throughout
+	subtypes := []string{"json", "xml", "yaml", "cbor", "csv", "msgpack", "protobuf", "atom+xml",
+		"rss+xml", "pdf", "zip", "gzip", "octet-stream", "javascript", "ld+json", "problem+json"}
+
+	header := "*/*;q=0.1"
+	var expected []string
+	for i, st := range subtypes {
+		if i%4 == 3 {
+			header += ", application/" + st + ";q=0.5"
+		} else {
+			header += ", application/" + st + ";q=0.8"
+			expected = append(expected, st)
+		}
+	}
+	for i, st := range subtypes {
+		if i%4 == 3 {
+			expected = append(expected, st)
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		mrs := ParseMediaRanges(header)
+		var actual []string
+		for _, mr := range mrs[:len(expected)] {
+			actual = append(actual, mr.Subtype)
+		}
+		g.Expect(actual).To(Equal(expected))
+		g.Expect(mrs[len(expected)].Value()).To(Equal("*/*"))
+	}
+}
+
 func TestMediaRanges_should_ignore_invalid_quality(t *testing.T) {
 	g := NewGomegaWithT(t)
 	mr := ParseMediaRanges("text/html;q=blah")
@@ -105,6 +138,56 @@ func TestMediaRanges_should_handle_precedence(t *testing.T) {
 	}), c)
 }
 
+func TestParseMediaRanges_explicit_default_quality_should_equal_implicit(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	for _, q := range []string{"1", "1.0", "1.000"} {
+		c := "text/plain;q=" + q + ", text/html"
+		mr := ParseMediaRanges(c)
+
+		g.Expect(len(mr)).To(Equal(2))
+		g.Expect(mr[0].Quality).To(Equal(DefaultQuality), c)
+		g.Expect(mr[1].Quality).To(Equal(DefaultQuality), c)
+		// equal precedence, so the order of the header is kept
+		g.Expect(mr[0].Subtype).To(Equal("plain"), c)
+	}
+}
+
+func TestParseMediaRanges_should_agree_with_strict_parsing(t *testing.T) {
+	g := NewGomegaWithT(t)
+	// from https://tools.ietf.org/html/rfc7231#section-5.3.2
+	cases := []string{
+		"audio/*; q=0.2, audio/basic",
+		"text/plain; q=0.5, text/html, text/x-dvi; q=0.8, text/x-c",
+		"text/*, text/plain, text/plain;format=flowed, */*",
+		"text/*;q=0.3, text/html;q=0.7, text/html;level=1, text/html;level=2;q=0.4, */*;q=0.5",
+		"text/html;q=1.000, text/plain;q=1, application/json",
+	}
+
+	for _, c := range cases {
+		strict, err := ParseMediaRangesStrictly(c)
+
+		g.Expect(err).NotTo(HaveOccurred(), c)
+		g.Expect(strict).To(Equal(ParseMediaRanges(c)), c)
+	}
+}
+
+func TestParseMediaRanges_should_skip_empty_elements(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	mr := ParseMediaRanges("application/json,,text/html")
+	g.Expect(mr.String()).To(Equal("application/json, text/html"))
+
+	mr = ParseMediaRanges(" , application/json;q=0.5 ,")
+	g.Expect(mr.String()).To(Equal("application/json;q=0.5"))
+
+	for _, c := range []string{",", " , ,", ";q=0.5"} {
+		mr = ParseMediaRanges(c)
+		g.Expect(mr).To(BeEmpty(), c)
+		g.Expect(mr.WithDefault().String()).To(Equal("*/*"), c)
+	}
+}
+
 func TestMediaRanges_should_not_remove_accept_extension(t *testing.T) {
 	g := NewGomegaWithT(t)
 	mr := ParseMediaRanges("text/html; q=0.5; a=1;b=2")
@@ -190,3 +273,97 @@ func TestMediaRanges_should_ignore_case_of_quality_and_whitespace(t *testing.T)
 	g.Expect("text/*").To(Equal(mr[3].Value()))
 	g.Expect(0.3).To(Equal(mr[3].Quality))
 }
+
+func TestParseMediaRangesStrictly_accepts_valid_headers(t *testing.T) {
+	g := NewGomegaWithT(t)
+	cases := []string{
+		"",
+		"*/*",
+		"application/json",
+		"text/*;q=0.3, text/html;q=0.7, text/html;level=1, */*;q=0.5",
+		"text/html; Q=1.0; a=1",
+		"application/json,,text/html",
+		",",
+	}
+	for _, c := range cases {
+		mr, err := ParseMediaRangesStrictly(c)
+		g.Expect(err).NotTo(HaveOccurred(), c)
+		g.Expect(mr).To(Equal(ParseMediaRanges(c)), c)
+	}
+}
+
+func TestParseMediaRangesStrictly_rejects_malformed_headers(t *testing.T) {
+	g := NewGomegaWithT(t)
+	cases := []string{
+		"application",
+		"/json",
+		"application/",
+		"*/json",
+		"application/json/x",
+		"application/json, text",
+		"text/html;q=x",
+		"text/html;q=2",
+		"text/html;=1",
+		"application/json, ;q=0.5",
+	}
+	for _, c := range cases {
+		mr, err := ParseMediaRangesStrictly(c)
+		g.Expect(err).To(HaveOccurred(), c)
+		g.Expect(mr).To(BeNil(), c)
+	}
+}
+
+func TestMediaRanges_should_not_split_quoted_parameter_values(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	cases := []struct {
+		header   string
+		expected MediaRanges
+	}{
+		{`application/json; profile="a,b"`, MediaRanges{
+			{Type: "application", Subtype: "json", Quality: 1, Params: []KV{{"profile", "a,b"}}},
+		}},
+		{`type/sub; p="a;b,c"; q=0.5, text/plain`, MediaRanges{
+			{Type: "text", Subtype: "plain", Quality: 1},
+			{Type: "type", Subtype: "sub", Quality: 0.5, Params: []KV{{"p", "a;b,c"}}},
+		}},
+		{`type/sub; p="say \"hi\", \\ bye"`, MediaRanges{
+			{Type: "type", Subtype: "sub", Quality: 1, Params: []KV{{"p", `say "hi", \ bye`}}},
+		}},
+	}
+
+	for _, c := range cases {
+		mrs := ParseMediaRanges(c.header)
+		g.Expect(mrs).To(Equal(c.expected), c.header)
+
+		_, err := ParseMediaRangesStrictly(c.header)
+		g.Expect(err).NotTo(HaveOccurred(), c.header)
+	}
+}
+
+func TestMediaRange_string_should_quote_parameter_values_when_needed(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	mrs := ParseMediaRanges(`type/sub; p="a;b,c"; level=1; q=0.5`)
+
+	g.Expect(mrs.String()).To(Equal(`type/sub;p="a;b,c";level=1;q=0.5`))
+	g.Expect(ParseMediaRanges(mrs.String())).To(Equal(mrs))
+}
+
+func TestMediaRanges_default_should_not_allocate(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		ParseMediaRanges("").WithDefault()
+	})
+
+	g.Expect(allocs).To(Equal(0.0))
+	g.Expect(ParseMediaRanges("").WithDefault().String()).To(Equal("*/*"))
+}
+
+func BenchmarkParseMediaRanges_noAcceptHeader(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ParseMediaRanges("").WithDefault()
+	}
+}
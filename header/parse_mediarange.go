@@ -1,7 +1,9 @@
 package header
 
 import (
+	"fmt"
 	sort "sort"
+	"strconv"
 	"strings"
 )
 
@@ -17,7 +19,8 @@ const (
 
 // ParseMediaRanges splits a prioritised "Accept" header value and sorts the
 // parts based on quality values and precedence rules.
-// These are returned in order with the most preferred first.
+// These are returned in order with the most preferred first. Media ranges of
+// equal precedence keep the order in which they were sent.
 //
 // A request without any Accept header field implies that the user agent
 // will accept any media type in response.  If the header field is
@@ -32,16 +35,66 @@ func ParseMediaRanges(acceptHeader string) MediaRanges {
 	return result
 }
 
+// ParseMediaRangesStrictly is like ParseMediaRanges except that it also checks the syntax
+// of the header. An error is returned if any media range lacks a type or subtype, has a
+// wildcard type with a specific subtype, or has an invalid quality value.
+func ParseMediaRangesStrictly(acceptHeader string) (MediaRanges, error) {
+	err := validateMediaRanges(acceptHeader)
+	if err != nil {
+		return nil, err
+	}
+	return ParseMediaRanges(acceptHeader), nil
+}
+
+func validateMediaRanges(acceptHeader string) error {
+	if acceptHeader == "" {
+		return nil
+	}
+
+	for _, part := range splitQuoted(acceptHeader, ',') {
+		if strings.TrimSpace(part) == "" {
+			continue // empty list elements are allowed (RFC 7230 section 7)
+		}
+		valueAndParams := splitQuoted(part, ';')
+		value := strings.TrimSpace(valueAndParams[0])
+		t, s := split(value, '/')
+		if t == "" || s == "" || strings.ContainsAny(value, " \t") || strings.Count(value, "/") != 1 {
+			return fmt.Errorf("invalid media range %q", value)
+		}
+		if t == "*" && s != "*" {
+			return fmt.Errorf("invalid media range %q", value)
+		}
+
+		for _, ap := range valueAndParams[1:] {
+			k, v := split(strings.TrimSpace(ap), '=')
+			if strings.TrimSpace(k) == "" {
+				return fmt.Errorf("invalid parameter %q in media range %q", ap, value)
+			}
+			if strings.EqualFold(strings.TrimSpace(k), qualityParam) {
+				q, err := strconv.ParseFloat(v, 64)
+				if err != nil || q < 0 || q > DefaultQuality {
+					return fmt.Errorf("invalid quality %q in media range %q", v, value)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
 func parseMediaRangeHeader(acceptHeader string) MediaRanges {
 	if acceptHeader == "" {
 		return nil
 	}
 
-	parts := strings.Split(strings.ToLower(acceptHeader), ",")
+	parts := splitQuoted(strings.ToLower(acceptHeader), ',')
 	wvs := make(MediaRanges, 0, len(parts))
 
 	for _, part := range parts {
-		valueAndParams := strings.Split(part, ";")
+		valueAndParams := splitQuoted(part, ';')
+		if strings.TrimSpace(valueAndParams[0]) == "" {
+			continue // empty list elements are allowed (RFC 7230 section 7)
+		}
 		if len(valueAndParams) == 1 {
 			t, s := split(strings.TrimSpace(valueAndParams[0]), '/')
 			wvs = append(wvs, MediaRange{Type: t, Subtype: s, Quality: DefaultQuality})
@@ -66,9 +119,9 @@ func handleMediaRangeWithParams(value string, acceptParams []string) MediaRange
 			wv.Quality = parseQuality(v)
 			hasQ = true
 		} else if hasQ {
-			wv.Extensions = append(wv.Extensions, KV{Key: k, Value: v})
+			wv.Extensions = append(wv.Extensions, KV{Key: k, Value: unquote(v)})
 		} else {
-			wv.Params = append(wv.Params, KV{Key: k, Value: v})
+			wv.Params = append(wv.Params, KV{Key: k, Value: unquote(v)})
 		}
 	}
 	return *wv
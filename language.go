@@ -0,0 +1,62 @@
+package negotiator
+
+import "strings"
+
+// equalOrPrefix compares language tags subtag by subtag, ignoring case. Either tag may be
+// more specific than the other, so "en" and "en-GB" match. However, "zh-Hans" does not
+// match "zh-Hant-TW" because the script subtags differ. This is RFC 4647 basic filtering,
+// so subtags are never skipped: "zh-CN" does not match "zh-Hans-CN".
+//
+// If the accepted language range contains a wildcard, e.g. "en-*" or "*-CH", RFC 4647
+// extended filtering is used instead; see extendedFilter.
+func equalOrPrefix(acceptedLang, offeredLang string) bool {
+	if acceptedLang == "*" || offeredLang == "*" {
+		return true
+	}
+
+	if strings.IndexByte(acceptedLang, '*') >= 0 {
+		return extendedFilter(acceptedLang, offeredLang)
+	}
+
+	return hasSubtagPrefix(acceptedLang, offeredLang) ||
+		hasSubtagPrefix(offeredLang, acceptedLang)
+}
+
+// hasSubtagPrefix tests whether all the subtags of prefix are at the start of tag.
+func hasSubtagPrefix(tag, prefix string) bool {
+	return len(tag) >= len(prefix) &&
+		strings.EqualFold(tag[:len(prefix)], prefix) &&
+		(len(tag) == len(prefix) || tag[len(prefix)] == '-')
+}
+
+// extendedFilter implements RFC 4647 section 3.3.2 extended filtering. A wildcard subtag
+// in the language range matches any number of subtags in the tag, so "en-*" matches "en"
+// and "en-GB" (but not "eng"), and "*-CH" matches "de-CH" and "fr-Latn-CH".
+func extendedFilter(languageRange, tag string) bool {
+	ranges := strings.Split(languageRange, "-")
+	tags := strings.Split(tag, "-")
+
+	if ranges[0] != "*" && !strings.EqualFold(ranges[0], tags[0]) {
+		return false
+	}
+
+	r, t := 1, 1
+	for r < len(ranges) {
+		switch {
+		case ranges[r] == "*":
+			r++
+		case t >= len(tags):
+			return false
+		case strings.EqualFold(ranges[r], tags[t]):
+			r++
+			t++
+		case len(tags[t]) == 1:
+			// singletons such as "x" in private-use tags cannot be skipped
+			return false
+		default:
+			t++
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,60 @@
+package negotiator_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/onsi/gomega"
+	"github.com/rickb777/negotiator"
+	"github.com/rickb777/negotiator/processor"
+)
+
+func Test_should_match_language_wildcards_using_extended_filtering(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.TXT())
+
+	cases := []struct {
+		acceptLanguage string
+		offer          string
+		matches        bool
+	}{
+		{acceptLanguage: "en-*", offer: "en", matches: true},
+		{acceptLanguage: "en-*", offer: "en-US", matches: true},
+		{acceptLanguage: "en-*", offer: "en-GB", matches: true},
+		{acceptLanguage: "en-*", offer: "eng", matches: false},
+		{acceptLanguage: "en-*", offer: "de", matches: false},
+
+		{acceptLanguage: "zh-*", offer: "zh-Hant-TW", matches: true},
+		{acceptLanguage: "zh-*", offer: "ja", matches: false},
+		{acceptLanguage: "zh-*-TW", offer: "zh-Hant-TW", matches: true},
+		{acceptLanguage: "zh-*-TW", offer: "zh-Hant-HK", matches: false},
+
+		{acceptLanguage: "*-CH", offer: "de-CH", matches: true},
+		{acceptLanguage: "*-CH", offer: "fr-Latn-CH", matches: true},
+		{acceptLanguage: "*-ch", offer: "it-CH", matches: true},
+		{acceptLanguage: "*-CH", offer: "de", matches: false},
+		{acceptLanguage: "*-CH", offer: "de-AT", matches: false},
+		{acceptLanguage: "*-CH", offer: "de-x-CH", matches: false},
+
+		{acceptLanguage: "*", offer: "de", matches: true},
+		{acceptLanguage: "*", offer: "zh-Hant-TW", matches: true},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Add("Accept-Language", c.acceptLanguage)
+		recorder := httptest.NewRecorder()
+
+		err := n.Negotiate(recorder, req, negotiator.Offer{Data: "foo", MediaType: "text/plain", Language: c.offer})
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		if c.matches {
+			g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK), c.acceptLanguage+" "+c.offer)
+			g.Expect(recorder.Header().Get("Content-Language")).To(gomega.Equal(c.offer))
+		} else {
+			g.Expect(recorder.Code).To(gomega.Equal(http.StatusNotAcceptable), c.acceptLanguage+" "+c.offer)
+		}
+	}
+}
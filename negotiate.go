@@ -2,10 +2,14 @@ package negotiator
 
 import (
 	"fmt"
+	"html/template"
 	"log"
 	"net/http"
+	"reflect"
+	"sort"
 	"strings"
 
+	"github.com/rickb777/negotiator/encoding"
 	"github.com/rickb777/negotiator/header"
 	"github.com/rickb777/negotiator/processor"
 )
@@ -18,50 +22,402 @@ import (
 // ErrorHandler is called for NotAcceptable and InternalServerError situations.
 type ErrorHandler func(w http.ResponseWriter, error string, code int)
 
+// ErrorHandlerFunc is an alternative to ErrorHandler that is also given the request and the
+// offers that could not be matched, e.g. for logging the headers that caused the error.
+type ErrorHandlerFunc func(w http.ResponseWriter, req *http.Request, offers []Offer, code int)
+
 // Printer is something that allows printing log entries. This is only used for diagnostics.
 var Printer = func(level byte, message string, data map[string]interface{}) {}
 
 // Negotiator is responsible for content negotiation when using custom response processors.
+//
+// A Negotiator is immutable once constructed: the builder methods such as Append and
+// WithDefaults return a new Negotiator that shares no mutable state with the original.
+// So a *Negotiator is safe to share between goroutines, including deriving new negotiators
+// from it concurrently.
 type Negotiator struct {
-	processors   []processor.ResponseProcessor
-	errorHandler ErrorHandler
+	processors       []processor.ResponseProcessor
+	errorHandler     ErrorHandler
+	errorFunc        ErrorHandlerFunc
+	errorTemplate    *template.Template
+	defaultTypes     []string
+	preferredLangs   []string
+	codings          []encoding.Coding
+	decoders         []encoding.Coding
+	buffered         bool
+	datetimes        bool
+	emptyCollections bool
+	tracer           func(TraceEvent)
+	metrics          func(string, Offer)
+	defaultAccept    string
+	formatParam      string
+	formats          map[string]string
+	strictLanguage   bool
+	echoLanguage     bool
+	strictAccept     bool
+	hideOffered      bool
+	conditional      bool
+	tieBreak         TieBreak
+	multipleChoices  bool
+	dedupOffers      bool
+	acceptHeader     string
+	languageHeader   string
+	charsetHeader    string
+	encodingHeader   string
+	maxBodySize      int64
+	ranges           bool
+	requestIDHeader  string
 }
 
 // New creates a Negotiator with a list of custom response processors. The error handler
 // invokes http.Error and the diagnostic printer is no-op; change these if required.
 func New(responseProcessors ...processor.ResponseProcessor) *Negotiator {
 	return &Negotiator{
-		processors:   responseProcessors,
+		processors:   copyProcessors(responseProcessors),
 		errorHandler: http.Error,
 	}
 }
 
+// Clone returns a copy of the Negotiator. The processors are copied into a new slice and
+// the error handlers and other settings are retained, so the clone can be configured
+// further without affecting the original. This is also how the other builder methods work.
+//
+// The processors themselves are shared, so they should be fully set up (e.g. using
+// ContentTypeSettable) before they are passed to New or Append.
+func (n *Negotiator) Clone() *Negotiator {
+	c := *n
+	c.processors = copyProcessors(n.processors)
+	c.defaultTypes = append([]string(nil), n.defaultTypes...)
+	c.preferredLangs = append([]string(nil), n.preferredLangs...)
+	c.codings = append([]encoding.Coding(nil), n.codings...)
+	c.decoders = append([]encoding.Coding(nil), n.decoders...)
+	return &c
+}
+
 // Append more response processors. A new Negotiator is returned with the original processors
 // plus the extra processors. The extra processors are appended last.
 // Because the processors are checked in order, any overlap of matching media range
 // goes to the first such matching processor.
 func (n *Negotiator) Append(responseProcessors ...processor.ResponseProcessor) *Negotiator {
-	return &Negotiator{
-		processors:   append(n.processors, responseProcessors...),
-		errorHandler: n.errorHandler,
-	}
+	c := n.Clone()
+	c.processors = append(c.processors, responseProcessors...)
+	return c
+}
+
+// With returns a Negotiator that has the same settings as this one, but uses only the given
+// response processors instead of the original ones. This is cheap enough to use for a single
+// request, e.g. when one endpoint must only ever return XML:
+//
+//	n.With(processor.XML()).Render(req, offers...)
+//
+// The original Negotiator is unaffected.
+func (n *Negotiator) With(responseProcessors ...processor.ResponseProcessor) *Negotiator {
+	c := n.Clone()
+	c.processors = copyProcessors(responseProcessors)
+	return c
 }
 
 // WithDefaults adds the default processors JSON, XML, CSV and TXT.
 func (n *Negotiator) WithDefaults() *Negotiator {
-	return &Negotiator{
-		processors:   append(n.processors, processor.JSON(), processor.XML(), processor.CSV(), processor.TXT()),
-		errorHandler: n.errorHandler,
-	}
+	return n.Append(processor.JSON(), processor.XML(), processor.CSV(), processor.TXT())
 }
 
 // WithErrorHandler adds a custom error handler. This is used for 406-Not Acceptable cases
 // and dealing with 500-Internal Server Error in Negotiate.
 func (n *Negotiator) WithErrorHandler(eh ErrorHandler) *Negotiator {
-	return &Negotiator{
-		processors:   n.processors,
-		errorHandler: eh,
+	c := n.Clone()
+	c.errorHandler = eh
+	return c
+}
+
+// WithErrorHandlerFunc adds a custom error handler that also receives the request and the
+// offers. It is used in the same cases as the handler set by WithErrorHandler, which it
+// takes precedence over.
+func (n *Negotiator) WithErrorHandlerFunc(ehf ErrorHandlerFunc) *Negotiator {
+	c := n.Clone()
+	c.errorFunc = ehf
+	return c
+}
+
+// WithRequestIDHeader sets the name of the request header that holds a correlation ID,
+// e.g. "X-Request-ID", so that error responses can be tied to logs and traces. When a
+// request has this header, any error response from the Negotiator echoes it as a response
+// header of the same name. The ID is also given to the error template as
+// ErrorPage.RequestID, and an ErrorHandlerFunc can get it using RequestID, e.g. for
+// processor.ProblemDetails. By default, there is no request ID.
+func (n *Negotiator) WithRequestIDHeader(name string) *Negotiator {
+	c := n.Clone()
+	c.requestIDHeader = name
+	return c
+}
+
+// RequestID gets the correlation ID of a request from the header set by WithRequestIDHeader.
+// It is blank if there is none.
+func (n *Negotiator) RequestID(req *http.Request) string {
+	if n.requestIDHeader == "" || req == nil {
+		return ""
+	}
+	return req.Header.Get(n.requestIDHeader)
+}
+
+// WithDefaultSubtypes sets the preferred media types, e.g. "application/json", for when the
+// client accepts a wildcard such as "application/*" or "*/*" and several offers would match.
+// Offers with these media types are then chosen ahead of the others, instead of relying on
+// the order of the offers. Offers that match the Accept header exactly are not affected.
+func (n *Negotiator) WithDefaultSubtypes(mediaTypes ...string) *Negotiator {
+	c := n.Clone()
+	for _, mt := range mediaTypes {
+		c.defaultTypes = append(c.defaultTypes, strings.ToLower(mt))
+	}
+	return c
+}
+
+// WithEncoding enables compression of responses using the content codings that the client
+// accepts via the Accept-Encoding header, e.g.
+//
+//	n.WithEncoding(encoding.Gzip, encoding.Deflate)
+//
+// The codings are listed in the server's order of preference, which is used when the client
+// has no preference between them. If none is acceptable, the response is not compressed.
+// Error responses are never compressed.
+func (n *Negotiator) WithEncoding(codings ...encoding.Coding) *Negotiator {
+	c := n.Clone()
+	c.codings = append(c.codings, codings...)
+	return c
+}
+
+// WithBufferedOutput renders each response into a buffer before it is sent, so that the
+// response has a Content-Length header. This costs memory for the whole response, so it is
+// best suited to small responses. It also means that if the processor fails, the response
+// is 500-Internal Server Error instead of a partial body with a 200-OK status.
+func (n *Negotiator) WithBufferedOutput() *Negotiator {
+	c := n.Clone()
+	c.buffered = true
+	return c
+}
+
+// WithMaxBodySize limits the size of each rendered response body, before any content
+// encoding, e.g. to protect against a data provider that produces far more data than
+// expected. When a processor exceeds the limit, rendering fails with ErrBodyTooLarge. Use
+// this with WithBufferedOutput to get a 500-Internal Server Error response instead of a
+// truncated body. Pre-encoded data is not limited.
+func (n *Negotiator) WithMaxBodySize(size int64) *Negotiator {
+	c := n.Clone()
+	c.maxBodySize = size
+	return c
+}
+
+// WithEmptyCollectionNoContent treats empty slices, maps and arrays in the same way as nil
+// data, so the response is 204-No Content. This includes nil slices and maps, which would
+// otherwise be rendered, e.g. as "null" in JSON.
+func (n *Negotiator) WithEmptyCollectionNoContent() *Negotiator {
+	c := n.Clone()
+	c.emptyCollections = true
+	return c
+}
+
+// isEmpty tests whether the data should give a 204-No Content response.
+func (n *Negotiator) isEmpty(data interface{}) bool {
+	if data == nil {
+		return true
+	}
+
+	if _, ok := data.(Seq); ok {
+		return false
+	}
+
+	if b, ok := data.([]byte); ok && len(b) == 0 {
+		return true
+	}
+
+	if n.emptyCollections {
+		switch v := reflect.ValueOf(data); v.Kind() {
+		case reflect.Slice, reflect.Map, reflect.Array:
+			return v.Len() == 0
+		}
+	}
+
+	return false
+}
+
+// WithDefaultAccept sets the Accept header value that is used for requests that have no
+// Accept header, e.g. "application/json". Such requests are then negotiated exactly as if
+// they had sent this header, so WithDefaultSubtypes only matters if it has wildcards.
+// Otherwise, such requests accept anything, so the first offer that a processor can render
+// is used (see Render). This does not affect requests that have an Accept header.
+func (n *Negotiator) WithDefaultAccept(accept string) *Negotiator {
+	c := n.Clone()
+	c.defaultAccept = accept
+	return c
+}
+
+// WithFormatOverride allows a query parameter to override the Accept header, e.g.
+//
+//	n.WithFormatOverride("format", map[string]string{"json": "application/json", "xml": "application/xml"})
+//
+// means that "/users?format=xml" is negotiated as if the Accept header were exactly
+// "application/xml". This is handy for debugging in a browser and for linking to a particular
+// format. Requests without the parameter, or with a value that is not in the map, are
+// negotiated as usual.
+func (n *Negotiator) WithFormatOverride(param string, formats map[string]string) *Negotiator {
+	c := n.Clone()
+	c.formatParam = param
+	c.formats = make(map[string]string, len(formats))
+	for k, v := range formats {
+		c.formats[k] = v
+	}
+	return c
+}
+
+// formatOverride gets the media type given by the format query parameter, if any.
+func (n *Negotiator) formatOverride(req *http.Request) (string, bool) {
+	if n.formatParam == "" || req == nil || req.URL == nil {
+		return "", false
 	}
+	mediaType, ok := n.formats[req.URL.Query().Get(n.formatParam)]
+	return mediaType, ok
+}
+
+// WithPreferredLanguages sets the server's preferred languages, most preferred first, e.g.
+// "fr", "en". These are used to choose between offers in different languages when the client
+// accepts any language, i.e. when there is no Accept-Language header or it only has "*".
+// Offers in the preferred languages are then tried first, in that order; "en" also covers
+// more specific offered languages such as "en-GB". Otherwise, the order of the offers is
+// used, as usual.
+func (n *Negotiator) WithPreferredLanguages(languages ...string) *Negotiator {
+	c := n.Clone()
+	c.preferredLangs = append(c.preferredLangs, languages...)
+	return c
+}
+
+// WithEchoRequestedLanguage sets the Content-Language header to the requested language when
+// the chosen offer has no language. For example, if the request has "Accept-Language: fr",
+// the response will have "Content-Language: fr". The offer is then treated as being in that
+// language, e.g. by data provider functions. By default, there is no Content-Language header
+// for offers without a language, because the content might not be in the requested language.
+func (n *Negotiator) WithEchoRequestedLanguage() *Negotiator {
+	c := n.Clone()
+	c.echoLanguage = true
+	return c
+}
+
+// WithStrictLanguageExclusion makes languages that the client has excluded with a zero
+// quality take effect, e.g. "Accept-Language: de;q=0, *" means anything but German. Otherwise,
+// such exclusions are ignored when a wildcard matches. In any case, if every offer is in an
+// excluded language, they are all considered as usual so that there is still a response.
+func (n *Negotiator) WithStrictLanguageExclusion() *Negotiator {
+	c := n.Clone()
+	c.strictLanguage = true
+	return c
+}
+
+// TieBreak is the policy for choosing between offers when the client accepts them equally,
+// e.g. "Accept: application/json, application/xml".
+type TieBreak int
+
+const (
+	// ServerOrder chooses the first matching offer, in the order the offers are given. This
+	// is the default. Offer order then takes precedence over the quality values too.
+	ServerOrder TieBreak = iota
+	// ClientOrder chooses the offer matching the accepted media range that has the highest
+	// precedence; of those with equal precedence, the first in the Accept header wins.
+	ClientOrder
+)
+
+// WithTieBreak sets the policy for choosing between offers that the client accepts equally.
+// The default is ServerOrder.
+func (n *Negotiator) WithTieBreak(policy TieBreak) *Negotiator {
+	c := n.Clone()
+	c.tieBreak = policy
+	return c
+}
+
+// WithMultipleChoices enables agent-driven negotiation (RFC 7231 section 6.4.1). When the
+// request has no Accept header, or only "*/*", and there are offers of two or more distinct
+// media types, the response is 300-Multiple Choices listing those media types, one per line,
+// so that the client can choose. Otherwise, by default, the first suitable offer is chosen.
+func (n *Negotiator) WithMultipleChoices() *Negotiator {
+	c := n.Clone()
+	c.multipleChoices = true
+	return c
+}
+
+// WithDedupOffers removes duplicate offers before negotiating; see Offers.Dedup. This is
+// useful when offer lists are built dynamically, e.g. by composing several lists, because
+// the duplicates could never be chosen but would still be traced and matched.
+func (n *Negotiator) WithDedupOffers() *Negotiator {
+	c := n.Clone()
+	c.dedupOffers = true
+	return c
+}
+
+// WithAcceptHeaderName sets the name of the request header that is used instead of Accept,
+// e.g. "X-Original-Accept" behind a proxy that moves the client's Accept header. Only the
+// named header is read.
+//
+// Negotiated responses do not have a "Vary: Accept" header; add one yourself if caches need
+// it. The Vary headers that are added, i.e. Accept for 300-Multiple Choices responses,
+// Accept-Encoding or Accept-Datetime when those are negotiated, and Prefer when a data
+// provider uses the preference, always name the standard headers, whatever names are set
+// here.
+func (n *Negotiator) WithAcceptHeaderName(name string) *Negotiator {
+	c := n.Clone()
+	c.acceptHeader = name
+	return c
+}
+
+// WithAcceptLanguageHeaderName sets the name of the request header that is used instead of
+// Accept-Language, in the same way as WithAcceptHeaderName.
+func (n *Negotiator) WithAcceptLanguageHeaderName(name string) *Negotiator {
+	c := n.Clone()
+	c.languageHeader = name
+	return c
+}
+
+// WithAcceptCharsetHeaderName sets the name of the request header that is used instead of
+// Accept-Charset, in the same way as WithAcceptHeaderName.
+func (n *Negotiator) WithAcceptCharsetHeaderName(name string) *Negotiator {
+	c := n.Clone()
+	c.charsetHeader = name
+	return c
+}
+
+// WithAcceptEncodingHeaderName sets the name of the request header that is used instead of
+// Accept-Encoding, in the same way as WithAcceptHeaderName.
+func (n *Negotiator) WithAcceptEncodingHeaderName(name string) *Negotiator {
+	c := n.Clone()
+	c.encodingHeader = name
+	return c
+}
+
+// WithStrictAcceptParsing checks the syntax of the Accept header. Requests with a malformed
+// Accept header, e.g. "application" with no subtype, will get a 400-Bad Request response
+// via the error handler instead of being matched on a best-effort basis.
+//
+// Also, a charset parameter in the Accept header, e.g. "application/json; charset=utf-16",
+// must then match the charset of the processor; if not, the response is 406-Not Acceptable.
+// Otherwise, such parameters are ignored. Processors whose content type has no charset are
+// always acceptable.
+func (n *Negotiator) WithStrictAcceptParsing() *Negotiator {
+	c := n.Clone()
+	c.strictAccept = true
+	return c
+}
+
+// WithoutAvailableTypes disables the X-Available-Types header that otherwise lists the
+// offered media types in 406-Not Acceptable responses.
+func (n *Negotiator) WithoutAvailableTypes() *Negotiator {
+	c := n.Clone()
+	c.hideOffered = true
+	return c
+}
+
+// copyProcessors copies the processors into a new backing array so that
+// negotiators never alias each other's slices.
+func copyProcessors(processors []processor.ResponseProcessor) []processor.ResponseProcessor {
+	ps := make([]processor.ResponseProcessor, len(processors))
+	copy(ps, processors)
+	return ps
 }
 
 // Processor gets the ith processor.
@@ -74,82 +430,526 @@ func (n *Negotiator) N() int {
 	return len(n.processors)
 }
 
+// ContentTypes lists the content types of the processors, in order and without duplicates,
+// e.g. for advertising the media types that can be produced.
+func (n *Negotiator) ContentTypes() []string {
+	var contentTypes []string
+	for _, p := range n.processors {
+		contentTypes = appendUnique(contentTypes, p.ContentType())
+	}
+	return contentTypes
+}
+
+// producibleTypes lists the media types that the processors produce, without any parameters
+// such as charset. Duplicates are omitted.
+func (n *Negotiator) producibleTypes() []string {
+	var types []string
+	for _, p := range n.processors {
+		mediaType, _ := split(p.ContentType(), ';')
+		types = appendUnique(types, strings.TrimSpace(mediaType))
+	}
+	return types
+}
+
+// MustHaveProcessors panics if there are no processors, e.g. because WithDefaults was not
+// called. Otherwise it returns the negotiator, so it can be used at startup, e.g.
+//
+//	n := negotiator.New(processors...).MustHaveProcessors()
+//
+// Without this check, a negotiator without processors gives 406-Not Acceptable responses.
+func (n *Negotiator) MustHaveProcessors() *Negotiator {
+	if len(n.processors) == 0 {
+		panic("negotiator has no response processors; use New with some processors, or WithDefaults")
+	}
+	return n
+}
+
+// ProcessorFor gets the first processor that can process a media range and language,
+// which is the one that negotiation would use. The result is false if there is none.
+func (n *Negotiator) ProcessorFor(mediaRange, lang string) (processor.ResponseProcessor, bool) {
+	mediaRange = strings.ToLower(strings.TrimSpace(mediaRange))
+	for _, p := range n.processors {
+		if p.CanProcess(mediaRange, lang) {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
 //-------------------------------------------------------------------------------------------------
 
 // Negotiate negotiates your model based on the HTTP Accept and Accept-... headers.
 // Any error arising will result in a panic.
+//
+// All the response headers are set before the status code is written, which happens just
+// before the first write of the body, or at the end if there is no body. The processors and
+// error handlers cannot change the status code: any WriteHeader calls that they make are
+// ignored, but headers that they set before writing the body are kept, as for http.Error.
 func (n *Negotiator) Negotiate(w http.ResponseWriter, req *http.Request, offers ...Offer) error {
 	r := n.Render(req, offers...)
 	r.WriteContentType(w)
-	w.WriteHeader(r.StatusCode())
-	err := r.Render(w)
+	dw := &deferredHeaderWriter{ResponseWriter: w, status: r.StatusCode()}
+	err := r.Render(dw)
+	dw.writeHeader()
 	if err != nil {
 		return fmt.Errorf("%s %s %w", req.Method, req.URL, err)
 	}
 	return nil
 }
 
+// NegotiateCapture is like Negotiate except that the response is captured, including its
+// status code, headers and body, instead of being sent. The usual sequence of WriteContentType,
+// WriteHeader and Render is used, so the headers are exactly those that a client would see.
+// This is useful for tests and for middleware that rewrites responses.
+func (n *Negotiator) NegotiateCapture(req *http.Request, offers ...Offer) (*CapturedResponse, error) {
+	w := &captureResponseWriter{captured: &CapturedResponse{Header: make(http.Header)}}
+	err := n.Negotiate(w, req, offers...)
+	if w.captured.StatusCode == 0 {
+		w.captured.StatusCode = http.StatusOK
+	}
+	w.captured.Body = w.buf.Bytes()
+	return w.captured, err
+}
+
 // Render computes the best matching response, if there is one, and returns a suitable renderer
 // that is compatible with Gin (github.com/gin-gonic/gin).
+//
+// A request without an Accept header is treated as "*/*", unless WithDefaultAccept is used,
+// in which case its value is used instead. With "*/*", the first offer that a processor can
+// render is chosen, in offer order, except that offers of the media types given by
+// WithDefaultSubtypes come first. An offer without a media type is rendered by the first
+// processor. Offers that no processor can render are skipped.
+//
+// The Accept header is parsed by header.ParseMediaRanges, or by header.ParseMediaRangesStrictly
+// if WithStrictAcceptParsing is used; both give the same result for valid headers. The other
+// Accept-... headers are parsed by header.Parse. All of these use header.DefaultQuality for
+// values without a "q" parameter.
 func (n *Negotiator) Render(req *http.Request, offers ...Offer) CodedRender {
-	offers = Offers(offers).setDefaultWildcards()
+	return n.render(requestValues{
+		req:            req,
+		accept:         n.accept(req),
+		acceptLanguage: headerValue(req, headerName(n.languageHeader, AcceptLanguage)),
+		acceptCharset:  headerValue(req, headerName(n.charsetHeader, AcceptCharset)),
+		acceptEncoding: headerValue(req, headerName(n.encodingHeader, AcceptEncoding)),
+		acceptDatetime: req.Header.Get(AcceptDatetime),
+		pref:           PreferReturn(req),
+		ajax:           IsAjax(req),
+	}, offers)
+}
+
+// RenderValues is like Render except that it takes the Accept and Accept-Language header
+// values directly, along with whether the request is an Ajax request. This allows the
+// negotiation to be used for things other than HTTP requests, e.g. messages from a message
+// bus. Any ErrorHandlerFunc will be passed a nil request.
+func (n *Negotiator) RenderValues(accept, acceptLanguage string, ajax bool, offers ...Offer) CodedRender {
+	return n.render(requestValues{
+		accept:         accept,
+		acceptLanguage: acceptLanguage,
+		ajax:           ajax,
+	}, offers)
+}
+
+// ParseRequest parses the Accept, Accept-Language, Accept-Charset and Accept-Encoding headers
+// of a request, in the same way as negotiation does, without negotiating anything. Each result
+// is sorted with the most preferred values first. As in negotiation, a missing Accept or
+// Accept-Language header gives "*/*" or "*" respectively, whereas the others are empty.
+// This is useful for building custom negotiation, e.g. in middleware.
+func ParseRequest(req *http.Request) (mrs header.MediaRanges, languages, charsets, encodings header.PrecedenceValues) {
+	mrs = header.ParseMediaRanges(headerValue(req, Accept)).WithDefault()
+	languages = header.Parse(headerValue(req, AcceptLanguage)).WithDefault()
+	charsets = header.Parse(headerValue(req, AcceptCharset))
+	encodings = header.Parse(headerValue(req, AcceptEncoding))
+	return mrs, languages, charsets, encodings
+}
+
+// headerValue gets a request header. If it was sent as several header fields, these are
+// combined into a comma-separated list, as allowed by RFC 7230 section 3.2.2.
+func headerValue(req *http.Request, name string) string {
+	values := req.Header.Values(name)
+	switch len(values) {
+	case 0:
+		return ""
+	case 1:
+		return values[0]
+	}
+	return strings.Join(values, ", ")
+}
+
+// accept gets the Accept request header, or the header configured instead of it.
+func (n *Negotiator) accept(req *http.Request) string {
+	return headerValue(req, headerName(n.acceptHeader, Accept))
+}
+
+// headerName gets the configured name of a request header, or else its standard name.
+func headerName(configured, standard string) string {
+	if configured != "" {
+		return configured
+	}
+	return standard
+}
+
+// requestValues holds the request headers that are used for negotiation.
+type requestValues struct {
+	req            *http.Request // nil if not known
+	accept         string
+	acceptLanguage string
+	acceptCharset  string
+	acceptEncoding string
+	acceptDatetime string
+	pref           string
+	ajax           bool
+}
+
+func (n *Negotiator) render(rv requestValues, offers Offers) CodedRender {
+	cr := n.negotiate(rv, offers)
+	if r, ok := cr.(*renderer); ok && r.offer.PreEncoded != "" {
+		cr = n.preEncoded(rv, r)
+	} else if ok && len(r.offer.Encodings) > 0 {
+		cr = n.encodedVariant(rv, r)
+	}
+
+	if r, ok := cr.(*renderer); ok && n.conditional {
+		cr = n.checkPreconditions(rv, r)
+	}
+
+	if r, ok := cr.(*renderer); ok && n.ranges {
+		cr = n.checkRange(rv, r)
+	}
+
+	if n.metrics != nil {
+		n.recordMetrics(rv, cr)
+	}
+
+	r, ok := cr.(*renderer)
+	if !ok {
+		return cr
+	}
+
+	if len(n.codings) > 0 && r.contentEncoding == "" {
+		r.coding = encoding.Select(header.Parse(rv.acceptEncoding), n.codings)
+		if r.offer.PreEncoded == "" && len(r.offer.Encodings) == 0 {
+			r.vary = append(r.vary, AcceptEncoding)
+		}
+	}
+
+	if n.datetimes {
+		r.vary = append(r.vary, AcceptDatetime)
+	}
 
-	if IsAjax(req) {
-		return n.ajaxNegotiate(offers)
+	r.maxBodySize = n.maxBodySize
+
+	if n.buffered {
+		return bufferRendering(r)
 	}
 
-	mrs := header.ParseMediaRanges(req.Header.Get(Accept)).WithDefault()
-	languages := header.Parse(req.Header.Get(AcceptLanguage)).WithDefault()
+	return r
+}
+
+// WithMetrics sets a function that is called once for each response that is rendered, with
+// the outcome and the chosen offer. The outcome is one of
+//
+// * "matched" - an offer was chosen,
+//
+// * "ajax" - an offer was chosen for an Ajax request,
+//
+// * "204" - the chosen offer had no data,
+//
+// * "406" - no offer was acceptable; the offer is empty,
+//
+// * "400" - the request headers were malformed; the offer is empty,
+//
+// * "300" - there were several alternatives to choose from (see WithMultipleChoices),
+//
+// * "412" - the If-Match header did not match the chosen offer (see WithConditionalRequests),
+//
+// * "206" - part of the chosen offer was served (see WithRangeSupport),
+//
+// * "416" - the Range header was not satisfiable; the offer is empty.
+func (n *Negotiator) WithMetrics(metrics func(result string, offer Offer)) *Negotiator {
+	c := n.Clone()
+	c.metrics = metrics
+	return c
+}
+
+func (n *Negotiator) recordMetrics(rv requestValues, cr CodedRender) {
+	switch r := cr.(type) {
+	case *renderer:
+		if rv.ajax {
+			n.metrics("ajax", r.offer)
+		} else {
+			n.metrics("matched", r.offer)
+		}
+	case noContent:
+		n.metrics("204", r.offer)
+	case badRequest:
+		n.metrics("400", Offer{})
+	case multipleChoices:
+		n.metrics("300", Offer{})
+	case preconditionFailed:
+		n.metrics("412", Offer{})
+	case *partialContent:
+		n.metrics("206", r.offer)
+	case rangeNotSatisfiable:
+		n.metrics("416", Offer{})
+	default:
+		n.metrics("406", Offer{})
+	}
+}
+
+func (n *Negotiator) negotiate(rv requestValues, offers Offers) CodedRender {
+	offers = offers.selectWhen(rv.req)
+
+	if n.dedupOffers {
+		offers = offers.Dedup()
+	}
+
+	if mediaType, ok := n.formatOverride(rv.req); ok {
+		rv.accept = mediaType
+	} else if rv.accept == "" {
+		rv.accept = n.defaultAccept
+	}
+
+	if n.datetimes && rv.acceptDatetime != "" {
+		requested, err := http.ParseTime(rv.acceptDatetime)
+		if err != nil {
+			info2("400 bad request", "Accept-Datetime", rv.acceptDatetime, "Error", err)
+			eh, contentType := n.errorHandlerFor(rv, offers)
+			return badRequest{errorHandler: eh, contentType: contentType, message: err.Error(), reason: rv.reason(MalformedHeader, err.Error())}
+		}
+		offers = selectByDatetime(offers, requested)
+	}
+
+	if rv.ajax {
+		return n.ajaxNegotiate(rv, offers.setDefaultWildcards())
+	}
+
+	if n.multipleChoices && (rv.accept == "" || rv.accept == "*/*") {
+		if alternatives := offers.distinctMediaTypes(); len(alternatives) > 1 {
+			info2("300 multiple choices", "Accept", rv.accept, "Alternatives", alternatives)
+			return multipleChoices{alternatives: alternatives, hideOffered: n.hideOffered}
+		}
+	}
+
+	if len(offers) == 1 && len(offers[0].MatchParams) == 0 && acceptsAnything(rv) {
+		return n.renderSingleOffer(rv, offers[0])
+	}
+
+	offers = offers.setDefaultWildcards()
+
+	mrs, err := n.parseAccept(rv.accept)
+	if err != nil {
+		info2("400 bad request", "Accept", rv.accept, "Error", err)
+		eh, contentType := n.errorHandlerFor(rv, offers)
+		return badRequest{errorHandler: eh, contentType: contentType, message: err.Error(), reason: rv.reason(MalformedHeader, err.Error())}
+	}
+	mrs = mrs.WithDefault()
+	languages := header.Parse(rv.acceptLanguage).WithDefault()
+	charsets := header.Parse(rv.acceptCharset)
 
 	if len(n.processors) == 0 {
 		info2("406 no processors configured", "Accept", mrs.String(), "Accept-Language", languages.String())
-		return unacceptable{n.errorHandler}
+		return n.unacceptable(rv, offers, NoProcessor)
 	}
 
 	// first pass - remove offers that match exclusions
-	// (this doesn't apply to language exclusions because we always allow at least one language match)
-	remaining := removeExcludedOffers(offers, mrs)
+	// (language exclusions apply only if enabled, and always allow at least one offer)
+	remaining := n.removeExcludedOffers(offers, mrs)
+	if n.strictLanguage {
+		remaining = n.removeExcludedLanguages(remaining, languages)
+	}
+	remaining = n.preferredLanguagesFirst(remaining, languages)
 
 	// second pass - find the first exact-match media-range and language combination
-	for _, offer := range remaining {
-		p := n.findBestMatch(mrs, languages, offer, exactMatch)
-		if p != nil {
-			return process(p, offer)
+	if cr := n.firstMatch(rv, remaining, mrs, languages, charsets, exactMatch); cr != nil {
+		return cr
+	}
+
+	// third pass - find the first near-match media-range and language combination,
+	// trying the default subtypes first
+	if cr := n.firstMatch(rv, n.defaultTypesFirst(remaining), mrs, languages, charsets, nearMatch); cr != nil {
+		return cr
+	}
+
+	info2("406 rejected", "Accept", mrs.String(), "Accept-Language", languages.String(), "Accept-Charset", charsets.String())
+	n.traceRejected(mrs.String(), languages.String())
+	return n.unacceptable(rv, offers, diagnose(offers, remaining, mrs, languages, charsets))
+}
+
+// defaultTypesFirst reorders the offers so that any with the default subtypes come first.
+// Otherwise, the order is unchanged.
+func (n *Negotiator) defaultTypesFirst(offers Offers) Offers {
+	if len(n.defaultTypes) == 0 {
+		return offers
+	}
+
+	sorted := make(Offers, 0, len(offers))
+	for _, dt := range n.defaultTypes {
+		for _, offer := range offers {
+			if strings.EqualFold(offer.MediaType, dt) {
+				sorted = append(sorted, offer)
+			}
 		}
 	}
 
-	// third pass - find the first near-match media-range and language combination
-	for _, offer := range remaining {
-		p := n.findBestMatch(mrs, languages, offer, nearMatch)
-		if p != nil {
-			return process(p, offer)
+	for _, offer := range offers {
+		if !n.isDefaultType(offer.MediaType) {
+			sorted = append(sorted, offer)
 		}
 	}
 
-	info2("406 rejected", "Accept", mrs.String(), "Accept-Language", languages.String())
-	return unacceptable{n.errorHandler}
+	return sorted
 }
 
-func (n *Negotiator) findBestMatch(mrs header.MediaRanges, languages header.PrecedenceValues, offer Offer,
-	match func(header.MediaRange, header.PrecedenceValue, Offer) bool) processor.ResponseProcessor {
+// preferredLanguagesFirst reorders the offers so that any in the preferred languages come
+// first, provided that the client accepts any language. Languages that the client has
+// excluded, e.g. "fr;q=0, *", are not promoted. Otherwise, the order is unchanged.
+func (n *Negotiator) preferredLanguagesFirst(offers Offers, languages header.PrecedenceValues) Offers {
+	if len(n.preferredLangs) == 0 || !acceptsAnyLanguage(languages) {
+		return offers
+	}
+
+	sorted := make(Offers, 0, len(offers))
+	used := make([]bool, len(offers))
+	for _, pl := range n.preferredLangs {
+		for i, offer := range offers {
+			if !used[i] && offer.Language != "*" && hasSubtagPrefix(offer.Language, pl) &&
+				!isLanguageExcluded(offer, languages) {
+				sorted = append(sorted, offer)
+				used[i] = true
+			}
+		}
+	}
+
+	for i, offer := range offers {
+		if !used[i] {
+			sorted = append(sorted, offer)
+		}
+	}
+
+	return sorted
+}
+
+// acceptsAnyLanguage tests whether the only acceptable language range is "*".
+func acceptsAnyLanguage(languages header.PrecedenceValues) bool {
+	for _, lang := range languages {
+		if lang.Quality > 0 && lang.Value != "*" {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *Negotiator) isDefaultType(mediaType string) bool {
+	for _, dt := range n.defaultTypes {
+		if strings.EqualFold(mediaType, dt) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *Negotiator) parseAccept(accept string) (header.MediaRanges, error) {
+	if n.strictAccept {
+		return header.ParseMediaRangesStrictly(accept)
+	}
+	return header.ParseMediaRanges(accept), nil
+}
+
+// acceptsAnything tests whether the request has either no Accept header or "Accept: */*".
+// It returns false whenever there is an Accept-Language or Accept-Charset header, so that
+// language and charset matching are always done by the general algorithm.
+func acceptsAnything(rv requestValues) bool {
+	return (rv.accept == "" || rv.accept == "*/*") &&
+		rv.acceptLanguage == "" &&
+		rv.acceptCharset == ""
+}
+
+// renderSingleOffer is a fast path for the common case of a single offer and a request that
+// accepts any media type and has no Accept-Language or Accept-Charset header. The outcome is
+// the same as for the general algorithm in Render, but it avoids parsing the headers and
+// copying the offers. It is not allocation-free: the renderer that is returned is still
+// allocated.
+func (n *Negotiator) renderSingleOffer(rv requestValues, offer Offer) CodedRender {
+	if len(n.processors) == 0 {
+		info2("406 no processors configured", "Accept", "*/*", "Accept-Language", "*")
+		return n.unacceptable(rv, Offers{offer}, NoProcessor)
+	}
+
+	offer = offer.withDefaultWildcards()
+	matched := matchedMediaRange(anyMediaRange, offer)
+
+	if offer.MediaType == "*/*" {
+		// default to the first processor
+		n.trace("200 matched wildcard", Matched, "*/*", "*", offer)
+		return n.process(n.processors[0], offer, matched, rv)
+	}
+
+	// find the first matching processor
+	for _, p := range n.processors {
+		if p.CanProcess(offer.normalisedMediaType(), offer.Language) {
+			n.trace("200 matched", Matched, "*/*", "*", offer)
+			return n.process(p, offer, matched, rv)
+		}
+	}
+
+	info2("406 rejected", "Accept", "*/*", "Accept-Language", "*")
+	n.traceRejected("*/*", "*")
+	return n.unacceptable(rv, Offers{offer}, NoProcessor)
+}
+
+// firstMatch finds the first offer that matches, according to the tie-break policy. For
+// ServerOrder, each offer is compared with all the accepted media ranges in turn. For
+// ClientOrder, each accepted media range is compared with all the offers in turn; the media
+// ranges are in order of precedence and, when equal, in the order of the Accept header
+// because they are sorted stably.
+func (n *Negotiator) firstMatch(rv requestValues, offers Offers, mrs header.MediaRanges, languages, charsets header.PrecedenceValues,
+	match func(header.MediaRange, header.PrecedenceValue, Offer) bool) CodedRender {
+
+	if n.tieBreak == ClientOrder {
+		for i := range mrs {
+			for _, offer := range offers {
+				p, matched, lang := n.findBestMatch(mrs[i:i+1], languages, charsets, offer, match)
+				if p != nil {
+					return n.process(p, n.withEchoedLanguage(offer, lang), matched, rv)
+				}
+			}
+		}
+		return nil
+	}
+
+	for _, offer := range offers {
+		p, matched, lang := n.findBestMatch(mrs, languages, charsets, offer, match)
+		if p != nil {
+			return n.process(p, n.withEchoedLanguage(offer, lang), matched, rv)
+		}
+	}
+	return nil
+}
+
+func (n *Negotiator) findBestMatch(mrs header.MediaRanges, languages, charsets header.PrecedenceValues, offer Offer,
+	match func(header.MediaRange, header.PrecedenceValue, Offer) bool) (processor.ResponseProcessor, header.MediaRange, string) {
 
 	for _, accepted := range mrs {
 		for _, lang := range languages {
-			info("compared", accepted.Value(), lang.Value, offer)
+			n.trace("compared", Compared, accepted.Value(), lang.Value, offer)
 
 			if match(accepted, lang, offer) {
-				if lang.Quality > 0 {
+				if accepted.Quality > 0 && lang.Quality > 0 {
 					if offer.MediaType == "*/*" {
 						// default to the first processor
-						info("200 matched wildcard", accepted.Value(), lang.Value, offer)
-						return n.processors[0]
+						if acceptsCharset(charsets, n.processors[0]) && n.honoursCharset(accepted, n.processors[0]) {
+							n.trace("200 matched wildcard", Matched, accepted.Value(), lang.Value, offer)
+							return n.processors[0], matchedMediaRange(accepted, offer), lang.Value
+						}
+						continue
 					}
 
 					// find the first matching processor
 					for _, p := range n.processors {
-						if p.CanProcess(offer.MediaType, offer.Language) {
-							info("200 matched", accepted.Value(), lang.Value, offer)
-							return p
+						if p.CanProcess(offer.normalisedMediaType(), offer.Language) &&
+							acceptsCharset(charsets, p) && n.honoursCharset(accepted, p) {
+							n.trace("200 matched", Matched, accepted.Value(), lang.Value, offer)
+							return p, matchedMediaRange(accepted, offer), lang.Value
 						}
 					}
 				}
@@ -157,54 +957,217 @@ func (n *Negotiator) findBestMatch(mrs header.MediaRanges, languages header.Prec
 		}
 	}
 
-	return nil
+	return nil, header.MediaRange{}, ""
 }
 
-// Any media range
-func removeExcludedOffers(offers Offers, mrs header.MediaRanges) Offers {
-	excluded := make([]bool, len(offers))
-	for i, offer := range offers {
-		offeredType, offeredSubtype := split(offer.MediaType, '/')
+var anyMediaRange = header.MediaRange{Type: "*", Subtype: "*", Quality: header.DefaultQuality}
 
-		for _, accepted := range mrs {
-			if accepted.Quality <= 0 &&
-				accepted.Type == offeredType &&
-				accepted.Subtype == offeredSubtype {
+// matchedMediaRange gets the media range that was matched, which is the accepted media range
+// unless it contains a wildcard and the offer is more specific.
+func matchedMediaRange(accepted header.MediaRange, offer Offer) header.MediaRange {
+	if accepted.Type != "*" && accepted.Subtype != "*" {
+		return accepted
+	}
 
-				excluded[i] = true
-			}
+	offeredType, offeredSubtype := split(offer.normalisedMediaType(), '/')
+	if offeredType == "*" || offeredSubtype == "*" {
+		return accepted
+	}
+
+	return header.MediaRange{Type: offeredType, Subtype: offeredSubtype, Quality: accepted.Quality}
+}
+
+// removeExcludedOffers removes the offers that the client has explicitly excluded with a
+// zero quality. As in RFC 7231 section 5.3.2, the most specific media range that matches
+// an offer has precedence. So "*/*;q=0" excludes every offer but "application/json,
+// */*;q=0" still allows application/json, and "text/*;q=0" excludes "text/plain" unless
+// "text/plain" is also accepted with non-zero quality. A media range with parameters, e.g.
+// "text/html;level=1;q=0", is more specific still, but it only applies to offers that have
+// the same parameters in their MatchParams.
+//
+// An offer with a wildcard media type, e.g. "text/*", is only excluded if a zero-quality
+// range covers it and nothing that overlaps it is acceptable, because it can still be
+// rendered by a processor for any media range that is acceptable.
+func (n *Negotiator) removeExcludedOffers(offers Offers, mrs header.MediaRanges) Offers {
+	remaining := make(Offers, 0, len(offers))
+	for _, offer := range offers {
+		if isExcluded(offer, mrs) {
+			n.trace("excluded", Excluded, mrs.String(), "*", offer)
+		} else {
+			remaining = append(remaining, offer)
 		}
 	}
+	return remaining
+}
 
+// withEchoedLanguage sets the language of an offer without one to the language that matched
+// it, if WithEchoRequestedLanguage is enabled and the matched language is specific.
+func (n *Negotiator) withEchoedLanguage(offer Offer, lang string) Offer {
+	if n.echoLanguage && offer.Language == "*" && lang != "*" && strings.IndexByte(lang, '*') < 0 {
+		offer.Language = lang
+	}
+	return offer
+}
+
+// removeExcludedLanguages removes the offers in languages that the client has explicitly
+// excluded with a zero quality, e.g. "de;q=0, *". The most specific language range that
+// matches an offer has precedence. If every offer would be removed, none is.
+func (n *Negotiator) removeExcludedLanguages(offers Offers, languages header.PrecedenceValues) Offers {
 	remaining := make(Offers, 0, len(offers))
-	for i, offer := range offers {
-		if !excluded[i] {
+	for _, offer := range offers {
+		if isLanguageExcluded(offer, languages) {
+			n.trace("excluded", Excluded, "*/*", languages.String(), offer)
+		} else {
 			remaining = append(remaining, offer)
 		}
 	}
 
+	if len(remaining) == 0 {
+		return offers
+	}
 	return remaining
 }
 
+func isLanguageExcluded(offer Offer, languages header.PrecedenceValues) bool {
+	if offer.Language == "*" {
+		return false
+	}
+
+	excluded := false
+	best := -1
+	for _, lang := range languages {
+		s := languageSpecificity(lang.Value, offer.Language)
+		if s > best {
+			best = s
+			excluded = lang.Quality <= 0
+		}
+	}
+	return excluded
+}
+
+// languageSpecificity measures how closely a language range matches a language tag: the
+// length of the range if the tag starts with it, 0 for "*" and -1 if it doesn't match.
+func languageSpecificity(languageRange, tag string) int {
+	switch {
+	case languageRange == "*":
+		return 0
+	case strings.IndexByte(languageRange, '*') >= 0:
+		if extendedFilter(languageRange, tag) {
+			return 1
+		}
+	case hasSubtagPrefix(tag, languageRange):
+		return len(languageRange)
+	}
+	return -1
+}
+
+func isExcluded(offer Offer, mrs header.MediaRanges) bool {
+	offeredType, offeredSubtype := split(offer.normalisedMediaType(), '/')
+
+	if offeredType == "*" || offeredSubtype == "*" {
+		covered := false
+		for _, accepted := range mrs {
+			if offeredType != "*" && accepted.Type != "*" && accepted.Type != offeredType {
+				continue // no overlap
+			}
+			if accepted.Quality > 0 {
+				return false
+			}
+			covered = covered || offeredType == "*" || accepted.Type == "*" || accepted.Subtype == "*"
+		}
+		return covered
+	}
+
+	excluded := false
+	best := -1
+	for _, accepted := range mrs {
+		s := specificity(accepted, offer, offeredType, offeredSubtype)
+		if s > best {
+			best = s
+			excluded = accepted.Quality <= 0
+		}
+	}
+	return excluded
+}
+
+// specificity ranks how closely an accepted media range matches an offer, or -1 if it does
+// not match. Media ranges with parameters match only offers with those MatchParams.
+func specificity(accepted header.MediaRange, offer Offer, offeredType, offeredSubtype string) int {
+	if len(accepted.Params) > 0 {
+		if accepted.Type == offeredType && accepted.Subtype == offeredSubtype && hasAllParams(offer, accepted.Params) {
+			return 3
+		}
+		return -1
+	}
+
+	switch {
+	case accepted.Type == offeredType && accepted.Subtype == offeredSubtype:
+		return 2
+	case accepted.Type == offeredType && accepted.Subtype == "*":
+		return 1
+	case accepted.Type == "*" && accepted.Subtype == "*":
+		return 0
+	}
+	return -1
+}
+
+// hasAllParams tests whether the offer's MatchParams include all of the parameters.
+func hasAllParams(offer Offer, params []header.KV) bool {
+	for _, kv := range params {
+		found := false
+		for k, v := range offer.MatchParams {
+			if strings.EqualFold(k, strings.TrimSpace(kv.Key)) && strings.EqualFold(v, strings.Trim(strings.TrimSpace(kv.Value), `"`)) {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// exactMatch tests whether an offer has exactly the accepted media type. "*/*" is not an
+// exact match for anything, not even an offer without a media type, so that every offer is
+// then treated alike, in offer order.
 func exactMatch(accepted header.MediaRange, lang header.PrecedenceValue, offer Offer) bool {
-	offeredType, offeredSubtype := split(offer.MediaType, '/')
+	if accepted.Type == "*" {
+		return false
+	}
+	offeredType, offeredSubtype := split(offer.normalisedMediaType(), '/')
 	return accepted.Type == offeredType &&
 		accepted.Subtype == offeredSubtype &&
-		equalOrPrefix(lang.Value, offer.Language)
+		equalOrPrefix(lang.Value, offer.Language) &&
+		hasMatchParams(accepted, offer)
 }
 
 func nearMatch(accepted header.MediaRange, lang header.PrecedenceValue, offer Offer) bool {
-	offeredType, offeredSubtype := split(offer.MediaType, '/')
+	offeredType, offeredSubtype := split(offer.normalisedMediaType(), '/')
 	return equalOrWildcard(accepted.Type, offeredType) &&
 		equalOrWildcard(accepted.Subtype, offeredSubtype) &&
-		equalOrPrefix(lang.Value, offer.Language)
+		equalOrPrefix(lang.Value, offer.Language) &&
+		hasMatchParams(accepted, offer)
+}
+
+// hasMatchParams tests whether the accepted media range has all the parameters that the
+// offer requires.
+func hasMatchParams(accepted header.MediaRange, offer Offer) bool {
+	for k, v := range offer.MatchParams {
+		if !hasParam(accepted.Params, k, v) {
+			return false
+		}
+	}
+	return true
 }
 
-func equalOrPrefix(acceptedLang, offeredLang string) bool {
-	return acceptedLang == "*" ||
-		offeredLang == "*" ||
-		acceptedLang == offeredLang ||
-		strings.HasPrefix(acceptedLang, offeredLang+"-")
+func hasParam(params []header.KV, key, value string) bool {
+	for _, kv := range params {
+		if strings.EqualFold(strings.TrimSpace(kv.Key), key) &&
+			strings.EqualFold(strings.Trim(strings.TrimSpace(kv.Value), `"`), value) {
+			return true
+		}
+	}
+	return false
 }
 
 func equalOrWildcard(accepted, offered string) bool {
@@ -215,19 +1178,60 @@ func equalOrWildcard(accepted, offered string) bool {
 
 //-------------------------------------------------------------------------------------------------
 
-func process(p processor.ResponseProcessor, offer Offer) CodedRender {
-	data := dereferenceDataProviders(offer.Data, offer.Language)
-	if data == nil {
-		return emptyCode(http.StatusNoContent)
+func (n *Negotiator) process(p processor.ResponseProcessor, offer Offer, matched header.MediaRange, rv requestValues) CodedRender {
+	pref := rv.pref
+	data, usedPref, applied := dereferenceDataProviders(offer.Data, offer.Language, pref)
+	if n.isEmpty(data) && len(offer.Encodings) == 0 {
+		return noContent{offer}
+	}
+
+	if mra, ok := p.(processor.MediaRangeAware); ok {
+		p = mra.ForMediaRange(matched)
 	}
 
-	return &renderer{
+	if la, ok := p.(processor.LanguageAware); ok {
+		p = la.ForLanguage(offer.Language)
+	}
+
+	if ta, ok := p.(processor.TemplateAware); ok {
+		p = ta.ForTemplate(offer.Template)
+	}
+
+	if ra, ok := p.(processor.RequestAware); ok && rv.req != nil {
+		p = ra.ForRequest(rv.req)
+	}
+
+	r := &renderer{
+		offer:       offer,
 		data:        data,
 		language:    offer.Language,
 		template:    offer.Template,
 		contentType: p.ContentType(),
 		process:     p.Process,
+		datetime:    offer.Datetime,
+	}
+
+	if offer.ContentType != "" {
+		r.contentType = offer.ContentType
+	}
+
+	if usedPref {
+		r.vary = append(r.vary, Prefer)
 	}
+
+	if applied {
+		r.preferenceApplied = "return=" + pref
+	}
+
+	if d, ok := p.(processor.Downloadable); ok && d.IsDownload() {
+		r.filename = offer.Filename
+	}
+
+	if v, ok := p.(processor.Verbatim); ok && v.IsVerbatim() {
+		r.verbatim = true
+	}
+
+	return r
 }
 
 func info(msg, accepted, lang string, offer Offer) {
@@ -248,20 +1252,90 @@ func info2(msg string, vv ...interface{}) {
 	Printer('D', msg, m)
 }
 
-func (n *Negotiator) ajaxNegotiate(offers Offers) CodedRender {
+func (n *Negotiator) ajaxNegotiate(rv requestValues, offers Offers) CodedRender {
 	for _, offer := range offers {
-		if offer.MediaType == "*/*" || offer.MediaType == "application/*" || offer.MediaType == "application/json" {
-			data := dereferenceDataProviders(offer.Data, offer.Language)
-			return &renderer{
+		mediaType := offer.normalisedMediaType()
+		if mediaType == "*/*" || mediaType == "application/*" || mediaType == "application/json" {
+			data, usedPref, applied := dereferenceDataProviders(offer.Data, offer.Language, rv.pref)
+			if n.emptyCollections && n.isEmpty(data) {
+				return noContent{offer}
+			}
+			r := &renderer{
+				offer:       offer,
 				data:        data,
 				language:    offer.Language,
 				contentType: "application/json; charset=utf-8",
 				process:     processor.RenderJSON(""),
+				datetime:    offer.Datetime,
+			}
+			if usedPref {
+				r.vary = append(r.vary, Prefer)
+			}
+			if applied {
+				r.preferenceApplied = "return=" + rv.pref
 			}
+			return r
+		}
+	}
+
+	return n.unacceptable(rv, offers, MediaTypeMismatch)
+}
+
+// unacceptable gets the 406 renderer, which lists the offered media types unless disabled.
+// Wildcard offers are listed as the media types of the processors.
+func (n *Negotiator) unacceptable(rv requestValues, offers Offers, cause Cause) CodedRender {
+	eh, contentType := n.errorHandlerFor(rv, offers)
+	reason := rv.reason(cause, "")
+	if n.hideOffered {
+		return unacceptable{errorHandler: eh, contentType: contentType, reason: reason}
+	}
+
+	var available []string
+	for _, offer := range offers {
+		if offer.MediaType == "" || strings.IndexByte(offer.MediaType, '*') >= 0 {
+			for _, mediaType := range n.producibleTypes() {
+				available = appendUnique(available, mediaType)
+			}
+		} else {
+			available = appendUnique(available, offer.MediaType)
+		}
+	}
+
+	return unacceptable{errorHandler: eh, contentType: contentType, available: available, reason: reason}
+}
+
+// errorHandlerFor gets the error handler, preferring the ErrorHandlerFunc if there is one,
+// then the error template if the client prefers HTML. The content type is blank unless
+// the error template is used. Any request ID is echoed in the response headers.
+func (n *Negotiator) errorHandlerFor(rv requestValues, offers Offers) (ErrorHandler, string) {
+	requestID := n.RequestID(rv.req)
+	eh, contentType := n.errorHandler, ""
+
+	if n.errorFunc != nil {
+		eh = func(w http.ResponseWriter, _ string, code int) {
+			n.errorFunc(w, rv.req, offers, code)
 		}
+	} else if n.errorTemplate != nil && prefersHTML(rv.accept) {
+		eh, contentType = templateErrorHandler(n.errorTemplate, n.errorHandler, requestID), htmlContentType
 	}
 
-	return unacceptable{n.errorHandler}
+	if requestID == "" {
+		return eh, contentType
+	}
+
+	return func(w http.ResponseWriter, error string, code int) {
+		w.Header().Set(n.requestIDHeader, requestID)
+		eh(w, error, code)
+	}, contentType
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
 }
 
 // IsAjax tests whether a request has the Ajax header sent by browsers for XHR requests.
@@ -269,6 +1343,22 @@ func IsAjax(req *http.Request) bool {
 	return req.Header.Get(XRequestedWith) == XMLHttpRequest
 }
 
+// PreferReturn gets the "return" preference from the Prefer request header (RFC 7240),
+// which is normally "minimal" or "representation". It is blank if there is none.
+func PreferReturn(req *http.Request) string {
+	for _, line := range req.Header.Values(Prefer) {
+		for _, pref := range strings.Split(line, ",") {
+			// ignore any parameters of the preference
+			kv, _ := split(pref, ';')
+			k, v := split(strings.TrimSpace(kv), '=')
+			if strings.EqualFold(strings.TrimSpace(k), "return") {
+				return strings.Trim(strings.TrimSpace(v), `"`)
+			}
+		}
+	}
+	return ""
+}
+
 func split(value string, b byte) (string, string) {
 	i := strings.IndexByte(value, b)
 	if i < 0 {
@@ -279,10 +1369,22 @@ func split(value string, b byte) (string, string) {
 
 // StdLogger adapts the standard Go logger to be usable for the negotiator.
 var StdLogger = func(level byte, message string, data map[string]interface{}) {
+	log.Print(FormatEntry(level, message, data))
+}
+
+// FormatEntry formats a log entry for the Printer as text. The data is sorted by key so
+// that the output is always the same for the same entry.
+func FormatEntry(level byte, message string, data map[string]interface{}) string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
 	buf := &strings.Builder{}
 	fmt.Fprintf(buf, "%c: %s", level, message)
-	for k, v := range data {
-		fmt.Fprintf(buf, ", %q: %v", k, v)
+	for _, k := range keys {
+		fmt.Fprintf(buf, ", %q: %v", k, data[k])
 	}
-	log.Printf(buf.String())
+	return buf.String()
 }
@@ -1,17 +1,26 @@
 package negotiator_test
 
 import (
+	"bytes"
+	"compress/gzip"
 	"errors"
 	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"log"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/onsi/gomega"
 	"github.com/rickb777/negotiator"
+	"github.com/rickb777/negotiator/encoding"
 	"github.com/rickb777/negotiator/processor"
 )
 
@@ -93,6 +102,50 @@ func Test_should_add_custom_response_processors_to_end(t *testing.T) {
 	g.Expect(processorName).To(gomega.Equal("*negotiator_test.fakeProcessor"))
 }
 
+func Test_derived_negotiators_should_not_share_processors(t *testing.T) {
+	g := gomega.NewWithT(t)
+	a := &fakeProcessor{match: "text/a"}
+	b := &fakeProcessor{match: "text/b"}
+	c := &fakeProcessor{match: "text/c"}
+
+	// spare capacity in the caller's slice must not be shared either
+	ps := make([]processor.ResponseProcessor, 1, 10)
+	ps[0] = a
+	base := negotiator.New(ps...)
+	n1 := base.Append(b)
+	n2 := base.Append(c)
+
+	g.Expect(base.N()).To(gomega.Equal(1))
+	g.Expect(n1.Processor(1)).To(gomega.BeIdenticalTo(b))
+	g.Expect(n2.Processor(1)).To(gomega.BeIdenticalTo(c))
+}
+
+// Run with -race to check for data races.
+func Test_derived_negotiators_should_be_safe_for_concurrent_use(t *testing.T) {
+	negotiator.Printer = func(level byte, message string, data map[string]interface{}) {}
+	base := negotiator.New(&fakeProcessor{match: "text/a"})
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			match := fmt.Sprintf("text/x%d", i)
+			n := base.Append(&fakeProcessor{match: match}).WithDefaults()
+
+			req, _ := http.NewRequest("GET", "/", nil)
+			req.Header.Add("Accept", match)
+			recorder := httptest.NewRecorder()
+			err := n.Negotiate(recorder, req, negotiator.Offer{Data: "foo", MediaType: match})
+
+			if err != nil || recorder.Body.String() != match+" | foo" {
+				t.Errorf("%d: %v %q", i, err, recorder.Body.String())
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
 //-------------------------------------------------------------------------------------------------
 
 func Test_should_unpack_lazy_data(t *testing.T) {
@@ -303,6 +356,91 @@ func Test_should_match_language_wildcard_and_send_content_language_header(t *tes
 	g.Expect(recorder.Body.String()).To(gomega.Equal("text/test | foo"))
 }
 
+func Test_should_match_language_subtags(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.TXT())
+
+	cases := []struct {
+		acceptLanguage string
+		offers         []string
+		expected       string
+	}{
+		// offer is more specific than the accepted range
+		{acceptLanguage: "zh-Hans;q=1, zh-Hant;q=0.5", offers: []string{"zh-Hans-CN", "zh-Hant-TW"}, expected: "zh-Hans-CN"},
+		{acceptLanguage: "zh-Hant", offers: []string{"zh-Hans-CN", "zh-Hant-TW"}, expected: "zh-Hant-TW"},
+		{acceptLanguage: "sr-Latn", offers: []string{"sr-Cyrl-RS", "sr-Latn-RS"}, expected: "sr-Latn-RS"},
+		{acceptLanguage: "zh", offers: []string{"zh-Hant-TW"}, expected: "zh-Hant-TW"},
+
+		// accepted range is more specific than the offer
+		{acceptLanguage: "zh-Hans-CN", offers: []string{"zh-Hant", "zh-Hans"}, expected: "zh-Hans"},
+		{acceptLanguage: "en-GB", offers: []string{"en"}, expected: "en"},
+
+		// case is not significant
+		{acceptLanguage: "ZH-HANS-cn", offers: []string{"zh-Hans-CN"}, expected: "zh-Hans-CN"},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Add("Accept-Language", c.acceptLanguage)
+		recorder := httptest.NewRecorder()
+
+		var offers []negotiator.Offer
+		for _, lang := range c.offers {
+			offers = append(offers, negotiator.Offer{Data: lang, MediaType: "text/plain", Language: lang})
+		}
+
+		err := n.Negotiate(recorder, req, offers...)
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK), c.acceptLanguage)
+		g.Expect(recorder.Header().Get("Content-Language")).To(gomega.Equal(c.expected), c.acceptLanguage)
+	}
+}
+
+// A script mismatch is never a match, even when the primary subtag agrees.
+func Test_should_not_match_language_with_different_script(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.TXT())
+
+	cases := []struct {
+		acceptLanguage string
+		offers         []string
+		expected       string
+	}{
+		{acceptLanguage: "zh-Hans", offers: []string{"zh-Hant-TW", "en"}, expected: ""},
+		{acceptLanguage: "zh-Hans, en;q=0.5", offers: []string{"zh-Hant-TW", "en"}, expected: "en"},
+		{acceptLanguage: "zh-Hans-TW, en;q=0.5", offers: []string{"zh-Hant-TW", "en"}, expected: "en"},
+		{acceptLanguage: "sr-Cyrl, en;q=0.5", offers: []string{"sr-Latn", "en"}, expected: "en"},
+		// Subtags are compared by position (RFC 4647 basic filtering), so "zh-CN" does not match
+		// "zh-Hans-CN": the second subtag is a region in one and a script in the other. Skipping
+		// over subtags would be extended filtering, which is requested only via wildcards.
+		{acceptLanguage: "zh-CN, en;q=0.5", offers: []string{"zh-Hans-CN", "en"}, expected: "en"},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Add("Accept-Language", c.acceptLanguage)
+		recorder := httptest.NewRecorder()
+
+		var offers []negotiator.Offer
+		for _, lang := range c.offers {
+			offers = append(offers, negotiator.Offer{Data: lang, MediaType: "text/plain", Language: lang})
+		}
+
+		err := n.Negotiate(recorder, req, offers...)
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		if c.expected == "" {
+			g.Expect(recorder.Code).To(gomega.Equal(http.StatusNotAcceptable), c.acceptLanguage)
+		} else {
+			g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK), c.acceptLanguage)
+		}
+		g.Expect(recorder.Header().Get("Content-Language")).To(gomega.Equal(c.expected), c.acceptLanguage)
+	}
+}
+
 func Test_should_negotiate_a_default_processor(t *testing.T) {
 	g := gomega.NewWithT(t)
 	testLogger(t)
@@ -367,37 +505,2641 @@ func Test_should_negotiate_and_then_return_error(t *testing.T) {
 	g.Expect(err).To(gomega.HaveOccurred())
 }
 
-//-------------------------------------------------------------------------------------------------
+func Test_should_set_content_disposition_for_downloads(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New().WithDefaults()
 
-type fakeProcessor struct {
-	match string
-	err   error
+	cases := []struct {
+		filename, expected string
+	}{
+		{"report.csv", `attachment; filename="report.csv"`},
+		{`my "big" report.csv`, `attachment; filename="my \"big\" report.csv"`},
+		{"résumé.csv", `attachment; filename="r_sum_.csv"; filename*=UTF-8''r%C3%A9sum%C3%A9.csv`},
+		{"naïve (1).csv", `attachment; filename="na_ve (1).csv"; filename*=UTF-8''na%C3%AFve%20%281%29.csv`},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Add("Accept", "text/csv")
+
+		recorder := httptest.NewRecorder()
+		err := n.Negotiate(recorder, req, negotiator.Offer{Data: []string{"a", "b"}, MediaType: "text/csv", Filename: c.filename})
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK))
+		g.Expect(recorder.Header().Get("Content-Disposition")).To(gomega.Equal(c.expected))
+		g.Expect(recorder.Body.String()).To(gomega.Equal("a,b\n"))
+	}
 }
 
-func (p *fakeProcessor) ContentType() string {
-	return p.match
+func Test_should_ignore_filename_for_non_downloads(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New().WithDefaults()
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Add("Accept", "application/json")
+
+	recorder := httptest.NewRecorder()
+	err := n.Negotiate(recorder, req, negotiator.Offer{Data: []string{"a", "b"}, MediaType: "application/json", Filename: "report.json"})
+
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK))
+	g.Expect(recorder.Header().Get("Content-Disposition")).To(gomega.Equal(""))
 }
 
-func (p *fakeProcessor) CanProcess(mediaRange string, lang string) bool {
-	return mediaRange == p.match && (lang == "*" || lang == "en")
+// The single-offer fast path must give the same outcome as the general algorithm,
+// which is used here because "*/*;q=1" is not recognised by the fast path.
+func Test_single_offer_fast_path_should_match_general_algorithm(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New().WithDefaults()
+
+	cases := []negotiator.Offer{
+		{Data: "foo"},
+		{Data: "foo", Language: "en"},
+		{Data: "foo", MediaType: "text/csv"},
+		{Data: "foo", MediaType: "text/*"},
+		{Data: "foo", MediaType: "image/png"},
+		{Data: nil, MediaType: "application/json"},
+	}
+
+	for _, c := range cases {
+		fast := httptest.NewRecorder()
+		req1, _ := http.NewRequest("GET", "/", nil)
+		err1 := n.Negotiate(fast, req1, c)
+
+		general := httptest.NewRecorder()
+		req2, _ := http.NewRequest("GET", "/", nil)
+		req2.Header.Add("Accept", "*/*;q=1")
+		err2 := n.Negotiate(general, req2, c)
+
+		g.Expect(err1).NotTo(gomega.HaveOccurred())
+		g.Expect(err2).NotTo(gomega.HaveOccurred())
+		g.Expect(fast.Code).To(gomega.Equal(general.Code), "%+v", c)
+		g.Expect(fast.Header()).To(gomega.Equal(general.Header()), "%+v", c)
+		g.Expect(fast.Body.String()).To(gomega.Equal(general.Body.String()), "%+v", c)
+	}
 }
 
-func (p *fakeProcessor) Process(w http.ResponseWriter, _ string, data interface{}) error {
-	if p.err != nil {
-		return p.err
+func Test_single_offer_fast_path_should_allocate_less_than_general_algorithm(t *testing.T) {
+	g := gomega.NewWithT(t)
+	negotiator.Printer = func(level byte, message string, data map[string]interface{}) {}
+	n := negotiator.New().WithDefaults()
+	offer := negotiator.Offer{Data: &User{Name: "Joe Bloggs"}}
+
+	req1, _ := http.NewRequest("GET", "/", nil)
+	fast := testing.AllocsPerRun(100, func() { n.Render(req1, offer) })
+
+	req2, _ := http.NewRequest("GET", "/", nil)
+	req2.Header.Add("Accept", "*/*;q=1")
+	general := testing.AllocsPerRun(100, func() { n.Render(req2, offer) })
+
+	g.Expect(fast).To(gomega.BeNumerically("<", general))
+}
+
+func BenchmarkRender_singleOffer_fastPath(b *testing.B) {
+	benchmarkRenderSingleOffer(b, "")
+}
+
+func BenchmarkRender_singleOffer_generalPath(b *testing.B) {
+	benchmarkRenderSingleOffer(b, "*/*;q=1")
+}
+
+func benchmarkRenderSingleOffer(b *testing.B, accept string) {
+	n := negotiator.New().WithDefaults()
+	req, _ := http.NewRequest("GET", "/", nil)
+	if accept != "" {
+		req.Header.Add("Accept", accept)
+	}
+	offer := negotiator.Offer{Data: &User{Name: "Joe Bloggs"}}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		n.Render(req, offer)
 	}
-	_, err := w.Write([]byte(fmt.Sprintf("%s | %v", p.match, data)))
-	return err
 }
 
-func testLogger(t *testing.T) {
-	negotiator.Printer = func(level byte, message string, data map[string]interface{}) {
-		buf := &strings.Builder{}
-		fmt.Fprintf(buf, "%c: %s", level, message)
-		for k, v := range data {
-			fmt.Fprintf(buf, ", %q: %v", k, v)
+func Test_prepared_negotiation_should_match_render(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New().WithDefaults().WithDedupOffers()
+	offers := []negotiator.Offer{
+		{MediaType: "application/json", Data: "json"},
+		{MediaType: "application/json", Data: "duplicate"},
+		{MediaType: "text/csv", Data: [][]string{{"a", "b"}}},
+		{Language: "fr", Data: "fr"},
+		{Data: "blank"},
+	}
+	prepared := n.Prepare(offers...)
+
+	g.Expect(prepared.Offers()).To(gomega.HaveLen(4))
+	g.Expect(prepared.Offers()[3].MediaType).To(gomega.Equal("*/*"))
+	g.Expect(prepared.Offers()[3].Language).To(gomega.Equal("*"))
+
+	for _, accept := range []string{"", "*/*", "application/json", "text/csv", "text/plain", "image/png", "text/*;q=0"} {
+		for _, lang := range []string{"", "fr", "de"} {
+			req, _ := http.NewRequest("GET", "/", nil)
+			req.Header.Set(negotiator.Accept, accept)
+			req.Header.Set(negotiator.AcceptLanguage, lang)
+
+			direct := httptest.NewRecorder()
+			err1 := n.Negotiate(direct, req, offers...)
+
+			viaPrepared := httptest.NewRecorder()
+			err2 := prepared.Negotiate(viaPrepared, req)
+
+			g.Expect(err1).NotTo(gomega.HaveOccurred())
+			g.Expect(err2).NotTo(gomega.HaveOccurred())
+			g.Expect(viaPrepared.Code).To(gomega.Equal(direct.Code), "%s %s", accept, lang)
+			g.Expect(viaPrepared.Header()).To(gomega.Equal(direct.Header()), "%s %s", accept, lang)
+			g.Expect(viaPrepared.Body.String()).To(gomega.Equal(direct.Body.String()), "%s %s", accept, lang)
+		}
+	}
+}
+
+func Test_prepared_negotiation_should_allocate_less_than_render(t *testing.T) {
+	g := gomega.NewWithT(t)
+	negotiator.Printer = func(level byte, message string, data map[string]interface{}) {}
+	n := negotiator.New().WithDefaults()
+	offers := []negotiator.Offer{{MediaType: "application/xml", Data: "xml"}, {Data: "any"}}
+	prepared := n.Prepare(offers...)
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Add("Accept", "application/json")
+
+	direct := testing.AllocsPerRun(100, func() { n.Render(req, offers...) })
+	viaPrepared := testing.AllocsPerRun(100, func() { prepared.Render(req) })
+
+	g.Expect(viaPrepared).To(gomega.BeNumerically("<", direct))
+}
+
+func BenchmarkRender_perRequestOffers(b *testing.B) {
+	n, offers, req := benchmarkPreparedSetup()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		n.Render(req, offers...)
+	}
+}
+
+func BenchmarkRender_preparedOffers(b *testing.B) {
+	n, offers, req := benchmarkPreparedSetup()
+	prepared := n.Prepare(offers...)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		prepared.Render(req)
+	}
+}
+
+func benchmarkPreparedSetup() (*negotiator.Negotiator, []negotiator.Offer, *http.Request) {
+	negotiator.Printer = func(level byte, message string, data map[string]interface{}) {}
+	n := negotiator.New().WithDefaults()
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Add("Accept", "text/csv;q=0.9, application/json")
+	req.Header.Add("Accept-Language", "en-GB, en;q=0.8")
+	offers := []negotiator.Offer{
+		{MediaType: "application/xml", Data: &User{Name: "Joe Bloggs"}},
+		{MediaType: "text/csv", Data: [][]string{{"Joe Bloggs"}}},
+		{Data: &User{Name: "Joe Bloggs"}},
+	}
+	return n, offers, req
+}
+
+func Test_should_echo_structured_suffix_media_type(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	cases := []struct {
+		n        *negotiator.Negotiator
+		expected string
+	}{
+		{negotiator.New().WithDefaults(), "application/geo+json; charset=utf-8"},
+		{negotiator.New(processor.JSON().(processor.EchoSettable).WithEcho(false)), "application/json; charset=utf-8"},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Add("Accept", "application/geo+json")
+		recorder := httptest.NewRecorder()
+
+		err := c.n.Negotiate(recorder, req, negotiator.Offer{Data: []int{1}})
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK))
+		g.Expect(recorder.Header().Get("Content-Type")).To(gomega.Equal(c.expected))
+		g.Expect(recorder.Body.String()).To(gomega.Equal("[1]\n"))
+	}
+}
+
+func Test_should_return_400_for_malformed_accept_header_when_strict(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New().WithDefaults().WithStrictAcceptParsing()
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Add("Accept", "application")
+	recorder := httptest.NewRecorder()
+
+	err := n.Negotiate(recorder, req, negotiator.Offer{Data: "foo"})
+
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusBadRequest))
+	g.Expect(recorder.Body.String()).To(gomega.ContainSubstring("application"))
+}
+
+func Test_should_accept_valid_accept_header_when_strict(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New().WithDefaults().WithStrictAcceptParsing()
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Add("Accept", "text/plain, */*;q=0.1")
+	recorder := httptest.NewRecorder()
+
+	err := n.Negotiate(recorder, req, negotiator.Offer{Data: "foo", MediaType: "text/plain"})
+
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK))
+	g.Expect(recorder.Body.String()).To(gomega.Equal("foo\n"))
+}
+
+func Test_should_match_charset_in_accept_header(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New().WithDefaults()
+
+	cases := []struct {
+		n           *negotiator.Negotiator
+		accept      string
+		code        int
+		contentType string
+	}{
+		{n, "application/json; charset=utf-8", http.StatusOK, "application/json; charset=utf-8"},
+		{n, "application/json; charset=UTF-8", http.StatusOK, "application/json; charset=utf-8"},
+		{n, "application/json; charset=utf-16", http.StatusOK, "application/json; charset=utf-8"},
+		{n.WithStrictAcceptParsing(), "application/json; charset=utf-8", http.StatusOK, "application/json; charset=utf-8"},
+		{n.WithStrictAcceptParsing(), "application/json; charset=\"UTF-8\"", http.StatusOK, "application/json; charset=utf-8"},
+		{n.WithStrictAcceptParsing(), "application/json; charset=utf-16", http.StatusNotAcceptable, ""},
+		{n.WithStrictAcceptParsing(), "application/json; charset=utf-16, text/plain", http.StatusOK, "text/plain; charset=utf-8"},
+	}
+
+	for i, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set(negotiator.Accept, c.accept)
+		recorder := httptest.NewRecorder()
+
+		err := c.n.Negotiate(recorder, req,
+			negotiator.Of("foo").As("application/json"),
+			negotiator.Of("foo").As("text/plain"))
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Code).To(gomega.Equal(c.code), "%d", i)
+		if c.code == http.StatusOK {
+			g.Expect(recorder.Header().Get("Content-Type")).To(gomega.Equal(c.contentType), "%d", i)
+		}
+	}
+}
+
+func Test_should_give_charset_mismatch_reason_for_conflicting_charset_in_accept_header(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New().WithDefaults().WithStrictAcceptParsing()
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set(negotiator.Accept, "application/json; charset=iso-8859-1")
+
+	cr, reason := n.RenderResult(req, negotiator.Of("foo").As("application/json"))
+
+	g.Expect(cr.StatusCode()).To(gomega.Equal(http.StatusNotAcceptable))
+	g.Expect(reason.Cause).To(gomega.Equal(negotiator.CharsetMismatch))
+}
+
+func Test_should_not_return_400_for_malformed_accept_header_by_default(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New().WithDefaults()
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Add("Accept", "application")
+	recorder := httptest.NewRecorder()
+
+	err := n.Negotiate(recorder, req, negotiator.Offer{Data: "foo", MediaType: "text/plain"})
+
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusNotAcceptable))
+}
+
+func Test_should_get_prefer_return(t *testing.T) {
+	g := gomega.NewWithT(t)
+	cases := []struct {
+		prefer   []string
+		expected string
+	}{
+		{prefer: nil, expected: ""},
+		{prefer: []string{"return=minimal"}, expected: "minimal"},
+		{prefer: []string{"respond-async, Return = \"representation\""}, expected: "representation"},
+		{prefer: []string{"wait=10", "return=minimal; foo=bar"}, expected: "minimal"},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		for _, p := range c.prefer {
+			req.Header.Add("Prefer", p)
+		}
+		g.Expect(negotiator.PreferReturn(req)).To(gomega.Equal(c.expected))
+	}
+}
+
+func Test_should_pass_preference_to_data_provider(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New().WithDefaults()
+
+	fn := func(pref, lang string) (interface{}, bool) {
+		switch pref {
+		case "minimal":
+			return lang, true
+		case "representation":
+			return pref + " " + lang, true
+		}
+		return pref + " " + lang, false
+	}
+
+	cases := []struct {
+		prefer, expectedBody, expectedApplied string
+	}{
+		{prefer: "return=minimal", expectedBody: "en\n", expectedApplied: "return=minimal"},
+		{prefer: "return=representation", expectedBody: "representation en\n", expectedApplied: "return=representation"},
+		{prefer: "return=unknown", expectedBody: "unknown en\n", expectedApplied: ""},
+		{prefer: "", expectedBody: " en\n", expectedApplied: ""},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		if c.prefer != "" {
+			req.Header.Add("Prefer", c.prefer)
 		}
-		t.Logf(buf.String())
+		recorder := httptest.NewRecorder()
+
+		err := n.Negotiate(recorder, req, negotiator.Offer{Data: fn, MediaType: "text/plain", Language: "en"})
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK))
+		g.Expect(recorder.Body.String()).To(gomega.Equal(c.expectedBody))
+		g.Expect(recorder.Header().Get("Preference-Applied")).To(gomega.Equal(c.expectedApplied))
+		g.Expect(recorder.Header().Values("Vary")).To(gomega.ContainElement("Prefer"), c.prefer)
+	}
+}
+
+func Test_should_not_set_preference_applied_for_other_data(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New().WithDefaults()
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Add("Prefer", "return=minimal")
+	recorder := httptest.NewRecorder()
+
+	err := n.Negotiate(recorder, req, negotiator.Offer{Data: "foo"})
+
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(recorder.Header().Get("Preference-Applied")).To(gomega.Equal(""))
+	g.Expect(recorder.Header().Values("Vary")).NotTo(gomega.ContainElement("Prefer"))
+}
+
+func Test_should_list_available_types_when_not_acceptable(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New().WithDefaults()
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Add("Accept", "image/png")
+	recorder := httptest.NewRecorder()
+
+	err := n.Negotiate(recorder, req,
+		negotiator.Offer{Data: "a", MediaType: "application/json"},
+		negotiator.Offer{Data: "b", MediaType: "application/xml"},
+		negotiator.Offer{Data: "c", MediaType: "application/json", Language: "fr"},
+	)
+
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusNotAcceptable))
+	g.Expect(recorder.Header().Get("X-Available-Types")).To(gomega.Equal("application/json, application/xml"))
+}
+
+func Test_should_list_processor_types_for_wildcard_offers_when_not_acceptable(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New().WithDefaults()
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Add("Accept-Language", "de")
+	recorder := httptest.NewRecorder()
+
+	err := n.Negotiate(recorder, req, negotiator.Offer{Data: "a", Language: "en"})
+
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusNotAcceptable))
+	g.Expect(recorder.Header().Get("X-Available-Types")).To(gomega.Equal("application/json, application/xml, text/csv, text/plain"))
+}
+
+func Test_should_not_list_available_types_when_disabled(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New().WithDefaults().WithoutAvailableTypes()
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Add("Accept", "image/png")
+	recorder := httptest.NewRecorder()
+
+	err := n.Negotiate(recorder, req, negotiator.Offer{Data: "a", MediaType: "application/json"})
+
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusNotAcceptable))
+	g.Expect(recorder.Header()).NotTo(gomega.HaveKey("X-Available-Types"))
+}
+
+func Test_should_serve_static_content_for_negotiated_language(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	pages := map[string][]byte{"en": []byte("Hello"), "fr": []byte("Bonjour")}
+	n := negotiator.New(processor.Static("text/html", pages))
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Add("Accept", "text/html")
+	req.Header.Add("Accept-Language", "fr, en;q=0.5")
+	recorder := httptest.NewRecorder()
+
+	err := n.Negotiate(recorder, req,
+		negotiator.Offer{Data: true, MediaType: "text/html", Language: "fr"},
+		negotiator.Offer{Data: true, MediaType: "text/html", Language: "en"},
+	)
+
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK))
+	g.Expect(recorder.Header().Get("Content-Language")).To(gomega.Equal("fr"))
+	g.Expect(recorder.Body.String()).To(gomega.Equal("Bonjour"))
+}
+
+func Test_should_use_error_handler_func_with_request_and_offers(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	var gotPath string
+	var gotOffers []negotiator.Offer
+	var gotCode int
+	plain := func(w http.ResponseWriter, error string, code int) {
+		t.Errorf("unexpected call to plain error handler")
+	}
+	n := negotiator.New(processor.JSON()).
+		WithErrorHandler(plain).
+		WithErrorHandlerFunc(func(w http.ResponseWriter, req *http.Request, offers []negotiator.Offer, code int) {
+			gotPath = req.URL.Path
+			gotOffers = offers
+			gotCode = code
+			w.WriteHeader(code)
+		})
+
+	req, _ := http.NewRequest("GET", "/foo", nil)
+	req.Header.Add("Accept", "image/png")
+	recorder := httptest.NewRecorder()
+
+	err := n.Negotiate(recorder, req, negotiator.Offer{Data: "x", MediaType: "application/json"})
+
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusNotAcceptable))
+	g.Expect(gotPath).To(gomega.Equal("/foo"))
+	g.Expect(gotOffers).To(gomega.HaveLen(1))
+	g.Expect(gotOffers[0].MediaType).To(gomega.Equal("application/json"))
+	g.Expect(gotCode).To(gomega.Equal(http.StatusNotAcceptable))
+}
+
+func Test_should_negotiate_charset_per_RFC7231(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	cases := []struct {
+		acceptCharset string
+		expected      int
+	}{
+		{"", http.StatusOK},
+		{"utf-8", http.StatusOK},
+		{"UTF-8;q=0.5", http.StatusOK},
+		// the example from RFC 7231 section 5.3.3 does not include utf-8
+		{"iso-8859-5, unicode-1-1;q=0.8", http.StatusNotAcceptable},
+		{"iso-8859-5, unicode-1-1;q=0.8, *;q=0.5", http.StatusOK},
+		{"iso-8859-1;q=0", http.StatusNotAcceptable},
+		{"iso-8859-1;q=0, *", http.StatusOK},
+		{"utf-8;q=0, *", http.StatusNotAcceptable},
+		{"*;q=0", http.StatusNotAcceptable},
+		{"*;q=0, utf-8", http.StatusOK},
+		{" UTF-8 ; q = 0.5 ", http.StatusOK},
+		{"Utf-8;Q=0, *", http.StatusNotAcceptable},
+	}
+
+	n := negotiator.New(processor.JSON())
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Add("Accept", "application/json")
+		if c.acceptCharset != "" {
+			req.Header.Add("Accept-Charset", c.acceptCharset)
+		}
+		recorder := httptest.NewRecorder()
+
+		err := n.Negotiate(recorder, req, negotiator.Offer{Data: "x", MediaType: "application/json"})
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Code).To(gomega.Equal(c.expected), c.acceptCharset)
+	}
+}
+
+func Test_should_choose_processor_with_acceptable_charset(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	latin1 := processor.TXT().(processor.ContentTypeSettable).WithContentType("text/plain; charset=iso-8859-1")
+	n := negotiator.New(processor.TXT(), latin1)
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Add("Accept", "text/plain")
+	req.Header.Add("Accept-Charset", "iso-8859-1, *;q=0")
+	recorder := httptest.NewRecorder()
+
+	err := n.Negotiate(recorder, req, negotiator.Offer{Data: "x", MediaType: "text/plain"})
+
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK))
+	g.Expect(recorder.Header().Get("Content-Type")).To(gomega.Equal("text/plain; charset=iso-8859-1"))
+}
+
+func Test_clone_should_be_independent_of_the_original(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	var calls []string
+	handler := func(name string) negotiator.ErrorHandler {
+		return func(w http.ResponseWriter, error string, code int) {
+			calls = append(calls, name)
+		}
+	}
+
+	original := negotiator.New(processor.JSON()).WithErrorHandler(handler("original"))
+	clone := original.Clone()
+	g.Expect(clone).NotTo(gomega.BeIdenticalTo(original))
+	g.Expect(clone.N()).To(gomega.Equal(1))
+
+	extended := clone.Append(processor.XML()).WithErrorHandler(handler("extended"))
+
+	g.Expect(original.N()).To(gomega.Equal(1))
+	g.Expect(clone.N()).To(gomega.Equal(1))
+	g.Expect(extended.N()).To(gomega.Equal(2))
+
+	for _, n := range []*negotiator.Negotiator{original, clone, extended} {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Add("Accept", "image/png")
+		n.Negotiate(httptest.NewRecorder(), req, negotiator.Offer{Data: "x", MediaType: "application/json"})
+	}
+
+	g.Expect(calls).To(gomega.Equal([]string{"original", "original", "extended"}))
+}
+
+func Test_with_should_use_only_the_given_processors_and_leave_the_original_unchanged(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	base := negotiator.New().WithDefaults()
+	offers := []negotiator.Offer{
+		negotiator.Of("x").As("application/json"),
+		negotiator.Of("x").As("application/xml"),
+	}
+
+	xmlOnly := base.With(processor.XML())
+
+	g.Expect(xmlOnly.N()).To(gomega.Equal(1))
+	g.Expect(base.N()).To(gomega.Equal(4))
+
+	cases := []struct {
+		n           *negotiator.Negotiator
+		accept      string
+		code        int
+		contentType string
+	}{
+		{xmlOnly, "application/json, application/xml;q=0.5", http.StatusOK, "application/xml; charset=utf-8"},
+		{xmlOnly, "application/json", http.StatusNotAcceptable, ""},
+		{base, "application/json, application/xml;q=0.5", http.StatusOK, "application/json; charset=utf-8"},
+		{base, "application/json", http.StatusOK, "application/json; charset=utf-8"},
+	}
+
+	for i, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Add("Accept", c.accept)
+
+		cr := c.n.Render(req, offers...)
+
+		g.Expect(cr.StatusCode()).To(gomega.Equal(c.code), "%d", i)
+		if c.code == http.StatusOK {
+			recorder := httptest.NewRecorder()
+			cr.WriteContentType(recorder)
+			g.Expect(recorder.Header().Get("Content-Type")).To(gomega.Equal(c.contentType), "%d", i)
+		}
+	}
+}
+
+func Test_should_render_error_template_when_client_prefers_html(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	tpl := template.Must(template.New("error").Parse(`<h1>{{.StatusCode}} {{.Status}}</h1><p>{{.Message}}</p>`))
+	n := negotiator.New(processor.JSON()).WithErrorTemplate(tpl)
+
+	cases := []struct {
+		accept, contentType, body string
+	}{
+		{"text/html, application/xml;q=0.9", "text/html; charset=utf-8",
+			"<h1>406 Not Acceptable</h1><p>the accepted formats are not offered by the server</p>"},
+		{"image/png", "text/plain; charset=utf-8",
+			"the accepted formats are not offered by the server\n"},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Add("Accept", c.accept)
+		recorder := httptest.NewRecorder()
+
+		err := n.Negotiate(recorder, req, negotiator.Offer{Data: "x", MediaType: "application/json"})
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Code).To(gomega.Equal(http.StatusNotAcceptable))
+		g.Expect(recorder.Header().Get("Content-Type")).To(gomega.Equal(c.contentType), c.accept)
+		g.Expect(recorder.Body.String()).To(gomega.Equal(c.body), c.accept)
+	}
+}
+
+func Test_should_prefer_default_subtype_for_wildcard_accept(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	cases := []struct {
+		n        *negotiator.Negotiator
+		accept   string
+		expected string
+	}{
+		{negotiator.New().WithDefaults(), "application/*", "application/xml; charset=utf-8"},
+		{negotiator.New().WithDefaults().WithDefaultSubtypes("application/json"), "application/*", "application/json; charset=utf-8"},
+		{negotiator.New().WithDefaults().WithDefaultSubtypes("application/json"), "*/*", "application/json; charset=utf-8"},
+		{negotiator.New().WithDefaults().WithDefaultSubtypes("application/json"), "application/xml", "application/xml; charset=utf-8"},
+		{negotiator.New().WithDefaults().WithDefaultSubtypes("text/plain", "application/json"), "text/*, application/*", "text/plain; charset=utf-8"},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Add("Accept", c.accept)
+		recorder := httptest.NewRecorder()
+
+		err := c.n.Negotiate(recorder, req,
+			negotiator.Offer{Data: "x", MediaType: "application/xml"},
+			negotiator.Offer{Data: "x", MediaType: "text/csv"},
+			negotiator.Offer{Data: "x", MediaType: "application/json"},
+			negotiator.Offer{Data: "x", MediaType: "text/plain"},
+		)
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK))
+		g.Expect(recorder.Header().Get("Content-Type")).To(gomega.Equal(c.expected), c.accept)
+	}
+}
+
+func Test_should_match_media_types_ignoring_case_and_whitespace(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	cases := []struct {
+		accept, offered string
+	}{
+		{"Application/JSON", "application/json"},
+		{"application/json ", "application/json"},
+		{" APPLICATION/Json ;q=0.9, text/plain;q=0.1", "application/json"},
+		{"application/json", "Application/JSON"},
+		{"application/*", " application/JSON "},
+		{"application/vnd.Foo+JSON", "application/vnd.foo+json"},
+	}
+
+	n := negotiator.New(processor.TXT(), processor.JSON())
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Add("Accept", c.accept)
+		recorder := httptest.NewRecorder()
+
+		err := n.Negotiate(recorder, req,
+			negotiator.Offer{Data: "x", MediaType: "image/png"},
+			negotiator.Offer{Data: "x", MediaType: c.offered},
+		)
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK), c.accept)
+		g.Expect(recorder.Body.String()).To(gomega.Equal("\"x\"\n"), c.accept)
+	}
+}
+
+func Test_should_use_offered_content_type_with_shared_processor(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.JSON())
+
+	cases := []struct {
+		offer    negotiator.Offer
+		expected string
+	}{
+		{negotiator.Of("x").As("application/json").WithContentType("application/vnd.myco.user+json"), "application/vnd.myco.user+json"},
+		{negotiator.Of("x").As("application/json"), "application/json; charset=utf-8"},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Add("Accept", "application/json")
+		recorder := httptest.NewRecorder()
+
+		err := n.Negotiate(recorder, req, c.offer)
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK))
+		g.Expect(recorder.Header().Get("Content-Type")).To(gomega.Equal(c.expected))
+		g.Expect(recorder.Body.String()).To(gomega.Equal("\"x\"\n"))
+	}
+}
+
+func Test_render_values_should_negotiate_without_a_request(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.JSON(), processor.XML())
+	offers := []negotiator.Offer{
+		{Data: "x", MediaType: "application/xml", Language: "en"},
+		{Data: "y", MediaType: "application/json", Language: "fr"},
+	}
+
+	cases := []struct {
+		accept, acceptLanguage string
+		ajax                   bool
+		code                   int
+		contentType            string
+	}{
+		{"application/xml", "", false, http.StatusOK, "application/xml; charset=utf-8"},
+		{"application/*", "fr", false, http.StatusOK, "application/json; charset=utf-8"},
+		{"text/xml", "", true, http.StatusOK, "application/json; charset=utf-8"},
+		{"image/png", "", false, http.StatusNotAcceptable, ""},
+	}
+
+	for _, c := range cases {
+		r := n.RenderValues(c.accept, c.acceptLanguage, c.ajax, offers...)
+		recorder := httptest.NewRecorder()
+		r.WriteContentType(recorder)
+
+		g.Expect(r.StatusCode()).To(gomega.Equal(c.code), c.accept)
+		g.Expect(recorder.Header().Get("Content-Type")).To(gomega.Equal(c.contentType), c.accept)
+	}
+}
+
+func Test_should_compress_using_negotiated_encoding(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.JSON()).WithEncoding(encoding.Gzip, encoding.Deflate)
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Add("Accept", "application/json")
+	req.Header.Add("Accept-Encoding", "deflate;q=0.5, gzip")
+	recorder := httptest.NewRecorder()
+
+	err := n.Negotiate(recorder, req, negotiator.Offer{Data: "hello", MediaType: "application/json"})
+
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK))
+	g.Expect(recorder.Header().Get("Content-Encoding")).To(gomega.Equal("gzip"))
+	g.Expect(recorder.Header().Get("Vary")).To(gomega.Equal("Accept-Encoding"))
+
+	r, err := gzip.NewReader(recorder.Body)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	body, err := ioutil.ReadAll(r)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(string(body)).To(gomega.Equal("\"hello\"\n"))
+}
+
+func Test_should_not_compress_without_acceptable_encoding(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.JSON()).WithEncoding(encoding.Gzip)
+
+	for _, acceptEncoding := range []string{"", "br", "gzip;q=0"} {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Add("Accept-Encoding", acceptEncoding)
+		recorder := httptest.NewRecorder()
+
+		err := n.Negotiate(recorder, req, negotiator.Offer{Data: "hello", MediaType: "application/json"})
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Header().Get("Content-Encoding")).To(gomega.Equal(""))
+		g.Expect(recorder.Header().Get("Vary")).To(gomega.Equal("Accept-Encoding"))
+		g.Expect(recorder.Body.String()).To(gomega.Equal("\"hello\"\n"))
+	}
+}
+
+func Test_should_consume_request_with_supported_content_type(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.JSON())
+
+	cases := []struct {
+		contentType string
+		expected    bool
+	}{
+		{"application/json", true},
+		{"Application/JSON; charset=utf-8", true},
+		{"application/vnd.foo+json", true},
+		{"text/csv", false},
+		{"", false},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("POST", "/", strings.NewReader("{}"))
+		req.Header.Set("Content-Type", c.contentType)
+		recorder := httptest.NewRecorder()
+
+		g.Expect(n.CanConsume(req)).To(gomega.Equal(c.expected), c.contentType)
+		g.Expect(n.RequireConsumable(recorder, req)).To(gomega.Equal(c.expected), c.contentType)
+
+		if c.expected {
+			g.Expect(recorder.Body.Len()).To(gomega.Equal(0))
+		} else {
+			g.Expect(recorder.Code).To(gomega.Equal(http.StatusUnsupportedMediaType))
+			g.Expect(recorder.Header().Get("Accept")).To(gomega.Equal("application/json"))
+		}
+	}
+}
+
+func Test_consumable_types_should_list_processor_media_types(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	n := negotiator.New(processor.JSON(), processor.JSON("  "), processor.CSV()).Append(processor.TXT())
+
+	g.Expect(n.ConsumableTypes()).To(gomega.Equal([]string{"application/json", "text/csv", "text/plain"}))
+}
+
+func Test_should_decode_request_with_supported_content_type(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.TXT(), processor.JSON(), processor.XML())
+
+	cases := []struct {
+		contentType, body string
+	}{
+		{"application/json", `{"Name":"Joe"}`},
+		{"Application/JSON; charset=utf-8", `{"Name":"Joe"}`},
+		{"application/vnd.foo+json", `{"Name":"Joe"}`},
+		{"application/xml", `<User><Name>Joe</Name></User>`},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("POST", "/", strings.NewReader(c.body))
+		req.Header.Set("Content-Type", c.contentType)
+
+		var user User
+		err := n.DecodeRequest(req, &user)
+
+		g.Expect(err).NotTo(gomega.HaveOccurred(), c.contentType)
+		g.Expect(user.Name).To(gomega.Equal("Joe"), c.contentType)
+	}
+}
+
+func Test_should_decode_request_with_next_processor_when_suffixed_processor_cannot_decode(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.Suffixed(processor.TXT(), "+json"), processor.JSON())
+
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(`{"Name":"Joe"}`))
+	req.Header.Set("Content-Type", "application/vnd.x+json")
+
+	var user User
+	err := n.DecodeRequest(req, &user)
+
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(user.Name).To(gomega.Equal("Joe"))
+}
+
+func Test_should_not_decode_request_with_unsupported_content_type(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.TXT(), processor.JSON())
+
+	for _, contentType := range []string{"text/plain", "text/csv", ""} {
+		req, _ := http.NewRequest("POST", "/", strings.NewReader("Joe"))
+		req.Header.Set("Content-Type", contentType)
+
+		var user User
+		err := n.DecodeRequest(req, &user)
+
+		g.Expect(err).To(gomega.HaveOccurred(), contentType)
+		var ume *negotiator.UnsupportedMediaTypeError
+		g.Expect(errors.As(err, &ume)).To(gomega.BeTrue(), contentType)
+		g.Expect(ume.ContentType).To(gomega.Equal(contentType))
+		g.Expect(ume.StatusCode()).To(gomega.Equal(http.StatusUnsupportedMediaType))
+	}
+}
+
+func Test_should_set_content_length_with_buffered_output(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	cases := []struct {
+		n              *negotiator.Negotiator
+		acceptEncoding string
+	}{
+		{negotiator.New(processor.JSON()).WithBufferedOutput(), ""},
+		{negotiator.New(processor.JSON()).WithBufferedOutput().WithEncoding(encoding.Gzip), "gzip"},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Add("Accept", "application/json")
+		req.Header.Add("Accept-Encoding", c.acceptEncoding)
+		recorder := httptest.NewRecorder()
+
+		err := c.n.Negotiate(recorder, req, negotiator.Offer{Data: []string{"hello", "world"}, MediaType: "application/json"})
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK))
+		g.Expect(recorder.Body.Len()).To(gomega.BeNumerically(">", 0))
+		g.Expect(recorder.Header().Get("Content-Length")).To(gomega.Equal(fmt.Sprint(recorder.Body.Len())))
+		g.Expect(recorder.Header().Get("Content-Encoding")).To(gomega.Equal(c.acceptEncoding))
+	}
+}
+
+func Test_should_give_500_when_buffered_output_fails(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.JSON()).WithBufferedOutput()
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Add("Accept", "application/json")
+	recorder := httptest.NewRecorder()
+
+	err := n.Negotiate(recorder, req, negotiator.Offer{Data: make(chan int), MediaType: "application/json"})
+
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusInternalServerError))
+	g.Expect(recorder.Header().Get("Content-Length")).To(gomega.Equal(""))
+	g.Expect(recorder.Body.Len()).To(gomega.Equal(0))
+}
+
+func Test_should_honour_wildcard_exclusions(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	cases := []struct {
+		accept      string
+		code        int
+		contentType string
+	}{
+		{"*/*;q=0", http.StatusNotAcceptable, ""},
+		{"application/*;q=0", http.StatusNotAcceptable, ""},
+		{"application/json, */*;q=0", http.StatusOK, "application/json; charset=utf-8"},
+		{"*/*;q=0, application/json", http.StatusOK, "application/json; charset=utf-8"},
+		{"application/xml;q=0.5, application/*;q=0", http.StatusOK, "application/xml; charset=utf-8"},
+		{"application/json;q=0, */*", http.StatusOK, "application/xml; charset=utf-8"},
+		{"text/*;q=0, */*", http.StatusOK, "application/json; charset=utf-8"},
+	}
+
+	n := negotiator.New(processor.JSON(), processor.XML())
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Add("Accept", c.accept)
+		recorder := httptest.NewRecorder()
+
+		err := n.Negotiate(recorder, req,
+			negotiator.Offer{Data: "x", MediaType: "application/json"},
+			negotiator.Offer{Data: "x", MediaType: "application/xml"},
+		)
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Code).To(gomega.Equal(c.code), c.accept)
+		if c.code == http.StatusOK {
+			g.Expect(recorder.Header().Get("Content-Type")).To(gomega.Equal(c.contentType), c.accept)
+		}
+	}
+}
+
+func Test_should_honour_wildcard_subtype_exclusions_by_specificity(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.TXT(), processor.JSON())
+
+	cases := []struct {
+		accept      string
+		offers      []negotiator.Offer
+		code        int
+		contentType string
+	}{
+		{"text/*;q=0, */*",
+			[]negotiator.Offer{negotiator.Of("x").As("text/plain"), negotiator.Of("x").As("application/json")},
+			http.StatusOK, "application/json; charset=utf-8"},
+		{"text/*;q=0",
+			[]negotiator.Offer{negotiator.Of("x").As("text/plain")},
+			http.StatusNotAcceptable, ""},
+		{"text/plain;q=1, text/*;q=0",
+			[]negotiator.Offer{negotiator.Of("x").As("text/plain")},
+			http.StatusOK, "text/plain; charset=utf-8"},
+		{"text/*;q=0, text/plain, application/json",
+			[]negotiator.Offer{negotiator.Of("x").As("text/plain"), negotiator.Of("x").As("application/json")},
+			http.StatusOK, "text/plain; charset=utf-8"},
+		// a zero-quality range with parameters only excludes offers with those parameters
+		{"text/plain;version=1;q=0, */*;q=0.5",
+			[]negotiator.Offer{negotiator.Of("x").As("text/plain")},
+			http.StatusOK, "text/plain; charset=utf-8"},
+		{"text/plain;version=1;q=0, text/plain",
+			[]negotiator.Offer{negotiator.Of("x").As("text/plain").WithMatchParams(map[string]string{"version": "1"})},
+			http.StatusNotAcceptable, ""},
+		// wildcard offers
+		{"text/*;q=0, application/json",
+			[]negotiator.Offer{negotiator.Of("x").As("text/*")},
+			http.StatusNotAcceptable, ""},
+		{"text/plain;q=0, text/*",
+			[]negotiator.Offer{negotiator.Of("x").As("text/*")},
+			http.StatusOK, "text/plain; charset=utf-8"},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Add("Accept", c.accept)
+
+		cr, reason := n.RenderResult(req, c.offers...)
+
+		g.Expect(cr.StatusCode()).To(gomega.Equal(c.code), c.accept)
+		if c.code == http.StatusOK {
+			recorder := httptest.NewRecorder()
+			cr.WriteContentType(recorder)
+			g.Expect(recorder.Header().Get("Content-Type")).To(gomega.Equal(c.contentType), c.accept)
+		} else {
+			g.Expect(reason.Cause).To(gomega.Equal(negotiator.AllExcluded), c.accept)
+		}
+	}
+}
+
+func Test_should_exclude_wildcard_offer_only_when_nothing_is_acceptable(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.JSON())
+
+	for accept, code := range map[string]int{"*/*;q=0": http.StatusNotAcceptable, "application/json, */*;q=0": http.StatusOK} {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Add("Accept", accept)
+		recorder := httptest.NewRecorder()
+
+		err := n.Negotiate(recorder, req, negotiator.Offer{Data: "x"}, negotiator.Offer{Data: "y", MediaType: "text/plain"})
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Code).To(gomega.Equal(code), accept)
+	}
+}
+
+func Test_processor_for_should_find_first_matching_processor(t *testing.T) {
+	g := gomega.NewWithT(t)
+	n := negotiator.New().WithDefaults()
+
+	p, ok := n.ProcessorFor("text/csv", "en")
+	g.Expect(ok).To(gomega.BeTrue())
+	g.Expect(p).To(gomega.BeIdenticalTo(n.Processor(2)))
+
+	p, ok = n.ProcessorFor("Application/Geo+JSON", "*")
+	g.Expect(ok).To(gomega.BeTrue())
+	g.Expect(p).To(gomega.BeIdenticalTo(n.Processor(0)))
+
+	p, ok = n.ProcessorFor("image/png", "*")
+	g.Expect(ok).To(gomega.BeFalse())
+	g.Expect(p).To(gomega.BeNil())
+}
+
+func Test_should_send_trace_events_to_configured_negotiator_only(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	var events []negotiator.TraceEvent
+	plain := negotiator.New(processor.JSON(), processor.XML())
+	traced := plain.WithTrace(func(event negotiator.TraceEvent) {
+		events = append(events, event)
+	})
+
+	offers := []negotiator.Offer{
+		{Data: "x", MediaType: "text/csv"},
+		{Data: "x", MediaType: "application/xml"},
+	}
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Add("Accept", "application/xml, text/csv;q=0")
+
+	plain.Negotiate(httptest.NewRecorder(), req, offers...)
+	g.Expect(events).To(gomega.BeEmpty())
+
+	traced.Negotiate(httptest.NewRecorder(), req, offers...)
+	g.Expect(events).To(gomega.HaveLen(3))
+	g.Expect(events[0].Decision).To(gomega.Equal(negotiator.Excluded))
+	g.Expect(events[0].Offer.MediaType).To(gomega.Equal("text/csv"))
+	g.Expect(events[1].Decision).To(gomega.Equal(negotiator.Compared))
+	g.Expect(events[2]).To(gomega.Equal(negotiator.TraceEvent{
+		Decision: negotiator.Matched,
+		Accepted: "application/xml",
+		Language: "*",
+		Offer:    negotiator.Offer{Data: "x", MediaType: "application/xml", Language: "*"},
+	}))
+
+	events = nil
+	req.Header.Set("Accept", "image/png")
+	traced.Negotiate(httptest.NewRecorder(), req, offers...)
+	g.Expect(events[len(events)-1]).To(gomega.Equal(negotiator.TraceEvent{
+		Decision: negotiator.Rejected,
+		Accepted: "image/png",
+		Language: "*",
+	}))
+}
+
+func Test_should_combine_repeated_accept_headers(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.JSON(), processor.XML())
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Add("Accept", "image/png")
+	req.Header.Add("Accept", "application/xml")
+	req.Header.Add("Accept-Language", "de")
+	req.Header.Add("Accept-Language", "fr;q=0.5")
+	recorder := httptest.NewRecorder()
+
+	err := n.Negotiate(recorder, req,
+		negotiator.Offer{Data: "x", MediaType: "application/json", Language: "fr"},
+		negotiator.Offer{Data: "x", MediaType: "application/xml", Language: "fr"},
+	)
+
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK))
+	g.Expect(recorder.Header().Get("Content-Type")).To(gomega.Equal("application/xml; charset=utf-8"))
+	g.Expect(recorder.Header().Get("Content-Language")).To(gomega.Equal("fr"))
+}
+
+func Test_should_negotiate_accept_datetime(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	jan := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	feb := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	mar := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	offers := []negotiator.Offer{
+		negotiator.Of("jan").As("text/plain").At(jan),
+		negotiator.Of("mar").As("text/plain").At(mar),
+		negotiator.Of("feb-json").As("application/json").At(feb),
+		negotiator.Of("feb").As("text/plain").At(feb),
+	}
+
+	cases := []struct {
+		acceptDatetime string
+		code           int
+		body           string
+		memento        string
+	}{
+		{"Sat, 15 Feb 2020 12:00:00 GMT", http.StatusOK, "feb\n", "Sat, 01 Feb 2020 00:00:00 GMT"},
+		{"Sun, 01 Mar 2020 00:00:00 GMT", http.StatusOK, "mar\n", "Sun, 01 Mar 2020 00:00:00 GMT"},
+		{"Fri, 01 Jan 2010 00:00:00 GMT", http.StatusOK, "jan\n", "Wed, 01 Jan 2020 00:00:00 GMT"},
+		{"", http.StatusOK, "jan\n", "Wed, 01 Jan 2020 00:00:00 GMT"},
+		{"yesterday", http.StatusBadRequest, "", ""},
+	}
+
+	n := negotiator.New(processor.JSON(), processor.TXT()).WithDatetimeNegotiation()
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Add("Accept", "text/plain")
+		if c.acceptDatetime != "" {
+			req.Header.Add("Accept-Datetime", c.acceptDatetime)
+		}
+		recorder := httptest.NewRecorder()
+
+		err := n.Negotiate(recorder, req, offers...)
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Code).To(gomega.Equal(c.code), c.acceptDatetime)
+		if c.code == http.StatusOK {
+			g.Expect(recorder.Body.String()).To(gomega.Equal(c.body), c.acceptDatetime)
+			g.Expect(recorder.Header().Get("Memento-Datetime")).To(gomega.Equal(c.memento), c.acceptDatetime)
+			g.Expect(recorder.Header().Get("Vary")).To(gomega.Equal("Accept-Datetime"), c.acceptDatetime)
+		}
+	}
+}
+
+func Test_should_ignore_accept_datetime_unless_enabled(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.TXT())
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Add("Accept-Datetime", "Fri, 01 Jan 2010 00:00:00 GMT")
+	recorder := httptest.NewRecorder()
+
+	err := n.Negotiate(recorder, req,
+		negotiator.Of("new").As("text/plain").At(time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)),
+		negotiator.Of("old").As("text/plain").At(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)),
+	)
+
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(recorder.Body.String()).To(gomega.Equal("new\n"))
+	g.Expect(recorder.Header().Get("Vary")).To(gomega.Equal(""))
+}
+
+func Test_should_give_no_content_for_empty_collections_when_enabled(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	var nilSlice []int
+	var nilMap map[string]int
+	cases := []struct {
+		data     interface{}
+		expected int
+	}{
+		{[]int{}, http.StatusNoContent},
+		{map[string]int{}, http.StatusNoContent},
+		{[0]int{}, http.StatusNoContent},
+		{nilSlice, http.StatusNoContent},
+		{nilMap, http.StatusNoContent},
+		{func() interface{} { return []string{} }, http.StatusNoContent},
+		{[]int{1}, http.StatusOK},
+		{"", http.StatusOK},
+	}
+
+	n := negotiator.New(processor.JSON()).WithEmptyCollectionNoContent()
+
+	for _, c := range cases {
+		for _, ajax := range []bool{false, true} {
+			req, _ := http.NewRequest("GET", "/", nil)
+			req.Header.Add("Accept", "application/json")
+			if ajax {
+				req.Header.Add("X-Requested-With", "XMLHttpRequest")
+			}
+			recorder := httptest.NewRecorder()
+
+			err := n.Negotiate(recorder, req, negotiator.Offer{Data: c.data, MediaType: "application/json"})
+
+			g.Expect(err).NotTo(gomega.HaveOccurred())
+			g.Expect(recorder.Code).To(gomega.Equal(c.expected), fmt.Sprintf("%#v", c.data))
+		}
+	}
+}
+
+func Test_should_render_empty_collections_by_default(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.JSON())
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Add("Accept", "application/json")
+	recorder := httptest.NewRecorder()
+
+	err := n.Negotiate(recorder, req, negotiator.Offer{Data: []int{}, MediaType: "application/json"})
+
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK))
+	g.Expect(recorder.Body.String()).To(gomega.Equal("[]\n"))
+}
+
+func Test_should_choose_offer_by_media_range_parameters(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	offers := []negotiator.Offer{
+		negotiator.Of("v1").As("application/json").WithMatchParams(map[string]string{"version": "1"}),
+		negotiator.Of("v2").As("application/json").WithMatchParams(map[string]string{"version": "2"}),
+		negotiator.Of("latest").As("application/json"),
+	}
+
+	cases := []struct {
+		accept, expected string
+	}{
+		{"application/json; version=1", `"v1"`},
+		{"application/json;version=2", `"v2"`},
+		{`application/json; Version="2"`, `"v2"`},
+		{"application/*; version=2", `"v2"`},
+		{"application/json; version=3", `"latest"`},
+		{"application/json", `"latest"`},
+		{"*/*", `"latest"`},
+	}
+
+	n := negotiator.New(processor.JSON())
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Add("Accept", c.accept)
+		recorder := httptest.NewRecorder()
+
+		err := n.Negotiate(recorder, req, offers...)
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK), c.accept)
+		g.Expect(recorder.Body.String()).To(gomega.Equal(c.expected+"\n"), c.accept)
+	}
+}
+
+func Test_should_reject_single_offer_without_matching_parameters(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.JSON())
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	recorder := httptest.NewRecorder()
+
+	err := n.Negotiate(recorder, req, negotiator.Of("v2").As("application/json").WithMatchParams(map[string]string{"version": "2"}))
+
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusNotAcceptable))
+}
+
+func Test_log_entries_should_be_formatted_in_key_order(t *testing.T) {
+	g := gomega.NewWithT(t)
+	var entries []string
+	negotiator.Printer = func(level byte, message string, data map[string]interface{}) {
+		entries = append(entries, negotiator.FormatEntry(level, message, data))
+	}
+	defer testLogger(t)
+
+	n := negotiator.New(processor.JSON())
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Add("Accept", "text/html")
+	req.Header.Add("Accept-Language", "en")
+
+	for i := 0; i < 10; i++ {
+		entries = nil
+		n.Negotiate(httptest.NewRecorder(), req, negotiator.Offer{Data: "x", MediaType: "application/json", Language: "en"})
+		// compared in both the exact and the near pass
+		g.Expect(entries).To(gomega.Equal([]string{
+			`D: compared, "Accepted": text/html, "Language": en, "OfferLang": en, "OfferMedia": application/json`,
+			`D: compared, "Accepted": text/html, "Language": en, "OfferLang": en, "OfferMedia": application/json`,
+			`D: 406 rejected, "Accept": text/html, "Accept-Charset": , "Accept-Language": en`,
+		}))
+	}
+}
+
+func Test_should_report_each_outcome_to_metrics_once(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+
+	var results []string
+	var chosen []string
+	n := negotiator.New(processor.JSON(), processor.CSV()).WithMetrics(func(result string, offer negotiator.Offer) {
+		results = append(results, result)
+		chosen = append(chosen, offer.MediaType)
+	})
+
+	offers := []negotiator.Offer{
+		{MediaType: "application/json", Data: "foo"},
+		{MediaType: "text/csv"},
+	}
+
+	cases := []struct {
+		accept, ajax, result, mediaType string
+	}{
+		{"application/json", "", "matched", "application/json"},
+		{"text/csv", "", "204", "text/csv"},
+		{"image/png", "", "406", ""},
+		{"", negotiator.XMLHttpRequest, "ajax", "application/json"},
+	}
+
+	for _, c := range cases {
+		results, chosen = nil, nil
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set(negotiator.Accept, c.accept)
+		req.Header.Set(negotiator.XRequestedWith, c.ajax)
+
+		err := n.Negotiate(httptest.NewRecorder(), req, offers...)
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(results).To(gomega.Equal([]string{c.result}), c.accept)
+		g.Expect(chosen).To(gomega.Equal([]string{c.mediaType}), c.accept)
+	}
+}
+
+func Test_validate_should_report_offers_that_cannot_be_rendered(t *testing.T) {
+	g := gomega.NewWithT(t)
+	n := negotiator.New(processor.JSON(), processor.TXT())
+
+	g.Expect(n.Validate(
+		negotiator.Offer{MediaType: "application/json", Data: []int{1, 2}},
+		negotiator.Offer{MediaType: "text/plain", Data: "foo"},
+		negotiator.Offer{Data: "foo"},
+		negotiator.Offer{MediaType: "text/plain", Data: func() interface{} { return 1 }},
+	)).NotTo(gomega.HaveOccurred())
+
+	err := n.Validate(negotiator.Offer{MediaType: "application/json", Data: make(chan int)})
+	g.Expect(err).To(gomega.MatchError("offer 0 (application/json): Unsupported type for JSON: chan int"))
+
+	err = n.Validate(negotiator.Offer{Data: []int{1, 2}})
+	g.Expect(err).To(gomega.MatchError("offer 0 (): Unsupported type for TXT: []int"))
+}
+
+func Test_should_list_all_languages_of_multilingual_content(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.TXT())
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set(negotiator.Accept, "text/plain")
+	req.Header.Set(negotiator.AcceptLanguage, "en")
+	recorder := httptest.NewRecorder()
+
+	err := n.Negotiate(recorder, req,
+		negotiator.Of("hallo").As("text/plain").In("de"),
+		negotiator.Of("hello / bonjour").As("text/plain").In("en").AlsoIn("fr"),
+	)
+
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK))
+	g.Expect(recorder.Header().Get("Content-Language")).To(gomega.Equal("en, fr"))
+}
+
+func Test_should_consider_offers_only_when_their_predicate_is_true(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.JSON())
+
+	beta := func(req *http.Request) bool { return req.Header.Get("X-Beta") == "yes" }
+	offers := []negotiator.Offer{
+		negotiator.Of("v3").As("application/vnd.myco.v3+json").If(beta),
+		negotiator.Of("v2").As("application/vnd.myco.v2+json"),
+	}
+
+	cases := []struct {
+		beta, expected string
+	}{
+		{"yes", "\"v3\"\n"},
+		{"", "\"v2\"\n"},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set(negotiator.Accept, "application/vnd.myco.v3+json, application/vnd.myco.v2+json;q=0.5")
+		req.Header.Set("X-Beta", c.beta)
+		recorder := httptest.NewRecorder()
+
+		err := n.Negotiate(recorder, req, offers...)
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Body.String()).To(gomega.Equal(c.expected), c.beta)
+	}
+
+	r := n.RenderValues("application/vnd.myco.v3+json", "", false, offers...)
+	g.Expect(r.StatusCode()).To(gomega.Equal(http.StatusNotAcceptable))
+}
+
+func Test_render_should_report_whether_the_response_is_empty(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.JSON())
+
+	r := n.RenderValues("application/json", "", false, negotiator.Offer{MediaType: "application/json"})
+	g.Expect(r.StatusCode()).To(gomega.Equal(http.StatusNoContent))
+	g.Expect(r.(negotiator.EmptyReporter).Empty()).To(gomega.BeTrue())
+
+	r = n.RenderValues("application/json", "", false, negotiator.Offer{MediaType: "application/json", Data: 1})
+	g.Expect(r.StatusCode()).To(gomega.Equal(http.StatusOK))
+	g.Expect(r.(negotiator.EmptyReporter).Empty()).To(gomega.BeFalse())
+
+	r = n.RenderValues("image/png", "", false, negotiator.Offer{MediaType: "application/json", Data: 1})
+	g.Expect(r.StatusCode()).To(gomega.Equal(http.StatusNotAcceptable))
+	g.Expect(r.(negotiator.EmptyReporter).Empty()).To(gomega.BeFalse())
+}
+
+func Test_should_use_default_accept_only_when_there_is_no_accept_header(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.TXT(), processor.JSON()).WithDefaultAccept("application/json")
+
+	offers := []negotiator.Offer{
+		negotiator.Of("foo").As("text/plain"),
+		negotiator.Of("foo").As("application/json"),
+	}
+
+	cases := []struct {
+		accept, expected string
+	}{
+		{"", "application/json; charset=utf-8"},
+		{"text/plain", "text/plain; charset=utf-8"},
+		{"*/*", "text/plain; charset=utf-8"},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		if c.accept != "" {
+			req.Header.Set(negotiator.Accept, c.accept)
+		}
+		recorder := httptest.NewRecorder()
+
+		err := n.Negotiate(recorder, req, offers...)
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Header().Get("Content-Type")).To(gomega.Equal(c.expected), c.accept)
+	}
+}
+
+func Test_render_result_should_give_the_reason_for_rejection(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.JSON(), processor.CSV()).WithStrictAcceptParsing()
+
+	offers := []negotiator.Offer{
+		negotiator.Of("foo").As("application/json").In("en"),
+		negotiator.Of("foo").As("text/csv").In("en"),
+	}
+
+	cases := []struct {
+		accept, language, charset string
+		expected                  negotiator.Cause
+	}{
+		{"application/json", "en", "", negotiator.Acceptable},
+		{"image/png", "en", "", negotiator.MediaTypeMismatch},
+		{"application/json", "fr", "", negotiator.LanguageMismatch},
+		{"text/csv", "en", "iso-8859-1", negotiator.CharsetMismatch},
+		{"*/*;q=0", "en", "", negotiator.AllExcluded},
+		{"application", "en", "", negotiator.MalformedHeader},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set(negotiator.Accept, c.accept)
+		req.Header.Set(negotiator.AcceptLanguage, c.language)
+		req.Header.Set(negotiator.AcceptCharset, c.charset)
+
+		_, reason := n.RenderResult(req, offers...)
+
+		g.Expect(reason.Cause).To(gomega.Equal(c.expected), c.accept)
+		if c.expected != negotiator.Acceptable {
+			g.Expect(reason.Accept).To(gomega.Equal(c.accept))
+			g.Expect(reason.AcceptLanguage).To(gomega.Equal(c.language))
+		}
+	}
+}
+
+func Test_should_write_pre_encoded_data_verbatim_when_accepted(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	gw.Write([]byte("hello\n"))
+	gw.Close()
+	gzipped := buf.Bytes()
+
+	offer := negotiator.Of(gzipped).As("text/plain").EncodedWith("gzip")
+
+	cases := []struct {
+		n               *negotiator.Negotiator
+		acceptEncoding  string
+		code            int
+		contentEncoding string
+		body            string
+	}{
+		{negotiator.New(processor.TXT()), "gzip, deflate", http.StatusOK, "gzip", string(gzipped)},
+		{negotiator.New(processor.TXT()), "x-gzip", http.StatusOK, "gzip", string(gzipped)},
+		{negotiator.New(processor.TXT()), "", http.StatusNotAcceptable, "", ""},
+		{negotiator.New(processor.TXT()), "deflate", http.StatusNotAcceptable, "", ""},
+		{negotiator.New(processor.TXT()).WithDecoding(encoding.Gzip), "", http.StatusOK, "", "hello\n"},
+	}
+
+	for i, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set(negotiator.Accept, "text/plain")
+		req.Header.Set(negotiator.AcceptEncoding, c.acceptEncoding)
+		recorder := httptest.NewRecorder()
+
+		err := c.n.Negotiate(recorder, req, offer)
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Code).To(gomega.Equal(c.code), "%d", i)
+		g.Expect(recorder.Header().Get("Content-Encoding")).To(gomega.Equal(c.contentEncoding), "%d", i)
+		if c.code == http.StatusOK {
+			g.Expect(recorder.Header().Get("Vary")).To(gomega.Equal(negotiator.AcceptEncoding), "%d", i)
+			g.Expect(recorder.Body.String()).To(gomega.Equal(c.body), "%d", i)
+		}
+	}
+}
+
+func Test_should_choose_pre_encoded_variant_by_accept_encoding(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.JSON())
+
+	variants := map[string][]byte{
+		"br":       []byte("brotli"),
+		"gzip":     []byte("gzipped-json"),
+		"identity": []byte(`{"a":1}` + "\n"),
+	}
+
+	cases := []struct {
+		offer           negotiator.Offer
+		acceptEncoding  string
+		code            int
+		contentEncoding string
+		body            string
+	}{
+		{negotiator.Of(nil).As("application/json").WithEncodings(variants), "gzip, br", http.StatusOK, "br", "brotli"},
+		{negotiator.Of(nil).As("application/json").WithEncodings(variants), "gzip, br;q=0.5", http.StatusOK, "gzip", "gzipped-json"},
+		{negotiator.Of(nil).As("application/json").WithEncodings(variants), "gzip", http.StatusOK, "gzip", "gzipped-json"},
+		{negotiator.Of(nil).As("application/json").WithEncodings(variants), "*", http.StatusOK, "br", "brotli"},
+		{negotiator.Of(nil).As("application/json").WithEncodings(variants), "deflate", http.StatusOK, "", `{"a":1}` + "\n"},
+		{negotiator.Of(nil).As("application/json").WithEncodings(variants), "", http.StatusOK, "", `{"a":1}` + "\n"},
+		{negotiator.Of("b").As("application/json").WithEncodings(map[string][]byte{"br": []byte("brotli")}), "gzip", http.StatusOK, "", `"b"` + "\n"},
+		{negotiator.Of(nil).As("application/json").WithEncodings(map[string][]byte{"br": []byte("brotli")}), "gzip", http.StatusNotAcceptable, "", ""},
+	}
+
+	for i, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set(negotiator.Accept, "application/json")
+		req.Header.Set(negotiator.AcceptEncoding, c.acceptEncoding)
+		recorder := httptest.NewRecorder()
+
+		err := n.Negotiate(recorder, req, c.offer)
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Code).To(gomega.Equal(c.code), "%d", i)
+		g.Expect(recorder.Header().Get("Content-Encoding")).To(gomega.Equal(c.contentEncoding), "%d", i)
+		if c.code == http.StatusOK {
+			g.Expect(recorder.Header().Get("Content-Type")).To(gomega.Equal("application/json; charset=utf-8"), "%d", i)
+			g.Expect(recorder.Header().Values("Vary")).To(gomega.Equal([]string{negotiator.AcceptEncoding}), "%d", i)
+			g.Expect(recorder.Body.String()).To(gomega.Equal(c.body), "%d", i)
+		}
+	}
+}
+
+func Test_should_honour_language_exclusions_when_strict(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.TXT())
+
+	cases := []struct {
+		n        *negotiator.Negotiator
+		offers   []negotiator.Offer
+		expected string
+	}{
+		{n, []negotiator.Offer{
+			negotiator.Of("Hallo").As("text/plain").In("de"),
+			negotiator.Of("Hello").As("text/plain").In("en"),
+		}, "de"},
+		{n.WithStrictLanguageExclusion(), []negotiator.Offer{
+			negotiator.Of("Hallo").As("text/plain").In("de"),
+			negotiator.Of("Hello").As("text/plain").In("en"),
+		}, "en"},
+		{n.WithStrictLanguageExclusion(), []negotiator.Offer{
+			negotiator.Of("Hallo").As("text/plain").In("de-CH"),
+			negotiator.Of("Hello").As("text/plain").In("en"),
+		}, "en"},
+		{n.WithStrictLanguageExclusion(), []negotiator.Offer{
+			negotiator.Of("Hallo").As("text/plain").In("de"),
+		}, "de"},
+	}
+
+	for i, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set(negotiator.Accept, "text/plain")
+		req.Header.Set(negotiator.AcceptLanguage, "de;q=0, *")
+		recorder := httptest.NewRecorder()
+
+		err := c.n.Negotiate(recorder, req, c.offers...)
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK), "%d", i)
+		g.Expect(recorder.Header().Get("Content-Language")).To(gomega.HavePrefix(c.expected), "%d", i)
+	}
+}
+
+func Test_should_allow_query_parameter_to_override_accept(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.JSON(), processor.XML()).
+		WithFormatOverride("format", map[string]string{"json": "application/json", "xml": "application/xml"})
+
+	cases := []struct {
+		url, accept, expected string
+	}{
+		{"/?format=xml", "application/json", "application/xml"},
+		{"/?format=json", "application/xml", "application/json"},
+		{"/?format=yaml", "application/xml", "application/xml"},
+		{"/", "application/xml", "application/xml"},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", c.url, nil)
+		req.Header.Set(negotiator.Accept, c.accept)
+		recorder := httptest.NewRecorder()
+
+		err := n.Negotiate(recorder, req,
+			negotiator.Of(&ValidXMLUser{Name: "Joe"}).As("application/json"),
+			negotiator.Of(&ValidXMLUser{Name: "Joe"}).As("application/xml"))
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Header().Get("Content-Type")).To(gomega.HavePrefix(c.expected), c.url)
+	}
+}
+
+func Test_negotiate_capture_should_record_the_response(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.JSON()).WithBufferedOutput()
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set(negotiator.Accept, "application/json")
+
+	captured, err := n.NegotiateCapture(req, negotiator.Of("foo").As("application/json").In("en"))
+
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(captured.StatusCode).To(gomega.Equal(http.StatusOK))
+	g.Expect(captured.Header.Get("Content-Type")).To(gomega.Equal("application/json; charset=utf-8"))
+	g.Expect(captured.Header.Get("Content-Language")).To(gomega.Equal("en"))
+	g.Expect(captured.Header.Get("Content-Length")).To(gomega.Equal("6"))
+	g.Expect(string(captured.Body)).To(gomega.Equal("\"foo\"\n"))
+
+	captured, err = n.NegotiateCapture(req, negotiator.Of("foo").As("text/csv"))
+
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(captured.StatusCode).To(gomega.Equal(http.StatusNotAcceptable))
+	g.Expect(captured.Body).NotTo(gomega.BeEmpty())
+}
+
+func Test_should_match_level_parameters_as_in_RFC7231(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(&fakeProcessor{match: "text/html"}, processor.TXT())
+
+	// RFC 7231 section 5.3.2
+	const rfcAccept = "text/*;q=0.3, text/html;q=0.7, text/html;level=1, text/html;level=2;q=0.4, */*;q=0.5"
+
+	html := negotiator.Of("html").As("text/html")
+	html1 := negotiator.Of("html1").As("text/html").WithMatchParams(map[string]string{"level": "1"})
+	html2 := negotiator.Of("html2").As("text/html").WithMatchParams(map[string]string{"level": "2"})
+	html3 := negotiator.Of("html3").As("text/html").WithMatchParams(map[string]string{"level": "3"})
+	plain := negotiator.Of("plain").As("text/plain")
+
+	cases := []struct {
+		accept   string
+		offers   []negotiator.Offer
+		expected string
+	}{
+		// each representation in the RFC table is acceptable on its own, except that an
+		// offer requiring level=3 needs an accepted media range with that parameter
+		{rfcAccept, []negotiator.Offer{html1}, "text/html | html1"},
+		{rfcAccept, []negotiator.Offer{html}, "text/html | html"},
+		{rfcAccept, []negotiator.Offer{plain}, "plain\n"},
+		{rfcAccept, []negotiator.Offer{html2}, "text/html | html2"},
+		{rfcAccept, []negotiator.Offer{html3}, ""},
+
+		// the level chooses between distinct offers
+		{"text/html;level=1", []negotiator.Offer{html2, html1, html}, "text/html | html1"},
+		{"text/html;level=2", []negotiator.Offer{html1, html2, html}, "text/html | html2"},
+		{"TEXT/HTML; Level=2", []negotiator.Offer{html1, html2, html}, "text/html | html2"},
+
+		// without a level, the offer without a level constraint is chosen
+		{"text/html", []negotiator.Offer{html1, html2, html}, "text/html | html"},
+		{"*/*", []negotiator.Offer{html1, html2, html}, "text/html | html"},
+
+		// an excluded level is not chosen
+		{"text/html;level=1;q=0, text/html", []negotiator.Offer{html1, html}, "text/html | html"},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set(negotiator.Accept, c.accept)
+		recorder := httptest.NewRecorder()
+
+		err := n.Negotiate(recorder, req, c.offers...)
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		if c.expected == "" {
+			g.Expect(recorder.Code).To(gomega.Equal(http.StatusNotAcceptable), c.accept)
+		} else {
+			g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK), c.accept)
+			g.Expect(recorder.Body.String()).To(gomega.Equal(c.expected), c.accept)
+		}
+	}
+}
+
+func Test_must_have_processors_should_panic_only_without_processors(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	g.Expect(func() { negotiator.New().MustHaveProcessors() }).To(gomega.Panic())
+
+	n := negotiator.New().WithDefaults()
+	g.Expect(n.MustHaveProcessors()).To(gomega.BeIdenticalTo(n))
+}
+
+func Test_should_echo_requested_language_for_offer_without_language_if_enabled(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.TXT())
+
+	cases := []struct {
+		n                        *negotiator.Negotiator
+		acceptLanguage, expected string
+	}{
+		{n, "fr", ""},
+		{n.WithEchoRequestedLanguage(), "fr", "fr"},
+		{n.WithEchoRequestedLanguage(), "fr;q=0.5, de", "de"},
+		{n.WithEchoRequestedLanguage(), "*", ""},
+		{n.WithEchoRequestedLanguage(), "", ""},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set(negotiator.Accept, "text/plain")
+		req.Header.Set(negotiator.AcceptLanguage, c.acceptLanguage)
+		recorder := httptest.NewRecorder()
+
+		err := c.n.Negotiate(recorder, req, negotiator.Of("foo").As("text/plain"))
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK))
+		g.Expect(recorder.Header().Get("Content-Language")).To(gomega.Equal(c.expected), c.acceptLanguage)
+	}
+}
+
+func Test_should_serve_csv_and_tsv_from_one_processor(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.CSV())
+
+	cases := []struct {
+		accept, contentType, body string
+	}{
+		{"text/csv", "text/csv; charset=utf-8", "a,b\n"},
+		{"text/tab-separated-values", "text/tab-separated-values; charset=utf-8", "a\tb\n"},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set(negotiator.Accept, c.accept)
+		recorder := httptest.NewRecorder()
+
+		err := n.Negotiate(recorder, req,
+			negotiator.Of([]string{"a", "b"}).As("text/csv"),
+			negotiator.Of([]string{"a", "b"}).As("text/tab-separated-values"))
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Header().Get("Content-Type")).To(gomega.Equal(c.contentType))
+		g.Expect(recorder.Body.String()).To(gomega.Equal(c.body))
+	}
+}
+
+func Test_should_break_ties_by_server_or_client_order(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.JSON(), processor.XML())
+
+	offers := []negotiator.Offer{
+		negotiator.Of("xml").As("application/xml"),
+		negotiator.Of("json").As("application/json"),
+	}
+
+	cases := []struct {
+		n        *negotiator.Negotiator
+		accept   string
+		expected string
+	}{
+		{n, "application/json, application/xml", "application/xml"},
+		{n, "application/xml, application/json", "application/xml"},
+		{n.WithTieBreak(negotiator.ServerOrder), "application/json, application/xml", "application/xml"},
+		{n.WithTieBreak(negotiator.ClientOrder), "application/json, application/xml", "application/json"},
+		{n.WithTieBreak(negotiator.ClientOrder), "application/xml, application/json", "application/xml"},
+		{n.WithTieBreak(negotiator.ClientOrder), "application/xml;q=0.5, application/json;q=0.9", "application/json"},
+		{n.WithTieBreak(negotiator.ClientOrder), "*/*, application/json", "application/json"},
+		{n.WithTieBreak(negotiator.ClientOrder), "application/*, text/html", "application/xml"},
+	}
+
+	for i, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set(negotiator.Accept, c.accept)
+		recorder := httptest.NewRecorder()
+
+		err := c.n.Negotiate(recorder, req, offers...)
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK), "%d", i)
+		g.Expect(recorder.Header().Get("Content-Type")).To(gomega.HavePrefix(c.expected), "%d", i)
+	}
+}
+
+func Test_should_serve_markdown_or_html_from_one_offer(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	toHTML := func(md []byte) []byte { return []byte("<p>" + string(md) + "</p>") }
+	n := negotiator.New(processor.MarkdownToHTML(toHTML), processor.JSON())
+
+	cases := []struct {
+		accept, contentType, body string
+	}{
+		{"text/html", "text/html; charset=utf-8", "<p>hello</p>"},
+		{"text/markdown", "text/markdown; charset=utf-8", "hello"},
+		{"text/html;q=0.5, text/markdown", "text/markdown; charset=utf-8", "hello"},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set(negotiator.Accept, c.accept)
+		recorder := httptest.NewRecorder()
+
+		err := n.Negotiate(recorder, req, negotiator.Of("hello"))
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK), c.accept)
+		g.Expect(recorder.Header().Get("Content-Type")).To(gomega.Equal(c.contentType), c.accept)
+		g.Expect(recorder.Body.String()).To(gomega.Equal(c.body), c.accept)
+	}
+}
+
+func Test_should_give_multiple_choices_for_vague_accept_when_enabled(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.JSON(), processor.XML(), processor.TXT())
+
+	offers := []negotiator.Offer{
+		negotiator.Of("x").As("application/json"),
+		negotiator.Of("x").As("application/xml"),
+		negotiator.Of("x").As("application/json").In("fr"),
+	}
+
+	cases := []struct {
+		n      *negotiator.Negotiator
+		accept string
+		offers []negotiator.Offer
+		code   int
+	}{
+		{n, "", offers, http.StatusOK},
+		{n.WithMultipleChoices(), "", offers, http.StatusMultipleChoices},
+		{n.WithMultipleChoices(), "*/*", offers, http.StatusMultipleChoices},
+		{n.WithMultipleChoices(), "application/xml", offers, http.StatusOK},
+		{n.WithMultipleChoices(), "", offers[:1], http.StatusOK},
+		{n.WithMultipleChoices(), "", []negotiator.Offer{negotiator.Of("x"), negotiator.Of("x").As("text/plain")}, http.StatusOK},
+	}
+
+	for i, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set(negotiator.Accept, c.accept)
+		recorder := httptest.NewRecorder()
+
+		err := c.n.Negotiate(recorder, req, c.offers...)
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Code).To(gomega.Equal(c.code), "%d", i)
+		if c.code == http.StatusMultipleChoices {
+			g.Expect(recorder.Header().Get("Content-Type")).To(gomega.Equal("text/plain; charset=utf-8"), "%d", i)
+			g.Expect(recorder.Header().Get(negotiator.XAvailableTypes)).To(gomega.Equal("application/json, application/xml"), "%d", i)
+			g.Expect(recorder.Body.String()).To(gomega.Equal("application/json\napplication/xml\n"), "%d", i)
+		}
+	}
+}
+
+func Test_should_call_seq_provider_only_for_chosen_offer(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.YAMLStream(), processor.JSON()).WithEmptyCollectionNoContent()
+
+	calls := 0
+	provider := func() negotiator.Seq {
+		calls++
+		return &letters{s: "abc"}
+	}
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set(negotiator.Accept, "application/yaml")
+	recorder := httptest.NewRecorder()
+
+	err := n.Negotiate(recorder, req,
+		negotiator.Of(provider).As("application/json"),
+		negotiator.Of(provider).As("application/yaml"))
+
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK))
+	g.Expect(recorder.Body.String()).To(gomega.Equal("a\n---\nb\n---\nc\n"))
+	g.Expect(calls).To(gomega.Equal(1))
+}
+
+func Test_should_stream_json_array_from_channel(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.StreamingJSONArray(), processor.XML())
+
+	ch := make(chan string, 2)
+	ch <- "a"
+	ch <- "b"
+	close(ch)
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set(negotiator.Accept, "application/json")
+	recorder := httptest.NewRecorder()
+
+	err := n.Negotiate(recorder, req, negotiator.Of(ch).As("application/json"))
+
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK))
+	g.Expect(recorder.Header().Get("Content-Type")).To(gomega.Equal("application/json; charset=utf-8"))
+	g.Expect(recorder.Body.String()).To(gomega.Equal(`["a","b"]` + "\n"))
+	g.Expect(recorder.Flushed).To(gomega.BeTrue())
+}
+
+// letters is a Seq of the letters of a string.
+type letters struct {
+	s string
+}
+
+func (l *letters) Next() (interface{}, bool) {
+	if l.s == "" {
+		return nil, false
+	}
+	c := l.s[:1]
+	l.s = l.s[1:]
+	return c, true
+}
+
+func Test_should_ignore_empty_elements_in_accept_header(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.JSON(), processor.TXT())
+
+	cases := []struct {
+		accept, contentType string
+	}{
+		{"text/html,,text/plain", "text/plain; charset=utf-8"},
+		{",", "application/json; charset=utf-8"},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set(negotiator.Accept, c.accept)
+		recorder := httptest.NewRecorder()
+
+		err := n.Negotiate(recorder, req,
+			negotiator.Of("x").As("application/json"),
+			negotiator.Of("x").As("text/plain"))
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK), c.accept)
+		g.Expect(recorder.Header().Get("Content-Type")).To(gomega.Equal(c.contentType), c.accept)
+	}
+}
+
+func Test_should_return_204_for_empty_bytes(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.Binary())
+
+	for _, data := range []interface{}{nil, []byte{}} {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set(negotiator.Accept, "application/octet-stream")
+		recorder := httptest.NewRecorder()
+
+		err := n.Negotiate(recorder, req, negotiator.Of(data).As("application/octet-stream"))
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Code).To(gomega.Equal(http.StatusNoContent))
+	}
+}
+
+func Test_should_use_preferred_languages_when_any_language_is_accepted(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.TXT())
+	preferred := n.WithPreferredLanguages("fr", "en")
+
+	offers := []negotiator.Offer{
+		negotiator.Of("Hallo").As("text/plain").In("de"),
+		negotiator.Of("Hello").As("text/plain").In("en-GB"),
+		negotiator.Of("Bonjour").As("text/plain").In("fr"),
+	}
+
+	cases := []struct {
+		n              *negotiator.Negotiator
+		acceptLanguage string
+		offers         []negotiator.Offer
+		expected       string
+	}{
+		{n, "*", offers, "de"},
+		{preferred, "*", offers, "fr"},
+		{preferred, "", offers, "fr"},
+		{preferred, "*", offers[:2], "en-GB"},
+		{preferred, "*", offers[:1], "de"},
+		{preferred, "de", offers, "de"},
+		{preferred, "de, en;q=0.5", offers, "de"},
+		{preferred, "fr;q=0, *", offers, "en-GB"},
+	}
+
+	for i, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set(negotiator.Accept, "text/plain")
+		if c.acceptLanguage != "" {
+			req.Header.Set(negotiator.AcceptLanguage, c.acceptLanguage)
+		}
+		recorder := httptest.NewRecorder()
+
+		err := c.n.Negotiate(recorder, req, c.offers...)
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK), "%d", i)
+		g.Expect(recorder.Header().Get("Content-Language")).To(gomega.Equal(c.expected), "%d", i)
+	}
+}
+
+func Test_should_parse_request_headers(t *testing.T) {
+	g := gomega.NewWithT(t)
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set(negotiator.Accept, "text/html;q=0.5, application/json")
+	req.Header.Add(negotiator.AcceptLanguage, "en;q=0.8")
+	req.Header.Add(negotiator.AcceptLanguage, "fr")
+	req.Header.Set(negotiator.AcceptCharset, "iso-8859-1;q=0.1, utf-8")
+	req.Header.Set(negotiator.AcceptEncoding, "gzip, br")
+
+	mrs, languages, charsets, encodings := negotiator.ParseRequest(req)
+
+	g.Expect(mrs.String()).To(gomega.Equal("application/json, text/html;q=0.5"))
+	g.Expect(languages.String()).To(gomega.Equal("fr, en;q=0.8"))
+	g.Expect(charsets.String()).To(gomega.Equal("utf-8, iso-8859-1;q=0.1"))
+	g.Expect(encodings.String()).To(gomega.Equal("gzip, br"))
+}
+
+func Test_should_parse_request_without_headers(t *testing.T) {
+	g := gomega.NewWithT(t)
+	req, _ := http.NewRequest("GET", "/", nil)
+
+	mrs, languages, charsets, encodings := negotiator.ParseRequest(req)
+
+	g.Expect(mrs.String()).To(gomega.Equal("*/*"))
+	g.Expect(languages.String()).To(gomega.Equal("*"))
+	g.Expect(charsets).To(gomega.BeEmpty())
+	g.Expect(encodings).To(gomega.BeEmpty())
+}
+
+func Test_should_dedup_offers(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.TXT()).WithDedupOffers()
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set(negotiator.Accept, "text/plain")
+	recorder := httptest.NewRecorder()
+
+	err := n.Negotiate(recorder, req,
+		negotiator.Of("first").As("text/plain"),
+		negotiator.Of("second").As("text/plain"))
+
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(recorder.Body.String()).To(gomega.Equal("first\n"))
+	g.Expect(n.Describe()).To(gomega.ContainSubstring("dedup offers"))
+}
+
+func Test_should_read_configured_header_names(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.JSON(), processor.TXT()).
+		WithAcceptHeaderName("X-Original-Accept").
+		WithAcceptLanguageHeaderName("X-Original-Accept-Language").
+		WithAcceptCharsetHeaderName("X-Original-Accept-Charset").
+		WithAcceptEncodingHeaderName("X-Original-Accept-Encoding").
+		WithEncoding(encoding.Gzip)
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set(negotiator.Accept, "application/json")
+	req.Header.Set("X-Original-Accept", "text/plain")
+	req.Header.Set("X-Original-Accept-Language", "fr")
+	req.Header.Set("X-Original-Accept-Charset", "utf-8")
+	req.Header.Set("X-Original-Accept-Encoding", "gzip")
+	recorder := httptest.NewRecorder()
+
+	err := n.Negotiate(recorder, req,
+		negotiator.Of("hello").As("application/json").In("en"),
+		negotiator.Of("bonjour").As("application/json").In("fr"),
+		negotiator.Of("hello").As("text/plain").In("en"),
+		negotiator.Of("bonjour").As("text/plain").In("fr"))
+
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK))
+	g.Expect(recorder.Header().Get("Content-Type")).To(gomega.Equal("text/plain; charset=utf-8"))
+	g.Expect(recorder.Header().Get("Content-Language")).To(gomega.Equal("fr"))
+	g.Expect(recorder.Header().Get("Content-Encoding")).To(gomega.Equal("gzip"))
+	g.Expect(n.Describe()).To(gomega.ContainSubstring("Accept header: X-Original-Accept\n"))
+}
+
+func Test_should_not_read_standard_header_when_name_is_configured(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.JSON(), processor.TXT()).WithAcceptHeaderName("X-Original-Accept")
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set(negotiator.Accept, "text/plain")
+	recorder := httptest.NewRecorder()
+
+	err := n.Negotiate(recorder, req,
+		negotiator.Of("hello").As("application/json"),
+		negotiator.Of("hello").As("text/plain"))
+
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(recorder.Header().Get("Content-Type")).To(gomega.Equal("application/json; charset=utf-8"))
+}
+
+func Test_should_write_headers_before_body_without_superfluous_WriteHeader(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(&headerWritingProcessor{}, processor.JSON())
+	large := strings.Repeat("x", 64*1024)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n.Negotiate(w, req, negotiator.Of(large).As("text/plain").In("en"))
+	}))
+	serverLog := &bytes.Buffer{}
+	server.Config.ErrorLog = log.New(serverLog, "", 0)
+	server.Start()
+	defer server.Close()
+
+	cases := []struct {
+		accept, contentType string
+		status, length      int
+	}{
+		{"text/plain", "text/plain", http.StatusOK, len(large)},
+		{"image/png", "text/plain; charset=utf-8", http.StatusNotAcceptable, -1},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		req.Header.Set(negotiator.Accept, c.accept)
+
+		res, err := http.DefaultClient.Do(req)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(res.StatusCode).To(gomega.Equal(c.status), c.accept)
+		g.Expect(res.Header.Get("Content-Type")).To(gomega.Equal(c.contentType), c.accept)
+		if c.length >= 0 {
+			g.Expect(body).To(gomega.HaveLen(c.length))
+			g.Expect(res.Header.Get("Content-Language")).To(gomega.Equal("en"))
+		}
+	}
+
+	g.Expect(serverLog.String()).NotTo(gomega.ContainSubstring("superfluous"))
+}
+
+func Test_should_fail_when_body_exceeds_max_size(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.JSON()).WithMaxBodySize(20)
+	large := func() interface{} { return strings.Repeat("x", 1000) }
+
+	cases := []struct {
+		n              *negotiator.Negotiator
+		data           interface{}
+		acceptEncoding string
+		status         int
+		failed         bool
+	}{
+		{n, "small", "", http.StatusOK, false},
+		{n, large, "", http.StatusOK, true},
+		{n.WithEncoding(encoding.Gzip), large, "gzip", http.StatusOK, true},
+		{n.WithBufferedOutput(), "small", "", http.StatusOK, false},
+		{n.WithBufferedOutput(), large, "", http.StatusInternalServerError, true},
+	}
+
+	for i, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set(negotiator.Accept, "application/json")
+		req.Header.Set(negotiator.AcceptEncoding, c.acceptEncoding)
+		recorder := httptest.NewRecorder()
+
+		err := c.n.Negotiate(recorder, req, negotiator.Of(c.data))
+
+		g.Expect(recorder.Code).To(gomega.Equal(c.status), "%d", i)
+		if c.failed {
+			g.Expect(errors.Is(err, negotiator.ErrBodyTooLarge)).To(gomega.BeTrue(), "%d %v", i, err)
+			g.Expect(recorder.Body.String()).NotTo(gomega.ContainSubstring("xxx"), "%d", i)
+		} else {
+			g.Expect(err).NotTo(gomega.HaveOccurred(), "%d", i)
+			g.Expect(recorder.Body.String()).To(gomega.Equal("\"small\"\n"), "%d", i)
+		}
+	}
+}
+
+func Test_should_serve_byte_ranges_of_seekable_data(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.Binary().(processor.ContentTypeSettable).WithContentType("text/csv")).WithRangeSupport()
+	const data = "a,b\n1,2\n3,4\n"
+
+	cases := []struct {
+		rangeHeader, ifRange string
+		status               int
+		contentRange, body   string
+	}{
+		{"", "", http.StatusOK, "", data},
+		{"bytes=4-7", "", http.StatusPartialContent, "bytes 4-7/12", "1,2\n"},
+		{"bytes=8-", "", http.StatusPartialContent, "bytes 8-11/12", "3,4\n"},
+		{"bytes=-4", "", http.StatusPartialContent, "bytes 8-11/12", "3,4\n"},
+		{"bytes=8-100", "", http.StatusPartialContent, "bytes 8-11/12", "3,4\n"},
+		{"bytes=4-7", `"v1"`, http.StatusPartialContent, "bytes 4-7/12", "1,2\n"},
+		{"bytes=4-7", `"v2"`, http.StatusOK, "", data},
+		{"bytes=0-1, 4-7", "", http.StatusOK, "", data},
+		{"bytes=7-4", "", http.StatusOK, "", data},
+		{"lines=1-2", "", http.StatusOK, "", data},
+		{"bytes=12-", "", http.StatusRequestedRangeNotSatisfiable, "bytes */12", ""},
+		{"bytes=-0", "", http.StatusRequestedRangeNotSatisfiable, "bytes */12", ""},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set(negotiator.Accept, "text/csv")
+		if c.rangeHeader != "" {
+			req.Header.Set(negotiator.Range, c.rangeHeader)
+		}
+		if c.ifRange != "" {
+			req.Header.Set(negotiator.IfRange, c.ifRange)
+		}
+		recorder := httptest.NewRecorder()
+
+		err := n.Negotiate(recorder, req, negotiator.Of(strings.NewReader(data)).As("text/csv").WithETag("v1"))
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Code).To(gomega.Equal(c.status), c.rangeHeader)
+		g.Expect(recorder.Header().Get("Content-Range")).To(gomega.Equal(c.contentRange), c.rangeHeader)
+		if c.status != http.StatusRequestedRangeNotSatisfiable {
+			g.Expect(recorder.Body.String()).To(gomega.Equal(c.body), c.rangeHeader)
+			g.Expect(recorder.Header().Get("Accept-Ranges")).To(gomega.Equal("bytes"), c.rangeHeader)
+			g.Expect(recorder.Header().Get("Content-Type")).To(gomega.Equal("text/csv"), c.rangeHeader)
+		}
+		if c.status == http.StatusPartialContent {
+			g.Expect(recorder.Header().Get("Content-Length")).To(gomega.Equal(fmt.Sprint(len(c.body))), c.rangeHeader)
+		}
+	}
+}
+
+func Test_should_ignore_ranges_for_data_that_is_not_seekable(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.TXT()).WithRangeSupport()
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set(negotiator.Range, "bytes=0-1")
+	recorder := httptest.NewRecorder()
+
+	err := n.Negotiate(recorder, req, negotiator.Of("hello").As("text/plain"))
+
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK))
+	g.Expect(recorder.Body.String()).To(gomega.Equal("hello\n"))
+	g.Expect(recorder.Header().Get("Accept-Ranges")).To(gomega.BeEmpty())
+}
+
+func Test_should_ignore_ranges_for_processors_that_transform_the_data(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.JSON(), processor.Binary()).WithRangeSupport()
+
+	for _, rangeHeader := range []string{"", "bytes=0-1"} {
+		req, _ := http.NewRequest("GET", "/", nil)
+		if rangeHeader != "" {
+			req.Header.Set(negotiator.Range, rangeHeader)
+		}
+		recorder := httptest.NewRecorder()
+
+		err := n.Negotiate(recorder, req, negotiator.Of(strings.NewReader("hello world!")).As("application/json"))
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK), rangeHeader)
+		g.Expect(recorder.Body.String()).To(gomega.Equal("{}\n"), rangeHeader)
+		g.Expect(recorder.Header().Get("Accept-Ranges")).To(gomega.BeEmpty(), rangeHeader)
+		g.Expect(recorder.Header().Get("Content-Range")).To(gomega.BeEmpty(), rangeHeader)
+	}
+}
+
+func Test_should_give_reason_for_unsatisfiable_range(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.Binary()).WithRangeSupport()
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set(negotiator.Range, "bytes=10-")
+
+	cr, reason := n.RenderResult(req, negotiator.Of(strings.NewReader("short")))
+
+	g.Expect(cr.StatusCode()).To(gomega.Equal(http.StatusRequestedRangeNotSatisfiable))
+	g.Expect(reason.Cause).To(gomega.Equal(negotiator.RangeNotSatisfiable))
+	g.Expect(reason.Cause.String()).To(gomega.Equal("range not satisfiable"))
+}
+
+func Test_should_echo_request_id_in_error_responses(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	tpl := template.Must(template.New("error").Parse(`<p>{{.Message}}</p><p>ID: {{.RequestID}}</p>`))
+	n := negotiator.New(processor.JSON()).WithRequestIDHeader("X-Request-ID")
+
+	cases := []struct {
+		n                    *negotiator.Negotiator
+		accept, id, expected string
+		echoed               string
+	}{
+		{n, "image/png", "abc123", "the accepted formats are not offered by the server\n", "abc123"},
+		{n, "image/png", "", "the accepted formats are not offered by the server\n", ""},
+		{n.WithErrorTemplate(tpl), "text/html", "abc123", "<p>the accepted formats are not offered by the server</p><p>ID: abc123</p>", "abc123"},
+		{negotiator.New(processor.JSON()), "image/png", "abc123", "the accepted formats are not offered by the server\n", ""},
+	}
+
+	for i, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set(negotiator.Accept, c.accept)
+		if c.id != "" {
+			req.Header.Set("X-Request-ID", c.id)
+		}
+		recorder := httptest.NewRecorder()
+
+		err := c.n.Negotiate(recorder, req, negotiator.Of("x").As("application/json"))
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Code).To(gomega.Equal(http.StatusNotAcceptable), "%d", i)
+		g.Expect(recorder.Body.String()).To(gomega.Equal(c.expected), "%d", i)
+		g.Expect(recorder.Result().Header.Get("X-Request-ID")).To(gomega.Equal(c.echoed), "%d", i)
+	}
+}
+
+func Test_should_put_request_id_in_problem_details(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	var n *negotiator.Negotiator
+	n = negotiator.New(processor.JSON()).WithRequestIDHeader("X-Request-ID").
+		WithErrorHandlerFunc(func(w http.ResponseWriter, req *http.Request, offers []negotiator.Offer, code int) {
+			w.Header().Set("Content-Type", "application/problem+json")
+			processor.ProblemJSON().Process(w, "", processor.ProblemDetails{
+				Title:     http.StatusText(code),
+				Status:    code,
+				RequestID: n.RequestID(req),
+			})
+		})
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set(negotiator.Accept, "image/png")
+	req.Header.Set("X-Request-ID", "abc123")
+	recorder := httptest.NewRecorder()
+
+	err := n.Negotiate(recorder, req, negotiator.Of("x").As("application/json"))
+
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusNotAcceptable))
+	g.Expect(recorder.Result().Header.Get("X-Request-ID")).To(gomega.Equal("abc123"))
+	g.Expect(recorder.Result().Header.Get("Content-Type")).To(gomega.Equal("application/problem+json"))
+	g.Expect(recorder.Body.String()).To(gomega.Equal(`{"title":"Not Acceptable","status":406,"requestId":"abc123"}` + "\n"))
+}
+
+func Test_should_serve_json_ld_before_plain_json(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	frame := func(v interface{}) interface{} {
+		return map[string]interface{}{"@context": "https://schema.org", "name": v}
+	}
+	n := negotiator.New(processor.JSONLD(frame), processor.JSON())
+
+	cases := []struct {
+		accept, contentType, body string
+	}{
+		{"application/ld+json", "application/ld+json", `{"@context":"https://schema.org","name":"Joe"}`},
+		{"application/vnd.api+json", "application/vnd.api+json; charset=utf-8", `"Joe"`},
+		{"application/json", "application/json; charset=utf-8", `"Joe"`},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set(negotiator.Accept, c.accept)
+		recorder := httptest.NewRecorder()
+
+		err := n.Negotiate(recorder, req,
+			negotiator.Of("Joe").As("application/ld+json"),
+			negotiator.Of("Joe").As("application/vnd.api+json"),
+			negotiator.Of("Joe").As("application/json"))
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK), c.accept)
+		g.Expect(recorder.Header().Get("Content-Type")).To(gomega.Equal(c.contentType), c.accept)
+		g.Expect(recorder.Body.String()).To(gomega.Equal(c.body+"\n"), c.accept)
+	}
+}
+
+// A request without an Accept header chooses the first offer that a processor can render,
+// in offer order, after any default subtypes.
+func Test_should_choose_first_renderable_offer_when_accept_is_empty(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.JSON(), processor.XML(), processor.TXT())
+
+	blank := negotiator.Of("blank")
+	png := negotiator.Of("png").As("image/png")
+	xml := negotiator.Of("xml").As("application/xml")
+	txt := negotiator.Of("txt").As("text/plain")
+	anyText := negotiator.Of("any text").As("text/*")
+
+	// an empty Accept header is the same as "*/*", unless there is a default
+	both := []string{"", "*/*"}
+	empty := []string{""}
+
+	cases := []struct {
+		n           *negotiator.Negotiator
+		accepts     []string
+		offers      []negotiator.Offer
+		contentType string
+	}{
+		{n, both, []negotiator.Offer{xml, blank}, "application/xml; charset=utf-8"},
+		{n, both, []negotiator.Offer{blank, xml}, "application/json; charset=utf-8"},
+		{n, both, []negotiator.Offer{png, txt, xml}, "text/plain; charset=utf-8"},
+		{n, both, []negotiator.Offer{anyText, xml}, "text/plain; charset=utf-8"},
+		{n.WithDefaultSubtypes("application/xml"), both, []negotiator.Offer{blank, txt, xml}, "application/xml; charset=utf-8"},
+		{n.WithDefaultSubtypes("application/xml"), both, []negotiator.Offer{png, txt}, "text/plain; charset=utf-8"},
+		{n.WithDefaultAccept("text/plain"), empty, []negotiator.Offer{xml, txt}, "text/plain; charset=utf-8"},
+		{n.WithDefaultAccept("text/plain"), empty, []negotiator.Offer{xml, blank}, "application/json; charset=utf-8"},
+		{n.WithDefaultAccept("application/*").WithDefaultSubtypes("application/xml"), empty, []negotiator.Offer{txt, xml}, "application/xml; charset=utf-8"},
+	}
+
+	for i, c := range cases {
+		for _, accept := range c.accepts {
+			req, _ := http.NewRequest("GET", "/", nil)
+			if accept != "" {
+				req.Header.Set(negotiator.Accept, accept)
+			}
+			recorder := httptest.NewRecorder()
+
+			err := c.n.Negotiate(recorder, req, c.offers...)
+
+			g.Expect(err).NotTo(gomega.HaveOccurred())
+			g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK), "%d %q", i, accept)
+			g.Expect(recorder.Header().Get("Content-Type")).To(gomega.Equal(c.contentType), "%d %q", i, accept)
+		}
+	}
+}
+
+func Test_should_use_csv_delimiter_from_accept_header(t *testing.T) {
+	g := gomega.NewWithT(t)
+	testLogger(t)
+	n := negotiator.New(processor.JSON(), processor.CSV())
+
+	cases := []struct {
+		accept, expected string
+	}{
+		{"text/csv", "a,b\n1,2\n"},
+		{"text/csv; delimiter=%3B", "a;b\n1;2\n"},
+		{"text/csv; sep=tab", "a\tb\n1\t2\n"},
+		{"text/csv; delimiter=%00", "a,b\n1,2\n"},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set(negotiator.Accept, c.accept)
+		recorder := httptest.NewRecorder()
+
+		err := n.Negotiate(recorder, req, negotiator.Of([][]string{{"a", "b"}, {"1", "2"}}).As("text/csv"))
+
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Header().Get("Content-Type")).To(gomega.Equal("text/csv; charset=utf-8"), c.accept)
+		g.Expect(recorder.Body.String()).To(gomega.Equal(c.expected), c.accept)
+	}
+}
+
+//-------------------------------------------------------------------------------------------------
+
+type fakeProcessor struct {
+	match string
+	err   error
+}
+
+func (p *fakeProcessor) ContentType() string {
+	return p.match
+}
+
+func (p *fakeProcessor) CanProcess(mediaRange string, lang string) bool {
+	return mediaRange == p.match && (lang == "*" || lang == "en")
+}
+
+func (p *fakeProcessor) Process(w http.ResponseWriter, _ string, data interface{}) error {
+	if p.err != nil {
+		return p.err
+	}
+	_, err := w.Write([]byte(fmt.Sprintf("%s | %v", p.match, data)))
+	return err
+}
+
+// headerWritingProcessor misbehaves by calling WriteHeader itself.
+type headerWritingProcessor struct{}
+
+func (p *headerWritingProcessor) ContentType() string {
+	return "text/plain"
+}
+
+func (p *headerWritingProcessor) CanProcess(mediaRange string, lang string) bool {
+	return mediaRange == "text/plain"
+}
+
+func (p *headerWritingProcessor) Process(w http.ResponseWriter, _ string, data interface{}) error {
+	w.WriteHeader(http.StatusTeapot)
+	_, err := io.WriteString(w, data.(string))
+	return err
+}
+
+func testLogger(t *testing.T) {
+	negotiator.Printer = func(level byte, message string, data map[string]interface{}) {
+		t.Log(negotiator.FormatEntry(level, message, data))
 	}
 }
 
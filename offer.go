@@ -1,16 +1,48 @@
 package negotiator
 
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rickb777/negotiator/processor"
+)
+
 const (
 	Accept         = "Accept"
 	AcceptLanguage = "Accept-Language"
 	AcceptCharset  = "Accept-Charset"
 
-	// AcceptEncoding is handled effectively by net/http and can be disregarded here
+	// ContentType is the request and response header for the media type of the body.
+	ContentType = "Content-Type"
+
+	// AcceptDatetime is the request header for the datetime of the wanted representation,
+	// and MementoDatetime is the response header with the datetime of the offer (RFC 7089).
+	AcceptDatetime  = "Accept-Datetime"
+	MementoDatetime = "Memento-Datetime"
+
+	// Prefer is the request header for preferences, e.g. "return=minimal" (RFC 7240).
+	Prefer = "Prefer"
+	// PreferenceApplied is the response header that confirms a preference was honoured.
+	PreferenceApplied = "Preference-Applied"
+
+	// Allow is the response header that lists the methods of a resource, e.g. for OPTIONS.
+	Allow = "Allow"
+
+	// AcceptEncoding is used only when encodings are enabled using WithEncoding.
+	AcceptEncoding = "Accept-Encoding"
 
 	XRequestedWith = "X-Requested-With"
 	XMLHttpRequest = "XMLHttpRequest"
+
+	// XAvailableTypes is the response header that lists the offered media types
+	// in 406-Not Acceptable responses.
+	XAvailableTypes = "X-Available-Types"
 )
 
+// Seq is a lazy source of values for streaming processors; see processor.Seq.
+type Seq = processor.Seq
+
 // Offer holds the set of parameters that are offered to the content negotiation.
 // Note that Data will be passed to a ResponseProcessor, having first checked
 //
@@ -19,20 +51,171 @@ const (
 //
 // * if it is a func() interface{}, that function will have been called
 //
+// * if it is a func(pref, language string) (interface{}, bool), that function will have been
+// called with the "return" preference from the Prefer request header (blank if absent) and
+// the chosen language. It reports whether it applied the preference; if so, the response has
+// a Preference-Applied header. The response always has a "Vary: Prefer" header.
+//
+// * if it is a func() Seq, that function will have been called, so that a lazy sequence,
+// e.g. over a database cursor, is only created for the offer that is chosen.
+//
 // The above checks are repeated until the data is neither kind of function.
 //
-// If the (resulting) data is nil, the response will have 204-Not Content status
-// instead of 200-OK.
+// A Seq is not itself dereferenced: it is passed to the processor, which consumes it. So
+// a provider function may return a Seq, e.g. func(lang string) interface{} can return a
+// Seq of rows in that language. Streaming processors, such as processor.YAMLStream, accept
+// a Seq as well as slices and channels; other processors do not. A Seq is never treated as
+// an empty collection by WithEmptyCollectionNoContent, because that would consume it.
+//
+// If the (resulting) data is nil or an empty []byte, the response will have 204-Not Content
+// status instead of 200-OK.
+//
+// Filename is used only when the chosen processor is processor.Downloadable; the response
+// will then have a "Content-Disposition: attachment" header with the filename.
+//
+// ContentType, if set, is used for the Content-Type response header instead of the content
+// type of the chosen processor. The processor still renders the data, so this allows one
+// processor to serve, say, "application/vnd.myco.user+json" and "application/json".
+//
+// MatchParams, if set, restricts the offer to accepted media ranges that have all of these
+// parameters, e.g. {"version": "2"} matches "Accept: application/json; version=2". So
+// offers can be distinguished by their parameters. Such an offer does not match media
+// ranges without the parameters, including "*/*"; add another offer without MatchParams
+// if a default is needed. Parameter names and values are compared ignoring case. Any
+// parameters before the quality can be used, such as "level" in "text/html;level=1".
+//
+// Languages, if set, lists other languages that the content also contains, e.g. for a
+// bilingual document. These are not used for negotiation, which uses only Language, but
+// they are appended to the Content-Language response header, e.g. "en, fr".
+//
+// When, if set, is a predicate that decides whether the offer is considered at all for
+// a request, e.g. so that an experimental media type is only offered to beta users. It is
+// evaluated before matching. RenderValues has no request, so offers with a predicate are
+// never considered by it.
+//
+// PreEncoded, if set, is the content coding that has already been applied to the data,
+// e.g. "gzip" for a cached compressed blob; the data must then be a []byte. It is written
+// verbatim with a matching Content-Encoding header, instead of being rendered by the
+// processor, provided that the client accepts the coding. Otherwise, see WithDecoding.
+//
+// Encodings, if set, holds pre-encoded variants of the data keyed by content coding, e.g.
+// {"br": ..., "gzip": ..., "identity": ...}. The variant that the client prefers according
+// to Accept-Encoding is written verbatim with a matching Content-Encoding header; when
+// preferences are equal, the smallest variant is chosen. If no encoded variant is
+// acceptable, the "identity" variant is written, or else the Data is rendered as usual.
+// Data may be nil if there is an "identity" variant.
+//
+// ETag, if set, is the entity tag of the data, which is sent in the ETag response header.
+// It is quoted if necessary. See WithConditionalRequests.
+//
+// Datetime, if set, is the time of this version of the data. The response will then have
+// a Memento-Datetime header. See WithDatetimeNegotiation.
 type Offer struct {
-	MediaType string // e.g. "text/html" or blank not relevant
-	Language  string // blank if not relevant
-	Template  string // blank if not relevant
-	Data      interface{}
+	MediaType   string    // e.g. "text/html" or blank not relevant
+	Language    string    // blank if not relevant
+	Languages   []string  // nil unless the content is multilingual
+	Template    string    // blank if not relevant
+	Filename    string    // blank if not relevant
+	ContentType string    // blank to use the processor's content type
+	Datetime    time.Time // zero if not relevant
+	MatchParams map[string]string
+	When        func(*http.Request) bool
+	PreEncoded  string            // blank unless Data is already encoded
+	Encodings   map[string][]byte // nil unless there are pre-encoded variants
+	ETag        string            // blank if not relevant
+	Data        interface{}
+}
+
+// Of creates an offer for some data. The media type, language and so on can be set using
+// the fluent methods, e.g.
+//
+//	negotiator.Of(data).As("application/json").In("en")
+//
+// This is equivalent to using an Offer struct literal.
+func Of(data interface{}) Offer {
+	return Offer{Data: data}
+}
+
+// As sets the media type of the offer.
+func (o Offer) As(mediaType string) Offer {
+	o.MediaType = mediaType
+	return o
+}
+
+// In sets the language of the offer.
+func (o Offer) In(language string) Offer {
+	o.Language = language
+	return o
+}
+
+// AlsoIn sets the other languages that the content of the offer contains.
+func (o Offer) AlsoIn(languages ...string) Offer {
+	o.Languages = languages
+	return o
+}
+
+// WithTemplate sets the template name of the offer.
+func (o Offer) WithTemplate(template string) Offer {
+	o.Template = template
+	return o
+}
+
+// WithFilename sets the download filename of the offer.
+func (o Offer) WithFilename(filename string) Offer {
+	o.Filename = filename
+	return o
+}
+
+// WithContentType sets the Content-Type of the response, overriding that of the processor.
+func (o Offer) WithContentType(contentType string) Offer {
+	o.ContentType = contentType
+	return o
+}
+
+// EncodedWith sets the content coding that has already been applied to the data.
+func (o Offer) EncodedWith(coding string) Offer {
+	o.PreEncoded = coding
+	return o
+}
+
+// WithEncodings sets the pre-encoded variants of the offer, keyed by content coding.
+func (o Offer) WithEncodings(encodings map[string][]byte) Offer {
+	o.Encodings = encodings
+	return o
+}
+
+// WithETag sets the entity tag of the offer.
+func (o Offer) WithETag(etag string) Offer {
+	o.ETag = etag
+	return o
+}
+
+// At sets the datetime of the offer.
+func (o Offer) At(datetime time.Time) Offer {
+	o.Datetime = datetime
+	return o
+}
+
+// WithMatchParams sets the media range parameters that the offer requires.
+func (o Offer) WithMatchParams(params map[string]string) Offer {
+	o.MatchParams = params
+	return o
+}
+
+// If sets the predicate that decides whether the offer is considered for a request.
+func (o Offer) If(when func(*http.Request) bool) Offer {
+	o.When = when
+	return o
 }
 
 // Offers is a slice of Offer.
 type Offers []Offer
 
+// Add appends more offers, returning the extended slice.
+func (offers Offers) Add(more ...Offer) Offers {
+	return append(offers, more...)
+}
+
 // MediaTypes gets the media types from the offers, keeping the same order.
 func (offers Offers) MediaTypes() []string {
 	ss := make([]string, len(offers))
@@ -42,6 +225,99 @@ func (offers Offers) MediaTypes() []string {
 	return ss
 }
 
+// Dedup removes the offers that duplicate an earlier one, keeping the first occurrence of
+// each media type and language, which is the one that negotiation would choose anyway.
+// Media types and languages are compared ignoring case, and a blank is the same as a
+// wildcard. Offers that differ in their MatchParams are not duplicates; nor are offers with
+// a When predicate, because the earlier one may not be considered for some requests.
+// See also WithDedupOffers.
+func (offers Offers) Dedup() Offers {
+	deduped := make(Offers, 0, len(offers))
+	for _, o := range offers {
+		if !deduped.containsDuplicateOf(o) {
+			deduped = append(deduped, o)
+		}
+	}
+	return deduped
+}
+
+func (offers Offers) containsDuplicateOf(o Offer) bool {
+	if o.When != nil {
+		return false
+	}
+
+	od := o.withDefaultWildcards()
+	for _, x := range offers {
+		xd := x.withDefaultWildcards()
+		if x.When == nil &&
+			xd.normalisedMediaType() == od.normalisedMediaType() &&
+			strings.EqualFold(strings.TrimSpace(xd.Language), strings.TrimSpace(od.Language)) &&
+			sameMatchParams(x.MatchParams, o.MatchParams) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameMatchParams tests whether two sets of parameters are the same, ignoring case.
+func sameMatchParams(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for ka, va := range a {
+		found := false
+		for kb, vb := range b {
+			if strings.EqualFold(ka, kb) && strings.EqualFold(va, vb) {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// distinctMediaTypes gets the media types of the offers that are not blank or wildcards,
+// without duplicates, keeping the same order.
+func (offers Offers) distinctMediaTypes() []string {
+	var ss []string
+	for _, o := range offers {
+		if o.MediaType != "" && strings.IndexByte(o.MediaType, '*') < 0 {
+			ss = appendUnique(ss, o.MediaType)
+		}
+	}
+	return ss
+}
+
+// normalisedMediaType gets the media type in lowercase without surrounding whitespace,
+// which is how it is matched. The original is retained for anything that is echoed.
+func (o Offer) normalisedMediaType() string {
+	return strings.ToLower(strings.TrimSpace(o.MediaType))
+}
+
+// selectWhen removes the offers whose predicate is not satisfied by the request.
+func (offers Offers) selectWhen(req *http.Request) Offers {
+	for i, o := range offers {
+		if o.When != nil && (req == nil || !o.When(req)) {
+			return offers.doSelectWhen(req, i)
+		}
+	}
+	// no need to change anything
+	return offers
+}
+
+func (offers Offers) doSelectWhen(req *http.Request, first int) Offers {
+	selected := make(Offers, first, len(offers))
+	copy(selected, offers[:first])
+	for _, o := range offers[first+1:] {
+		if o.When == nil || (req != nil && o.When(req)) {
+			selected = append(selected, o)
+		}
+	}
+	return selected
+}
+
 func (offers Offers) setDefaultWildcards() Offers {
 	for _, o := range offers {
 		// if any have blanks, update all that are blank
@@ -56,25 +332,39 @@ func (offers Offers) setDefaultWildcards() Offers {
 func (offers Offers) doSetDefaultWildcards() Offers {
 	ss := make(Offers, len(offers))
 	for i, o := range offers {
-		if o.MediaType == "" {
-			o.MediaType = "*/*"
-		}
-		if o.Language == "" {
-			o.Language = "*"
-		}
-		ss[i] = o
+		ss[i] = o.withDefaultWildcards()
 	}
 	return ss
 }
 
-func dereferenceDataProviders(data interface{}, lang string) interface{} {
+func (o Offer) withDefaultWildcards() Offer {
+	if o.MediaType == "" {
+		o.MediaType = "*/*"
+	}
+	if o.Language == "" {
+		o.Language = "*"
+	}
+	return o
+}
+
+// dereferenceDataProviders calls any data provider functions. It also reports whether the
+// preference was used by a provider, so the response varies on it, and whether the provider
+// applied it.
+func dereferenceDataProviders(data interface{}, lang, pref string) (result interface{}, usedPref, applied bool) {
 	for {
 		if fn, ok := data.(func() interface{}); ok {
 			data = fn()
 		} else if fn, ok := data.(func(string) interface{}); ok {
 			data = fn(lang)
+		} else if fn, ok := data.(func(string, string) (interface{}, bool)); ok {
+			var ok bool
+			data, ok = fn(pref, lang)
+			usedPref = true
+			applied = applied || (ok && pref != "")
+		} else if fn, ok := data.(func() Seq); ok {
+			data = fn()
 		} else {
-			return data
+			return data, usedPref, applied
 		}
 	}
 }
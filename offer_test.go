@@ -0,0 +1,75 @@
+package negotiator_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/onsi/gomega"
+	"github.com/rickb777/negotiator"
+)
+
+func Test_offer_builder_should_match_struct_literal(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	o := negotiator.Of("foo").As("application/json").In("en").AlsoIn("fr").WithTemplate("show").WithFilename("foo.json").
+		WithContentType("application/vnd.foo+json")
+
+	g.Expect(o).To(gomega.Equal(negotiator.Offer{
+		Data:        "foo",
+		MediaType:   "application/json",
+		Language:    "en",
+		Languages:   []string{"fr"},
+		Template:    "show",
+		Filename:    "foo.json",
+		ContentType: "application/vnd.foo+json",
+	}))
+}
+
+func Test_offer_builder_should_not_alter_original(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	base := negotiator.Of("foo").In("en")
+	json := base.As("application/json")
+	xml := base.As("application/xml")
+
+	g.Expect(base.MediaType).To(gomega.Equal(""))
+	g.Expect(json.MediaType).To(gomega.Equal("application/json"))
+	g.Expect(xml.MediaType).To(gomega.Equal("application/xml"))
+}
+
+func Test_offers_should_accumulate(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	var offers negotiator.Offers
+	offers = offers.Add(negotiator.Of("a").As("text/csv"))
+	offers = offers.Add(negotiator.Of("b").As("text/plain"), negotiator.Offer{Data: "c"})
+
+	g.Expect(offers.MediaTypes()).To(gomega.Equal([]string{"text/csv", "text/plain", ""}))
+}
+
+func Test_offers_should_dedup(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	always := func(*http.Request) bool { return true }
+	offers := negotiator.Offers{
+		negotiator.Of("a").As("text/csv").In("en"),
+		negotiator.Of("b").As("text/plain"),
+		negotiator.Of("c").As("Text/CSV").In("EN"),
+		negotiator.Of("d").As("text/plain").In("*"),
+		negotiator.Of("e").As("text/csv").In("fr"),
+		negotiator.Of("f").As("text/csv").In("en").WithMatchParams(map[string]string{"version": "2"}),
+		negotiator.Of("g").As("text/csv").In("en").WithMatchParams(map[string]string{"Version": "2"}),
+		negotiator.Of("h").As("text/csv").In("en").If(always),
+		negotiator.Of("i"),
+		negotiator.Of("j").As("*/*"),
+	}
+
+	deduped := offers.Dedup()
+
+	var data []interface{}
+	for _, o := range deduped {
+		data = append(data, o.Data)
+	}
+	g.Expect(data).To(gomega.Equal([]interface{}{"a", "b", "e", "f", "h", "i"}))
+	g.Expect(offers).To(gomega.HaveLen(10))
+}
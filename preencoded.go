@@ -0,0 +1,130 @@
+package negotiator
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/rickb777/negotiator/encoding"
+	"github.com/rickb777/negotiator/header"
+)
+
+// WithDecoding sets the codings that can be used to decode pre-encoded offers (see
+// Offer.PreEncoded) for clients that do not accept their coding, e.g.
+//
+//	n.WithDecoding(encoding.Gzip)
+//
+// Each coding needs a NewReader function. The decoded response may then be compressed
+// again if WithEncoding is also used. Without a suitable coding, such clients get a
+// 406-Not Acceptable response instead.
+func (n *Negotiator) WithDecoding(codings ...encoding.Coding) *Negotiator {
+	c := n.Clone()
+	c.decoders = append(c.decoders, codings...)
+	return c
+}
+
+// preEncoded sets up the renderer for an offer whose data is already encoded. If the client
+// accepts the coding, the data is written verbatim. Otherwise it is decoded if possible.
+func (n *Negotiator) preEncoded(rv requestValues, r *renderer) CodedRender {
+	name := r.offer.PreEncoded
+	r.vary = append(r.vary, AcceptEncoding)
+
+	if encoding.Accepts(header.Parse(rv.acceptEncoding), name) {
+		r.contentEncoding = name
+		r.process = writeVerbatim
+		return r
+	}
+
+	for _, c := range n.decoders {
+		if c.NewReader != nil && strings.EqualFold(c.Name, name) {
+			r.process = decoder(c)
+			return r
+		}
+	}
+
+	info2("406 rejected", "Accept-Encoding", rv.acceptEncoding, "PreEncoded", name)
+	return n.unacceptable(rv, Offers{r.offer}, EncodingMismatch)
+}
+
+// encodedVariant sets up the renderer for an offer with pre-encoded variants. The variant
+// that the client prefers is written verbatim; of those equally preferred, the smallest is
+// chosen. Otherwise, the identity variant or the data is used.
+func (n *Negotiator) encodedVariant(rv requestValues, r *renderer) CodedRender {
+	r.vary = append(r.vary, AcceptEncoding)
+
+	variants := make([]encoding.Coding, 0, len(r.offer.Encodings))
+	for name := range r.offer.Encodings {
+		if !strings.EqualFold(name, encoding.Identity.Name) {
+			variants = append(variants, encoding.Coding{Name: name})
+		}
+	}
+
+	sort.Slice(variants, func(i, j int) bool {
+		li, lj := len(r.offer.Encodings[variants[i].Name]), len(r.offer.Encodings[variants[j].Name])
+		return li < lj || (li == lj && variants[i].Name < variants[j].Name)
+	})
+
+	chosen := encoding.Select(header.Parse(rv.acceptEncoding), variants)
+	if chosen.Name != encoding.Identity.Name {
+		r.contentEncoding = chosen.Name
+		r.data = r.offer.Encodings[chosen.Name]
+		r.process = writeVerbatim
+		return r
+	}
+
+	for name, b := range r.offer.Encodings {
+		if strings.EqualFold(name, encoding.Identity.Name) {
+			r.data = b
+			r.process = writeVerbatim
+			return r
+		}
+	}
+
+	if r.data == nil {
+		info2("406 rejected", "Accept-Encoding", rv.acceptEncoding, "Encodings", len(r.offer.Encodings))
+		return n.unacceptable(rv, Offers{r.offer}, EncodingMismatch)
+	}
+
+	return r
+}
+
+func writeVerbatim(w http.ResponseWriter, _ string, dataModel interface{}) error {
+	b, err := preEncodedBytes(dataModel)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func decoder(c encoding.Coding) func(http.ResponseWriter, string, interface{}) error {
+	return func(w http.ResponseWriter, _ string, dataModel interface{}) error {
+		b, err := preEncodedBytes(dataModel)
+		if err != nil {
+			return err
+		}
+
+		rc, err := c.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(w, rc)
+		if err != nil {
+			rc.Close()
+			return err
+		}
+		return rc.Close()
+	}
+}
+
+func preEncodedBytes(dataModel interface{}) ([]byte, error) {
+	b, ok := dataModel.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("Unsupported type for pre-encoded data: %T", dataModel)
+	}
+	return b, nil
+}
@@ -0,0 +1,51 @@
+package negotiator
+
+import (
+	"net/http"
+)
+
+// PreparedNegotiation holds a fixed set of offers that have been prepared once, e.g. at
+// startup, so that each request only needs its headers to be parsed and matched. It is
+// created by Prepare and is safe for concurrent use, provided the offers' data are too.
+type PreparedNegotiation struct {
+	n      *Negotiator
+	offers Offers
+}
+
+// Prepare precomputes a fixed set of offers for a frequently-used endpoint. Blank media
+// types and languages are given their default wildcards once, rather than on every request,
+// and duplicates are removed now if WithDedupOffers is used. The outcome of rendering is
+// the same as for Render with the same offers.
+//
+// The offers are reused for every request, so their data must not be consumed by rendering:
+// use a function that provides the data (see Offer) instead of a channel, a Seq or a reader.
+func (n *Negotiator) Prepare(offers ...Offer) *PreparedNegotiation {
+	prepared := make(Offers, len(offers))
+	for i, o := range offers {
+		prepared[i] = o.withDefaultWildcards()
+	}
+
+	c := n
+	if n.dedupOffers {
+		prepared = prepared.Dedup()
+		c = n.Clone()
+		c.dedupOffers = false
+	}
+
+	return &PreparedNegotiation{n: c, offers: prepared}
+}
+
+// Offers gets a copy of the prepared offers.
+func (p *PreparedNegotiation) Offers() Offers {
+	return append(Offers(nil), p.offers...)
+}
+
+// Render is like Negotiator.Render for the prepared offers.
+func (p *PreparedNegotiation) Render(req *http.Request) CodedRender {
+	return p.n.Render(req, p.offers...)
+}
+
+// Negotiate is like Negotiator.Negotiate for the prepared offers.
+func (p *PreparedNegotiation) Negotiate(w http.ResponseWriter, req *http.Request) error {
+	return p.n.Negotiate(w, req, p.offers...)
+}
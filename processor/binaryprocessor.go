@@ -0,0 +1,83 @@
+package processor
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const defaultBinaryContentType = "application/octet-stream"
+
+type binaryProcessor struct {
+	contentType string
+}
+
+// Binary creates a processor for content that has already been serialised, such as
+// protobuf messages or images loaded from storage. The model value should be a []byte or
+// an io.Reader, which is written verbatim; a reader is streamed using io.Copy and is closed
+// afterwards if it is an io.Closer. As usual, offers with nil data, or an empty []byte,
+// give 204-No Content responses.
+//
+// The content type is "application/octet-stream" unless it is changed using
+// ContentTypeSettable, e.g. to "image/png". CanProcess matches "application/octet-stream",
+// the media type of the content type and "*/*", so this processor should usually be the
+// last one, as a last resort.
+func Binary() ResponseProcessor {
+	return &binaryProcessor{contentType: defaultBinaryContentType}
+}
+
+func (p *binaryProcessor) ContentType() string {
+	return p.contentType
+}
+
+// WithContentType implements ContentTypeSettable for this type.
+func (p *binaryProcessor) WithContentType(contentType string) ResponseProcessor {
+	p.contentType = contentType
+	return p
+}
+
+func (p *binaryProcessor) CanProcess(mediaRange string, lang string) bool {
+	mediaType, _ := split(p.contentType, ';')
+	return mediaRange == "*/*" ||
+		strings.EqualFold(mediaRange, defaultBinaryContentType) ||
+		strings.EqualFold(mediaRange, strings.TrimSpace(mediaType))
+}
+
+func (p *binaryProcessor) Process(w http.ResponseWriter, template string, dataModel interface{}) error {
+	return p.RenderTo(w, template, dataModel)
+}
+
+// ValidateData implements Validator for this type.
+func (p *binaryProcessor) ValidateData(_ string, dataModel interface{}) error {
+	switch dataModel.(type) {
+	case []byte, io.Reader:
+		return nil
+	}
+	return fmt.Errorf("Unsupported type for binary: %T", dataModel)
+}
+
+// IsVerbatim implements Verbatim for this type.
+func (p *binaryProcessor) IsVerbatim() bool {
+	return true
+}
+
+// RenderTo implements Renderer for this type.
+func (p *binaryProcessor) RenderTo(w io.Writer, _ string, dataModel interface{}) error {
+	switch v := dataModel.(type) {
+	case []byte:
+		_, err := w.Write(v)
+		return err
+
+	case io.Reader:
+		_, err := io.Copy(w, v)
+		if c, ok := v.(io.Closer); ok {
+			if cerr := c.Close(); err == nil {
+				err = cerr
+			}
+		}
+		return err
+	}
+
+	return fmt.Errorf("Unsupported type for binary: %T", dataModel)
+}
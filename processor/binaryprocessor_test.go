@@ -0,0 +1,80 @@
+package processor_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/rickb777/negotiator/processor"
+)
+
+func TestBinaryShouldProcessAcceptHeader(t *testing.T) {
+	g := NewGomegaWithT(t)
+	var acceptTests = []struct {
+		acceptheader string
+		expected     bool
+	}{
+		{"application/octet-stream", true},
+		{"*/*", true},
+		{"image/png", false},
+		{"application/json", false},
+	}
+
+	p := processor.Binary()
+
+	for _, tt := range acceptTests {
+		result := p.CanProcess(tt.acceptheader, "")
+		g.Expect(result).To(Equal(tt.expected), "Should process "+tt.acceptheader)
+	}
+}
+
+func TestBinaryShouldSetContentType(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	p := processor.Binary().(processor.ContentTypeSettable).WithContentType("image/png")
+
+	g.Expect(p.ContentType()).To(Equal("image/png"))
+	g.Expect(p.CanProcess("image/png", "")).To(BeTrue())
+	g.Expect(p.CanProcess("application/octet-stream", "")).To(BeTrue())
+}
+
+func TestBinaryShouldWriteDataVerbatim(t *testing.T) {
+	g := NewGomegaWithT(t)
+	models := []interface{}{
+		[]byte("\x00\x01\xff"),
+		bytes.NewReader([]byte("\x00\x01\xff")),
+		ioutil.NopCloser(strings.NewReader("\x00\x01\xff")),
+	}
+
+	p := processor.Binary()
+
+	for _, m := range models {
+		recorder := httptest.NewRecorder()
+		err := p.Process(recorder, "", m)
+
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(recorder.Body.Bytes()).To(Equal([]byte("\x00\x01\xff")))
+	}
+}
+
+func TestBinaryShouldReturnErrorForUnsupportedType(t *testing.T) {
+	g := NewGomegaWithT(t)
+	recorder := httptest.NewRecorder()
+
+	p := processor.Binary()
+
+	g.Expect(p.Process(recorder, "", "text")).To(HaveOccurred())
+	g.Expect(p.(processor.Validator).ValidateData("", "text")).To(HaveOccurred())
+	g.Expect(p.(processor.Validator).ValidateData("", []byte{1})).NotTo(HaveOccurred())
+}
+
+func TestBinaryShouldBeVerbatim(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(processor.Binary().(processor.Verbatim).IsVerbatim()).To(BeTrue())
+	g.Expect(processor.Suffixed(processor.Binary(), "cbor").(processor.Verbatim).IsVerbatim()).To(BeTrue())
+	g.Expect(processor.Suffixed(processor.JSON(), "json").(processor.Verbatim).IsVerbatim()).To(BeFalse())
+}
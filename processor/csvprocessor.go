@@ -1,20 +1,41 @@
 package processor
 
 import (
+	"bytes"
 	"encoding/csv"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"reflect"
 	"strings"
+	"unicode/utf8"
+
+	"github.com/rickb777/negotiator/header"
+)
+
+const (
+	defaultCSVContentType = "text/csv; charset=utf-8"
+	tsvMediaType          = "text/tab-separated-values"
 )
 
-const defaultCSVContentType = "text/csv; charset=utf-8"
+// CSVMarshaler is implemented by types that provide their own CSV row, for example to
+// format dates or money specially or to control the order of the columns. The CSV
+// processor uses it instead of reflecting over the fields.
+type CSVMarshaler interface {
+	MarshalCSV() ([]string, error)
+}
 
 type csvProcessor struct {
 	comma       rune
 	contentType string
+	aligned     bool
+	bom         bool
+	columns     []string
 }
 
+const utf8BOM = "\xEF\xBB\xBF"
+
 // CSV creates an output processor that serialises a dataModel in CSV form. With no arguments, the default
 // format is comma-separated; you can supply any rune to be used as an alternative separator.
 //
@@ -31,11 +52,25 @@ type csvProcessor struct {
 // * struct for some struct in which all the fields are exported and of simple types (as above).
 //
 // * []struct for some struct in which all the fields are exported and of simple types (as above).
+//
+// * CSVMarshaler or []CSVMarshaler, for which each value provides one row.
+//
+// The processor also handles "text/tab-separated-values". When that media type is matched,
+// it is used for the Content-Type and the separator is a tab.
 func CSV(comma ...rune) ResponseProcessor {
 	if len(comma) > 0 {
-		return &csvProcessor{comma[0], defaultCSVContentType}
+		return &csvProcessor{comma: comma[0], contentType: defaultCSVContentType}
 	}
-	return &csvProcessor{',', defaultCSVContentType}
+	return &csvProcessor{comma: ',', contentType: defaultCSVContentType}
+}
+
+// CSVColumns creates an output processor like CSV, except that struct values, or slices or
+// arrays of structs, are written with a header row followed by only the named columns, in
+// the given order. Each name is either a field name or the name in the field's "csv" tag,
+// e.g. `csv:"id"`. A name that matches no exported field is an error when rendering.
+// Other model values are written as for CSV.
+func CSVColumns(names ...string) ResponseProcessor {
+	return &csvProcessor{comma: ',', contentType: defaultCSVContentType, columns: names}
 }
 
 func (p *csvProcessor) ContentType() string {
@@ -48,16 +83,149 @@ func (p *csvProcessor) WithContentType(contentType string) ResponseProcessor {
 	return p
 }
 
+// WithAlignedColumns implements TableSettable for this type. When enabled, each field is
+// padded with trailing spaces to the width of the widest value in its column, which is
+// handy when debugging with curl. By default, the output is compact.
+func (p *csvProcessor) WithAlignedColumns(aligned bool) ResponseProcessor {
+	p.aligned = aligned
+	return p
+}
+
+// WithBOM implements BOMSettable for this type. When enabled, the output starts with a
+// UTF-8 byte-order mark so that Excel reads non-ASCII text correctly. By default, there
+// is no byte-order mark.
+func (p *csvProcessor) WithBOM(bom bool) ResponseProcessor {
+	p.bom = bom
+	return p
+}
+
+// IsDownload implements Downloadable for this type.
+func (*csvProcessor) IsDownload() bool {
+	return true
+}
+
+// ForMediaRange implements MediaRangeAware for this type. A "delimiter" or "sep" parameter
+// in the matched media range chooses the separator, e.g. "text/csv; delimiter=%3B" for
+// semicolons. The value may be percent-encoded; "tab" is also allowed. Values that are not
+// a single valid separator are ignored.
+func (p *csvProcessor) ForMediaRange(matched header.MediaRange) ResponseProcessor {
+	tsv := strings.EqualFold(matched.Type+"/"+matched.Subtype, tsvMediaType)
+	comma, ok := delimiterParam(matched.Params)
+	if !tsv && !ok {
+		return p
+	}
+
+	cp := *p
+	if tsv {
+		cp.comma = '\t'
+		cp.contentType = replaceMediaType(p.contentType, tsvMediaType)
+	}
+	if ok {
+		cp.comma = comma
+	}
+	return &cp
+}
+
+// delimiterParam gets the separator from a "delimiter" or "sep" media type parameter.
+func delimiterParam(params []header.KV) (rune, bool) {
+	for _, kv := range params {
+		key := strings.TrimSpace(kv.Key)
+		if !strings.EqualFold(key, "delimiter") && !strings.EqualFold(key, "sep") {
+			continue
+		}
+
+		value, err := url.PathUnescape(strings.Trim(strings.TrimSpace(kv.Value), `"`))
+		if err != nil {
+			return 0, false
+		}
+		if strings.EqualFold(value, "tab") {
+			return '\t', true
+		}
+
+		r, size := utf8.DecodeRuneInString(value)
+		if size != len(value) || !validDelimiter(r) {
+			return 0, false
+		}
+		return r, true
+	}
+	return 0, false
+}
+
+// validDelimiter tests whether a rune is allowed as a separator by encoding/csv.
+func validDelimiter(r rune) bool {
+	return r != 0 && r != '"' && r != '\r' && r != '\n' && utf8.ValidRune(r) && r != utf8.RuneError
+}
+
 func (*csvProcessor) CanProcess(mediaRange string, lang string) bool {
-	return strings.EqualFold(mediaRange, "text/csv") || strings.EqualFold(mediaRange, "text/*")
+	return strings.EqualFold(mediaRange, "text/csv") ||
+		strings.EqualFold(mediaRange, tsvMediaType) ||
+		strings.EqualFold(mediaRange, "text/*")
+}
+
+func (p *csvProcessor) Process(w http.ResponseWriter, template string, dataModel interface{}) error {
+	return p.RenderTo(w, template, dataModel)
 }
 
-func (p *csvProcessor) Process(w http.ResponseWriter, _ string, dataModel interface{}) error {
+// RenderTo implements Renderer for this type.
+func (p *csvProcessor) RenderTo(w io.Writer, _ string, dataModel interface{}) error {
+	if p.bom {
+		_, err := io.WriteString(w, utf8BOM)
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.aligned {
+		return p.renderAligned(w, dataModel)
+	}
+
 	writer := csv.NewWriter(w)
 	writer.Comma = p.comma
 	return p.flush(writer, p.process(writer, dataModel))
 }
 
+// renderAligned writes the compact form to a buffer, then reads it back so that the fields
+// can be padded before they are written.
+func (p *csvProcessor) renderAligned(w io.Writer, dataModel interface{}) error {
+	buf := &bytes.Buffer{}
+	writer := csv.NewWriter(buf)
+	writer.Comma = p.comma
+	err := p.flush(writer, p.process(writer, dataModel))
+	if err != nil {
+		return err
+	}
+
+	reader := csv.NewReader(buf)
+	reader.Comma = p.comma
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return err
+	}
+
+	var widths []int
+	for _, row := range rows {
+		for i, field := range row {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			if n := utf8.RuneCountInString(field); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	for _, row := range rows {
+		for i := 0; i < len(row)-1; i++ {
+			row[i] += strings.Repeat(" ", widths[i]-utf8.RuneCountInString(row[i]))
+		}
+	}
+
+	writer = csv.NewWriter(w)
+	writer.Comma = p.comma
+	return p.flush(writer, writer.WriteAll(rows))
+}
+
 var debug = func(msg string, args ...interface{}) {}
 
 //var debug = fmt.Printf
@@ -72,11 +240,19 @@ func (p *csvProcessor) process(writer *csv.Writer, dataModel interface{}) error
 		return writer.Write(v)
 	case [][]string:
 		return writer.WriteAll(v)
+	case CSVMarshaler:
+		return writeCSVMarshaler(writer, v)
 	}
 
 	value := reflect.Indirect(reflect.ValueOf(dataModel))
 	debug("  is %v\n", value.Kind())
 
+	if len(p.columns) > 0 {
+		if t, ok := structType(value); ok {
+			return p.writeColumns(writer, value, t)
+		}
+	}
+
 	switch value.Kind() {
 	case reflect.Struct:
 		if value.NumField() == 0 {
@@ -90,6 +266,11 @@ func (p *csvProcessor) process(writer *csv.Writer, dataModel interface{}) error
 			return nil // nothing to write
 		}
 
+		if _, ok := asCSVMarshaler(value.Index(0)); ok {
+			debug("    -- containing CSVMarshalers\n")
+			return writeArrayOfCSVMarshalers(writer, value)
+		}
+
 		v0 := reflect.Indirect(value.Index(0))
 		k0 := v0.Kind()
 
@@ -145,6 +326,112 @@ func (p *csvProcessor) process(writer *csv.Writer, dataModel interface{}) error
 	return fmt.Errorf("Unsupported type for CSV: %T", dataModel)
 }
 
+var csvMarshalerType = reflect.TypeOf((*CSVMarshaler)(nil)).Elem()
+
+// structType gets the struct type of a struct value, or of the elements of a slice or array.
+// CSVMarshalers are excluded because they provide their own columns.
+func structType(value reflect.Value) (reflect.Type, bool) {
+	if !value.IsValid() {
+		return nil, false
+	}
+
+	t := value.Type()
+	if t.Kind() == reflect.Array || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	ok := t.Kind() == reflect.Struct && !reflect.PtrTo(t).Implements(csvMarshalerType)
+	return t, ok
+}
+
+// writeColumns writes the header row, then the selected columns of each struct.
+func (p *csvProcessor) writeColumns(writer *csv.Writer, value reflect.Value, t reflect.Type) error {
+	indexes := make([]int, len(p.columns))
+	for i, name := range p.columns {
+		index, ok := columnIndex(t, name)
+		if !ok {
+			return fmt.Errorf("Unknown column for CSV: %q in %s", name, t)
+		}
+		indexes[i] = index
+	}
+
+	err := writer.Write(p.columns)
+	if err != nil {
+		return err
+	}
+
+	if value.Kind() == reflect.Struct {
+		return writeColumnFields(writer, value, indexes)
+	}
+
+	for j := 0; j < value.Len(); j++ {
+		err = writeColumnFields(writer, reflect.Indirect(value.Index(j)), indexes)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// columnIndex finds the exported field with a name, or with that name in its "csv" tag.
+func columnIndex(t reflect.Type, name string) (int, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue // unexported
+		}
+		tag, _ := split(f.Tag.Get("csv"), ',')
+		if f.Name == name || tag == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func writeColumnFields(writer *csv.Writer, str reflect.Value, indexes []int) error {
+	sa := make([]string, len(indexes))
+	for i, index := range indexes {
+		sa[i] = fmt.Sprintf("%v", reflect.Indirect(str.Field(index)))
+	}
+	return writer.Write(sa)
+}
+
+func asCSVMarshaler(v reflect.Value) (CSVMarshaler, bool) {
+	if m, ok := v.Interface().(CSVMarshaler); ok {
+		return m, true
+	}
+	if v.CanAddr() {
+		m, ok := v.Addr().Interface().(CSVMarshaler)
+		return m, ok
+	}
+	return nil, false
+}
+
+func writeCSVMarshaler(writer *csv.Writer, m CSVMarshaler) error {
+	row, err := m.MarshalCSV()
+	if err != nil {
+		return err
+	}
+	return writer.Write(row)
+}
+
+func writeArrayOfCSVMarshalers(writer *csv.Writer, value reflect.Value) error {
+	for j := 0; j < value.Len(); j++ {
+		m, ok := asCSVMarshaler(value.Index(j))
+		if !ok {
+			return fmt.Errorf("Unsupported type for CSV: %s", value.Index(j).Type())
+		}
+		err := writeCSVMarshaler(writer, m)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func writeArrayOfStructFields(writer *csv.Writer, value reflect.Value, dataModel interface{}) error {
 	for j := 0; j < value.Len(); j++ {
 		err := writeStructFields(writer, reflect.Indirect(value.Index(j)), dataModel)
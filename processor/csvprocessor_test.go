@@ -1,11 +1,15 @@
 package processor_test
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"net/http/httptest"
 	"testing"
 	"time"
 
 	. "github.com/onsi/gomega"
+	"github.com/rickb777/negotiator/header"
 	"github.com/rickb777/negotiator/processor"
 )
 
@@ -16,6 +20,7 @@ func TestCSVShouldProcessAcceptHeader(t *testing.T) {
 		expected     bool
 	}{
 		{"text/csv", true},
+		{"text/tab-separated-values", true},
 		{"text/*", true},
 		{"text/plain", false},
 	}
@@ -28,6 +33,73 @@ func TestCSVShouldProcessAcceptHeader(t *testing.T) {
 	}
 }
 
+func TestCSVShouldUseSeparatorForMatchedMediaType(t *testing.T) {
+	g := NewGomegaWithT(t)
+	models := []struct {
+		matched     header.MediaRange
+		contentType string
+		expected    string
+	}{
+		{header.MediaRange{Type: "text", Subtype: "csv"}, "text/csv; charset=utf-8", "a,b\n1,2\n"},
+		{header.MediaRange{Type: "text", Subtype: "tab-separated-values"}, "text/tab-separated-values; charset=utf-8", "a\tb\n1\t2\n"},
+		{header.MediaRange{Type: "text", Subtype: "*"}, "text/csv; charset=utf-8", "a,b\n1,2\n"},
+	}
+
+	p := processor.CSV()
+
+	for _, m := range models {
+		recorder := httptest.NewRecorder()
+		pm := p.(processor.MediaRangeAware).ForMediaRange(m.matched)
+		err := pm.Process(recorder, "", [][]string{{"a", "b"}, {"1", "2"}})
+
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(pm.ContentType()).To(Equal(m.contentType))
+		g.Expect(recorder.Body.String()).To(Equal(m.expected))
+	}
+
+	// the shared processor is unchanged
+	g.Expect(p.ContentType()).To(Equal("text/csv; charset=utf-8"))
+}
+
+func TestCSVShouldUseDelimiterParameter(t *testing.T) {
+	g := NewGomegaWithT(t)
+	csv := header.MediaRange{Type: "text", Subtype: "csv"}
+	models := []struct {
+		params   []header.KV
+		expected string
+	}{
+		{[]header.KV{{Key: "delimiter", Value: "%3b"}}, "a;b\n1;2\n"},
+		{[]header.KV{{Key: "sep", Value: "%3B"}}, "a;b\n1;2\n"},
+		{[]header.KV{{Key: "delimiter", Value: "|"}}, "a|b\n1|2\n"},
+		{[]header.KV{{Key: "delimiter", Value: "%09"}}, "a\tb\n1\t2\n"},
+		{[]header.KV{{Key: "Delimiter", Value: `"tab"`}}, "a\tb\n1\t2\n"},
+		{[]header.KV{{Key: "header", Value: "present"}, {Key: "delimiter", Value: "%3b"}}, "a;b\n1;2\n"},
+		{[]header.KV{{Key: "delimiter", Value: ";;"}}, "a,b\n1,2\n"},
+		{[]header.KV{{Key: "delimiter", Value: "%22"}}, "a,b\n1,2\n"},
+		{[]header.KV{{Key: "delimiter", Value: "%00"}}, "a,b\n1,2\n"},
+		{[]header.KV{{Key: "delimiter", Value: "%0d"}}, "a,b\n1,2\n"},
+		{[]header.KV{{Key: "delimiter", Value: "%0A"}}, "a,b\n1,2\n"},
+		{[]header.KV{{Key: "delimiter", Value: "%ff"}}, "a,b\n1,2\n"},
+		{[]header.KV{{Key: "delimiter", Value: "%ef%bf%bd"}}, "a,b\n1,2\n"},
+		{[]header.KV{{Key: "delimiter", Value: "%zz"}}, "a,b\n1,2\n"},
+		{[]header.KV{{Key: "delimiter", Value: ""}}, "a,b\n1,2\n"},
+		{nil, "a,b\n1,2\n"},
+	}
+
+	p := processor.CSV()
+
+	for _, m := range models {
+		recorder := httptest.NewRecorder()
+		csv.Params = m.params
+		pm := p.(processor.MediaRangeAware).ForMediaRange(csv)
+		err := pm.Process(recorder, "", [][]string{{"a", "b"}, {"1", "2"}})
+
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(pm.ContentType()).To(Equal("text/csv; charset=utf-8"))
+		g.Expect(recorder.Body.String()).To(Equal(m.expected), "%v", m.params)
+	}
+}
+
 func TestCSVShouldSetContentTypeHeader(t *testing.T) {
 	g := NewGomegaWithT(t)
 
@@ -36,6 +108,14 @@ func TestCSVShouldSetContentTypeHeader(t *testing.T) {
 	g.Expect(p.ContentType()).To(Equal("text/csv-schema"))
 }
 
+func TestCSVShouldBeDownloadable(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	p := processor.CSV().(processor.Downloadable)
+
+	g.Expect(p.IsDownload()).To(BeTrue())
+}
+
 func tt(y, m, d int) time.Time {
 	return time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.UTC)
 }
@@ -100,6 +180,18 @@ func TestCSVShouldSetResponseBodyWithTabs(t *testing.T) {
 	}
 }
 
+func TestCSVShouldRenderToWriter(t *testing.T) {
+	g := NewGomegaWithT(t)
+	buf := &bytes.Buffer{}
+
+	p := processor.CSV().(processor.Renderer)
+
+	err := p.RenderTo(buf, "", []Data{{"x", 9, 4, true}, {"y", 7, 1, false}})
+
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(buf.String()).To(Equal("x,9,4,true\ny,7,1,false\n"))
+}
+
 func TestCSVShouldReturnError(t *testing.T) {
 	g := NewGomegaWithT(t)
 	recorder := httptest.NewRecorder()
@@ -111,6 +203,147 @@ func TestCSVShouldReturnError(t *testing.T) {
 	g.Expect(err).To(HaveOccurred())
 }
 
+func TestCSVShouldUseCSVMarshaler(t *testing.T) {
+	g := NewGomegaWithT(t)
+	models := []struct {
+		stuff    interface{}
+		comma    rune
+		expected string
+	}{
+		{Money{"GBP", 1234}, ',', "12.34,GBP\n"},
+		{&Money{"EUR", 5}, ',', "0.05,EUR\n"},
+		{[]Money{{"GBP", 1234}, {"USD", 100}}, ',', "12.34,GBP\n1.00,USD\n"},
+		{[]*Money{{"GBP", 1234}, {"USD", 100}}, ',', "12.34,GBP\n1.00,USD\n"},
+		{[]Money{{"GBP", 1234}, {"USD", 100}}, '\t', "12.34\tGBP\n1.00\tUSD\n"},
+		{[]PtrMoney{{"GBP", 1234}, {"USD", 100}}, '\t', "12.34\tGBP\n1.00\tUSD\n"},
+	}
+
+	for _, m := range models {
+		recorder := httptest.NewRecorder()
+		err := processor.CSV(m.comma).Process(recorder, "", m.stuff)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(recorder.Body.String()).To(Equal(m.expected))
+	}
+}
+
+func TestCSVShouldReturnCSVMarshalerError(t *testing.T) {
+	g := NewGomegaWithT(t)
+	recorder := httptest.NewRecorder()
+
+	err := processor.CSV().Process(recorder, "", []Money{{"GBP", 1}, {"", 2}})
+
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestCSVShouldAlignColumns(t *testing.T) {
+	g := NewGomegaWithT(t)
+	models := []struct {
+		stuff    interface{}
+		comma    rune
+		expected string
+	}{
+		{[]Data{{"x", 9, 4, true}, {"yyy", 1234, 1, false}}, ',',
+			"x  ,9   ,4,true\nyyy,1234,1,false\n"},
+		{[][]string{{"Red", "Green", "Blue"}, {"Cyan", "Magenta"}}, '\t',
+			"Red \tGreen  \tBlue\nCyan\tMagenta\n"},
+		{[]string{"één", "a,b"}, ',', "één,\"a,b\"\n"},
+	}
+
+	for _, m := range models {
+		recorder := httptest.NewRecorder()
+		p := processor.CSV(m.comma).(processor.TableSettable).WithAlignedColumns(true)
+		err := p.Process(recorder, "", m.stuff)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(recorder.Body.String()).To(Equal(m.expected))
+	}
+}
+
+func TestCSVShouldWriteBOMOnce(t *testing.T) {
+	g := NewGomegaWithT(t)
+	models := []struct {
+		stuff    interface{}
+		expected string
+	}{
+		{"Zoë", "\xEF\xBB\xBFZoë\n"},
+		{[][]string{{"Zoë", "1"}, {"Åsa", "2"}}, "\xEF\xBB\xBFZoë,1\nÅsa,2\n"},
+		{[]Data{{"x", 9, 4, true}, {"y", 7, 1, false}}, "\xEF\xBB\xBFx,9,4,true\ny,7,1,false\n"},
+	}
+
+	p := processor.CSV().(processor.BOMSettable).WithBOM(true)
+
+	for _, m := range models {
+		recorder := httptest.NewRecorder()
+		err := p.Process(recorder, "", m.stuff)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(recorder.Body.String()).To(Equal(m.expected))
+	}
+}
+
+func TestCSVShouldNotWriteBOMByDefault(t *testing.T) {
+	g := NewGomegaWithT(t)
+	recorder := httptest.NewRecorder()
+
+	err := processor.CSV().Process(recorder, "", "Zoë")
+
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(recorder.Body.Bytes()[0]).To(Equal(byte('Z')))
+}
+
+func TestCSVColumnsShouldSelectAndOrderColumns(t *testing.T) {
+	g := NewGomegaWithT(t)
+	models := []struct {
+		p         processor.ResponseProcessor
+		dataModel interface{}
+		expected  string
+	}{
+		{processor.CSVColumns("F2", "F1"), []Data{{"x", 1, 2, true}, {"y", 3, 4, false}}, "F2,F1\n1,x\n3,y\n"},
+		{processor.CSVColumns("F4", "F2", "F1"), []*Data{{"x", 1, 2, true}}, "F4,F2,F1\ntrue,1,x\n"},
+		{processor.CSVColumns("F3"), &Data{"x", 1, 2, true}, "F3\n2\n"},
+		{processor.CSVColumns("id", "name"), []tagged{{Name: "Joe", ID: 7, Age: 42}}, "id,name\n7,Joe\n"},
+		{processor.CSVColumns("Age", "ID"), []tagged{{Name: "Joe", ID: 7, Age: 42}}, "Age,ID\n42,7\n"},
+		{processor.CSVColumns("F1"), []Data{}, "F1\n"},
+		{processor.CSVColumns("F1"), [][]string{{"a", "b"}}, "a,b\n"},
+		{processor.CSVColumns("F1"), []Money{{"GBP", 150}}, "1.50,GBP\n"},
+	}
+
+	for _, m := range models {
+		buf := &bytes.Buffer{}
+
+		err := m.p.(processor.Renderer).RenderTo(buf, "", m.dataModel)
+
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(buf.String()).To(Equal(m.expected))
+	}
+}
+
+func TestCSVColumnsShouldReturnErrorForUnknownColumn(t *testing.T) {
+	g := NewGomegaWithT(t)
+	recorder := httptest.NewRecorder()
+
+	err := processor.CSVColumns("F1", "F9").Process(recorder, "", []Data{{"x", 1, 2, true}})
+
+	g.Expect(err).To(MatchError(`Unknown column for CSV: "F9" in processor_test.Data`))
+}
+
+// Money has its amount before the currency, unlike the field order.
+type Money struct {
+	Currency string
+	Pence    int
+}
+
+func (m Money) MarshalCSV() ([]string, error) {
+	if m.Currency == "" {
+		return nil, errors.New("no currency")
+	}
+	return []string{fmt.Sprintf("%d.%02d", m.Pence/100, m.Pence%100), m.Currency}, nil
+}
+
+type PtrMoney Money
+
+func (m *PtrMoney) MarshalCSV() ([]string, error) {
+	return Money(*m).MarshalCSV()
+}
+
 type Data struct {
 	F1 string
 	F2 int
@@ -118,6 +351,12 @@ type Data struct {
 	F4 bool
 }
 
+type tagged struct {
+	Name string `csv:"name"`
+	ID   int    `csv:"id,omitempty"`
+	Age  int
+}
+
 // has hidden fields
 type hidden struct {
 	d time.Time
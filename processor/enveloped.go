@@ -0,0 +1,92 @@
+package processor
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/rickb777/negotiator/header"
+)
+
+type enveloped struct {
+	ResponseProcessor
+	wrap func(data interface{}) interface{}
+}
+
+// Enveloped wraps a processor so that the data model is transformed by the wrap function
+// before it is rendered, e.g. to put it in a standard envelope such as
+// {"data": ..., "meta": {...}}. The content type and serialisation are those of the wrapped
+// processor. Nil data is not wrapped; in any case, offers with nil data give 204-No Content
+// responses without using the processor.
+//
+// The wrapper passes on the Renderer, MediaRangeAware, LanguageAware, TemplateAware,
+// RequestAware, Validator and Downloadable capabilities of the wrapped processor. Other
+// settings should be applied to the wrapped processor before it is wrapped.
+func Enveloped(inner ResponseProcessor, wrap func(data interface{}) interface{}) ResponseProcessor {
+	return &enveloped{ResponseProcessor: inner, wrap: wrap}
+}
+
+func (p *enveloped) envelope(dataModel interface{}) interface{} {
+	if dataModel == nil {
+		return nil
+	}
+	return p.wrap(dataModel)
+}
+
+func (p *enveloped) Process(w http.ResponseWriter, template string, dataModel interface{}) error {
+	return p.ResponseProcessor.Process(w, template, p.envelope(dataModel))
+}
+
+// RenderTo implements Renderer for this type.
+func (p *enveloped) RenderTo(w io.Writer, template string, dataModel interface{}) error {
+	if r, ok := p.ResponseProcessor.(Renderer); ok {
+		return r.RenderTo(w, template, p.envelope(dataModel))
+	}
+	return fmt.Errorf("%T is not a Renderer", p.ResponseProcessor)
+}
+
+// ValidateData implements Validator for this type.
+func (p *enveloped) ValidateData(template string, dataModel interface{}) error {
+	if v, ok := p.ResponseProcessor.(Validator); ok {
+		return v.ValidateData(template, p.envelope(dataModel))
+	}
+	return nil
+}
+
+// ForMediaRange implements MediaRangeAware for this type.
+func (p *enveloped) ForMediaRange(matched header.MediaRange) ResponseProcessor {
+	if mra, ok := p.ResponseProcessor.(MediaRangeAware); ok {
+		return &enveloped{ResponseProcessor: mra.ForMediaRange(matched), wrap: p.wrap}
+	}
+	return p
+}
+
+// ForLanguage implements LanguageAware for this type.
+func (p *enveloped) ForLanguage(language string) ResponseProcessor {
+	if la, ok := p.ResponseProcessor.(LanguageAware); ok {
+		return &enveloped{ResponseProcessor: la.ForLanguage(language), wrap: p.wrap}
+	}
+	return p
+}
+
+// ForTemplate implements TemplateAware for this type.
+func (p *enveloped) ForTemplate(template string) ResponseProcessor {
+	if ta, ok := p.ResponseProcessor.(TemplateAware); ok {
+		return &enveloped{ResponseProcessor: ta.ForTemplate(template), wrap: p.wrap}
+	}
+	return p
+}
+
+// ForRequest implements RequestAware for this type.
+func (p *enveloped) ForRequest(req *http.Request) ResponseProcessor {
+	if ra, ok := p.ResponseProcessor.(RequestAware); ok {
+		return &enveloped{ResponseProcessor: ra.ForRequest(req), wrap: p.wrap}
+	}
+	return p
+}
+
+// IsDownload implements Downloadable for this type.
+func (p *enveloped) IsDownload() bool {
+	d, ok := p.ResponseProcessor.(Downloadable)
+	return ok && d.IsDownload()
+}
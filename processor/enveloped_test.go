@@ -0,0 +1,69 @@
+package processor_test
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/rickb777/negotiator/header"
+	"github.com/rickb777/negotiator/processor"
+)
+
+func envelope(data interface{}) interface{} {
+	return map[string]interface{}{"data": data, "meta": map[string]int{"count": 1}}
+}
+
+func TestEnvelopedShouldWrapDataForInnerProcessor(t *testing.T) {
+	g := NewGomegaWithT(t)
+	recorder := httptest.NewRecorder()
+
+	p := processor.Enveloped(processor.JSON(), envelope)
+
+	err := p.Process(recorder, "", "Joe")
+
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(p.ContentType()).To(Equal("application/json; charset=utf-8"))
+	g.Expect(p.CanProcess("application/json", "")).To(BeTrue())
+	g.Expect(recorder.Body.String()).To(Equal(`{"data":"Joe","meta":{"count":1}}` + "\n"))
+}
+
+func TestEnvelopedShouldRenderToWriter(t *testing.T) {
+	g := NewGomegaWithT(t)
+	buf := &bytes.Buffer{}
+
+	p := processor.Enveloped(processor.JSON(), envelope).(processor.Renderer)
+
+	err := p.RenderTo(buf, "", []int{1, 2})
+
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(buf.String()).To(Equal(`{"data":[1,2],"meta":{"count":1}}` + "\n"))
+}
+
+func TestEnvelopedShouldNotWrapNilData(t *testing.T) {
+	g := NewGomegaWithT(t)
+	recorder := httptest.NewRecorder()
+
+	err := processor.Enveloped(processor.JSON(), envelope).Process(recorder, "", nil)
+
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(recorder.Body.String()).To(Equal("null\n"))
+}
+
+func TestEnvelopedShouldPassOnCapabilities(t *testing.T) {
+	g := NewGomegaWithT(t)
+	recorder := httptest.NewRecorder()
+
+	p := processor.Enveloped(processor.XML(), envelope)
+	pm := p.(processor.MediaRangeAware).ForMediaRange(header.MediaRange{Type: "image", Subtype: "svg+xml"})
+
+	g.Expect(pm.ContentType()).To(Equal("image/svg+xml; charset=utf-8"))
+	g.Expect(p.(processor.Validator).ValidateData("", "x")).NotTo(HaveOccurred())
+
+	err := processor.Enveloped(processor.TXT(), func(data interface{}) interface{} {
+		return "<" + data.(string) + ">"
+	}).Process(recorder, "", "x")
+
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(recorder.Body.String()).To(Equal("<x>\n"))
+}
@@ -0,0 +1,94 @@
+package processor
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	defaultAtomContentType = "application/atom+xml; charset=utf-8"
+	defaultRSSContentType  = "application/rss+xml; charset=utf-8"
+)
+
+// AtomMarshaler is implemented by feeds that can be written in Atom form. For example,
+// *feeds.Feed from github.com/gorilla/feeds implements it.
+type AtomMarshaler interface {
+	ToAtom() (string, error)
+}
+
+// RSSMarshaler is implemented by feeds that can be written in RSS form. For example,
+// *feeds.Feed from github.com/gorilla/feeds implements it.
+type RSSMarshaler interface {
+	ToRss() (string, error)
+}
+
+type feedProcessor struct {
+	contentType string
+	marshal     func(dataModel interface{}) (string, error)
+}
+
+// Atom creates a processor for "application/atom+xml" feeds. Model values should be an
+// AtomMarshaler, or else a string or []byte that is already in Atom form.
+//
+// This must be placed before the XML processor, which would otherwise match the media type.
+func Atom() ResponseProcessor {
+	return &feedProcessor{contentType: defaultAtomContentType, marshal: func(dataModel interface{}) (string, error) {
+		if m, ok := dataModel.(AtomMarshaler); ok {
+			return m.ToAtom()
+		}
+		return "", fmt.Errorf("Unsupported type for Atom: %T", dataModel)
+	}}
+}
+
+// RSS creates a processor for "application/rss+xml" feeds. Model values should be an
+// RSSMarshaler, or else a string or []byte that is already in RSS form.
+//
+// This must be placed before the XML processor, which would otherwise match the media type.
+func RSS() ResponseProcessor {
+	return &feedProcessor{contentType: defaultRSSContentType, marshal: func(dataModel interface{}) (string, error) {
+		if m, ok := dataModel.(RSSMarshaler); ok {
+			return m.ToRss()
+		}
+		return "", fmt.Errorf("Unsupported type for RSS: %T", dataModel)
+	}}
+}
+
+func (p *feedProcessor) ContentType() string {
+	return p.contentType
+}
+
+// WithContentType implements ContentTypeSettable for this type.
+func (p *feedProcessor) WithContentType(contentType string) ResponseProcessor {
+	p.contentType = contentType
+	return p
+}
+
+func (p *feedProcessor) CanProcess(mediaRange string, lang string) bool {
+	mediaType, _ := split(p.contentType, ';')
+	return strings.EqualFold(mediaRange, strings.TrimSpace(mediaType))
+}
+
+func (p *feedProcessor) Process(w http.ResponseWriter, template string, dataModel interface{}) error {
+	return p.RenderTo(w, template, dataModel)
+}
+
+// RenderTo implements Renderer for this type.
+func (p *feedProcessor) RenderTo(w io.Writer, _ string, dataModel interface{}) error {
+	switch v := dataModel.(type) {
+	case string:
+		_, err := io.WriteString(w, v)
+		return err
+	case []byte:
+		_, err := w.Write(v)
+		return err
+	}
+
+	s, err := p.marshal(dataModel)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, s)
+	return err
+}
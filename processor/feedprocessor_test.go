@@ -0,0 +1,74 @@
+package processor_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/rickb777/negotiator/processor"
+)
+
+// fakeFeed has the same methods as *feeds.Feed in github.com/gorilla/feeds.
+type fakeFeed struct {
+	title string
+}
+
+func (f fakeFeed) ToAtom() (string, error) {
+	return `<feed xmlns="http://www.w3.org/2005/Atom"><title>` + f.title + `</title></feed>`, nil
+}
+
+func (f fakeFeed) ToRss() (string, error) {
+	return `<rss version="2.0"><channel><title>` + f.title + `</title></channel></rss>`, nil
+}
+
+func TestFeedsShouldProcessAcceptHeader(t *testing.T) {
+	g := NewGomegaWithT(t)
+	var acceptTests = []struct {
+		acceptheader string
+		atom, rss    bool
+	}{
+		{"application/atom+xml", true, false},
+		{"application/rss+xml", false, true},
+		{"application/xml", false, false},
+		{"application/*", false, false},
+	}
+
+	atom := processor.Atom()
+	rss := processor.RSS()
+
+	for _, tt := range acceptTests {
+		g.Expect(atom.CanProcess(tt.acceptheader, "")).To(Equal(tt.atom), "Atom should process "+tt.acceptheader)
+		g.Expect(rss.CanProcess(tt.acceptheader, "")).To(Equal(tt.rss), "RSS should process "+tt.acceptheader)
+	}
+	g.Expect(atom.ContentType()).To(Equal("application/atom+xml; charset=utf-8"))
+	g.Expect(rss.ContentType()).To(Equal("application/rss+xml; charset=utf-8"))
+}
+
+func TestFeedsShouldWriteResponseBody(t *testing.T) {
+	g := NewGomegaWithT(t)
+	models := []struct {
+		p        processor.ResponseProcessor
+		data     interface{}
+		expected string
+	}{
+		{processor.Atom(), fakeFeed{"News"}, `<feed xmlns="http://www.w3.org/2005/Atom"><title>News</title></feed>`},
+		{processor.RSS(), fakeFeed{"News"}, `<rss version="2.0"><channel><title>News</title></channel></rss>`},
+		{processor.RSS(), "<rss/>", `<rss/>`},
+	}
+
+	for _, m := range models {
+		recorder := httptest.NewRecorder()
+		err := m.p.Process(recorder, "", m.data)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(recorder.Body.String()).To(Equal(m.expected))
+	}
+}
+
+func TestFeedsShouldReturnError(t *testing.T) {
+	g := NewGomegaWithT(t)
+	recorder := httptest.NewRecorder()
+
+	err := processor.Atom().Process(recorder, "", 42)
+
+	g.Expect(err).To(MatchError("Unsupported type for Atom: int"))
+}
@@ -0,0 +1,41 @@
+package processor
+
+import (
+	"io"
+	"net/http"
+	"strings"
+)
+
+type imageProcessor struct {
+	contentType string
+	render      func(w io.Writer, dataModel interface{}) error
+}
+
+// Image creates a processor for images, or any other binary output, that are written by
+// a render function, e.g. using png.Encode. Register one for each image type that can be
+// offered, e.g. "image/png" and "image/svg+xml"; each matches only its own media type, which
+// is also used as the response Content-Type.
+//
+// Any error from the render function is returned. As usual, offers with nil data give
+// 204-No Content responses without calling the render function.
+func Image(contentType string, render func(w io.Writer, dataModel interface{}) error) ResponseProcessor {
+	return &imageProcessor{contentType: contentType, render: render}
+}
+
+func (p *imageProcessor) ContentType() string {
+	return p.contentType
+}
+
+func (p *imageProcessor) CanProcess(mediaRange string, lang string) bool {
+	mediaType, _ := split(p.contentType, ';')
+	return strings.EqualFold(mediaRange, strings.TrimSpace(mediaType))
+}
+
+func (p *imageProcessor) Process(w http.ResponseWriter, template string, dataModel interface{}) error {
+	return p.RenderTo(w, template, dataModel)
+}
+
+// RenderTo implements Renderer for this type.
+func (p *imageProcessor) RenderTo(w io.Writer, _ string, dataModel interface{}) error {
+	return p.render(w, dataModel)
+}
@@ -0,0 +1,63 @@
+package processor_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/rickb777/negotiator/processor"
+)
+
+func svg(w io.Writer, dataModel interface{}) error {
+	_, err := fmt.Fprintf(w, `<svg><text>%v</text></svg>`, dataModel)
+	return err
+}
+
+func TestImageShouldProcessAcceptHeader(t *testing.T) {
+	g := NewGomegaWithT(t)
+	var acceptTests = []struct {
+		acceptheader string
+		expected     bool
+	}{
+		{"image/svg+xml", true},
+		{"IMAGE/SVG+XML", true},
+		{"image/png", false},
+		{"image/*", false},
+	}
+
+	p := processor.Image("image/svg+xml", svg)
+
+	for _, tt := range acceptTests {
+		result := p.CanProcess(tt.acceptheader, "")
+		g.Expect(result).To(Equal(tt.expected), "Should process "+tt.acceptheader)
+	}
+	g.Expect(p.ContentType()).To(Equal("image/svg+xml"))
+}
+
+func TestImageShouldWriteResponseBody(t *testing.T) {
+	g := NewGomegaWithT(t)
+	recorder := httptest.NewRecorder()
+
+	p := processor.Image("image/svg+xml", svg)
+
+	err := p.Process(recorder, "", 42)
+
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(recorder.Body.String()).To(Equal(`<svg><text>42</text></svg>`))
+}
+
+func TestImageShouldReturnError(t *testing.T) {
+	g := NewGomegaWithT(t)
+	recorder := httptest.NewRecorder()
+
+	p := processor.Image("image/png", func(w io.Writer, dataModel interface{}) error {
+		return errors.New("cannot encode")
+	})
+
+	err := p.Process(recorder, "", 42)
+
+	g.Expect(err).To(MatchError("cannot encode"))
+}
@@ -1,25 +1,96 @@
 package processor
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"reflect"
 	"strings"
+
+	"github.com/rickb777/negotiator/header"
 )
 
-const defaultJSONContentType = "application/json; charset=utf-8"
+const (
+	defaultJSONContentType = "application/json; charset=utf-8"
+	jsonLDContentType      = "application/ld+json"
+)
+
+var (
+	jsonArrayStart = []byte("[")
+	jsonArrayComma = []byte(",")
+	jsonArrayEnd   = []byte("]")
+)
 
 type jsonProcessor struct {
 	indent      string
 	contentType string
+	newline     bool
+	echo        bool
+	smart       string
+	canonical   bool
+	frame       func(interface{}) interface{}
+	ldOnly      bool
+	array       bool
 }
 
 // JSON creates a new processor for JSON with a specified indentation.
 // It handles all requests except Ajax requests.
+//
+// When the request matched a structured "+json" media type, e.g. "application/geo+json",
+// that media type is echoed in the Content-Type response header by default, instead of
+// "application/json" as in earlier versions. Use EchoSettable to disable this.
 func JSON(indent ...string) ResponseProcessor {
 	if len(indent) == 0 {
-		return &jsonProcessor{contentType: defaultJSONContentType}
+		return &jsonProcessor{contentType: defaultJSONContentType, newline: true, echo: true}
+	}
+	return &jsonProcessor{indent: indent[0], contentType: defaultJSONContentType, newline: true, echo: true}
+}
+
+// CanonicalJSON creates a new processor for compact JSON in which the keys of all objects
+// are sorted, including those from struct fields, so the output is byte-for-byte the same
+// for the same data, e.g. for signing. Numbers are written exactly as they would be by JSON.
+// Otherwise it is the same as JSON.
+func CanonicalJSON() ResponseProcessor {
+	return &jsonProcessor{contentType: defaultJSONContentType, newline: true, echo: true, canonical: true}
+}
+
+// JSONLD creates a new processor for JSON-LD, i.e. "application/ld+json", which is used for
+// the Content-Type. Before the data is written, it is passed through the frame function,
+// if not nil, e.g. to add the "@context" or to reshape the data as in JSON-LD framing.
+// Otherwise it is the same as JSON.
+//
+// This must be placed before the JSON processor, which would otherwise match the media type.
+// Other requests are left to the JSON processor.
+func JSONLD(frame func(interface{}) interface{}) ResponseProcessor {
+	return &jsonProcessor{contentType: jsonLDContentType, newline: true, frame: frame, ldOnly: true}
+}
+
+// StreamingJSONArray creates a new processor that writes a JSON array one element at a time,
+// for large collections that clients expect as a single array. The model value should be a
+// Seq, a slice, an array or a receivable channel (see ForEach). "[" is written first, then
+// each element is encoded compactly, separated by commas, and the response writer is
+// flushed after each element if it is an http.Flusher; finally "]" is written. An empty
+// collection gives "[]". Any other model value is written as for JSON.
+//
+// If an element cannot be encoded, or the channel or Seq fails, the error is returned and
+// the output is left incomplete; the status code will already have been sent, so clients
+// must treat a truncated array as a failure. Otherwise it is the same as JSON.
+func StreamingJSONArray() ResponseProcessor {
+	return &jsonProcessor{contentType: defaultJSONContentType, newline: true, echo: true, array: true}
+}
+
+// SmartJSON creates a new processor for JSON that is compact unless the request has a
+// "pretty" or "indent" query parameter, e.g. "/users?pretty", in which case it is indented
+// using the specified indentation (two spaces by default). This is handy for people using
+// a browser, whilst programs get compact output. Otherwise it is the same as JSON.
+func SmartJSON(indent ...string) ResponseProcessor {
+	p := &jsonProcessor{contentType: defaultJSONContentType, newline: true, echo: true, smart: "  "}
+	if len(indent) > 0 {
+		p.smart = indent[0]
 	}
-	return &jsonProcessor{indent: indent[0], contentType: defaultJSONContentType}
+	return p
 }
 
 func (p *jsonProcessor) ContentType() string {
@@ -32,30 +103,189 @@ func (p *jsonProcessor) WithContentType(contentType string) ResponseProcessor {
 	return p
 }
 
-func (*jsonProcessor) CanProcess(mediaRange string, lang string) bool {
+// WithTrailingNewline implements TrailingNewlineSettable for this type.
+// By default, the output is terminated by a newline.
+func (p *jsonProcessor) WithTrailingNewline(newline bool) ResponseProcessor {
+	p.newline = newline
+	return p
+}
+
+// WithEcho implements EchoSettable for this type.
+func (p *jsonProcessor) WithEcho(echo bool) ResponseProcessor {
+	p.echo = echo
+	return p
+}
+
+// ForMediaRange implements MediaRangeAware for this type.
+func (p *jsonProcessor) ForMediaRange(matched header.MediaRange) ResponseProcessor {
+	if !p.echo || matched.Type == "*" || !MatchesSuffix(matched.Subtype, "json") {
+		return p
+	}
+
+	cp := *p
+	cp.contentType = replaceMediaType(p.contentType, matched.Type+"/"+matched.Subtype)
+	return &cp
+}
+
+// ForRequest implements RequestAware for this type.
+func (p *jsonProcessor) ForRequest(req *http.Request) ResponseProcessor {
+	if p.smart == "" || req.URL == nil {
+		return p
+	}
+
+	query := req.URL.Query()
+	if _, ok := query["pretty"]; !ok {
+		if _, ok := query["indent"]; !ok {
+			return p
+		}
+	}
+
+	cp := *p
+	cp.indent = p.smart
+	return &cp
+}
+
+func (p *jsonProcessor) CanProcess(mediaRange string, lang string) bool {
+	if p.ldOnly {
+		return strings.EqualFold(mediaRange, jsonLDContentType)
+	}
 	return strings.EqualFold(mediaRange, "application/json") ||
 		strings.HasPrefix(mediaRange, "application/json-") ||
-		strings.HasSuffix(mediaRange, "+json")
+		MatchesSuffix(mediaRange, "json")
 }
 
 func (p *jsonProcessor) Process(w http.ResponseWriter, template string, dataModel interface{}) error {
-	return RenderJSON(p.indent)(w, template, dataModel)
+	return p.RenderTo(w, template, dataModel)
 }
 
-// RenderJSON returns a rendering function that converts some data into JSON.
-func RenderJSON(indent string) func(http.ResponseWriter, string, interface{}) error {
-	if indent == "" {
-		return func(w http.ResponseWriter, _ string, dataModel interface{}) error {
-			return json.NewEncoder(w).Encode(dataModel)
+// ValidateData implements Validator for this type. Channels, functions and complex numbers
+// cannot be rendered as JSON, except that StreamingJSONArray accepts receivable channels.
+func (p *jsonProcessor) ValidateData(_ string, dataModel interface{}) error {
+	value := reflect.Indirect(reflect.ValueOf(dataModel))
+	switch value.Kind() {
+	case reflect.Chan:
+		if p.array && value.Type().ChanDir()&reflect.RecvDir != 0 {
+			return nil
 		}
+		return fmt.Errorf("Unsupported type for JSON: %T", dataModel)
+	case reflect.Func, reflect.Complex64, reflect.Complex128, reflect.UnsafePointer:
+		return fmt.Errorf("Unsupported type for JSON: %T", dataModel)
+	}
+	return nil
+}
+
+// Decode implements Decoder for this type.
+func (p *jsonProcessor) Decode(r io.Reader, v interface{}) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+// RenderTo implements Renderer for this type.
+func (p *jsonProcessor) RenderTo(w io.Writer, _ string, dataModel interface{}) error {
+	if p.frame != nil {
+		dataModel = p.frame(dataModel)
 	}
 
-	return func(w http.ResponseWriter, _ string, dataModel interface{}) error {
-		js, err := json.MarshalIndent(dataModel, "", indent)
+	if p.array {
+		ok, err := p.renderArray(w, dataModel)
+		if ok {
+			return err
+		}
+	}
+
+	if p.canonical {
+		canonical, err := canonicalise(dataModel)
 		if err != nil {
 			return err
 		}
+		dataModel = canonical
+	}
+
+	if p.indent == "" && p.newline {
+		return json.NewEncoder(w).Encode(dataModel)
+	}
 
-		return WriteWithNewline(w, js)
+	var js []byte
+	var err error
+	if p.indent == "" {
+		js, err = json.Marshal(dataModel)
+	} else {
+		js, err = json.MarshalIndent(dataModel, "", p.indent)
+	}
+	if err != nil {
+		return err
 	}
+
+	if !p.newline {
+		_, err = w.Write(js)
+		return err
+	}
+
+	return WriteWithNewline(w, js)
+}
+
+// renderArray writes each element of a collection as part of a JSON array, flushing as it
+// goes. The result is false, having written nothing, if the data model is not a collection.
+func (p *jsonProcessor) renderArray(w io.Writer, dataModel interface{}) (bool, error) {
+	started := false
+	ok, err := ForEach(dataModel, func(i int, v interface{}) error {
+		js, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		separator := jsonArrayComma
+		if i == 0 {
+			separator = jsonArrayStart
+			started = true
+		}
+
+		if _, err = w.Write(separator); err != nil {
+			return err
+		}
+		if _, err = w.Write(js); err != nil {
+			return err
+		}
+
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		return nil
+	})
+	if !ok || err != nil {
+		return ok, err
+	}
+
+	if !started {
+		if _, err = w.Write(jsonArrayStart); err != nil {
+			return true, err
+		}
+	}
+
+	if !p.newline {
+		_, err = w.Write(jsonArrayEnd)
+		return true, err
+	}
+
+	return true, WriteWithNewline(w, jsonArrayEnd)
+}
+
+// canonicalise converts the data to generic maps and slices, which encoding/json writes with
+// sorted keys. Numbers are kept as json.Number so that they are not altered.
+func canonicalise(dataModel interface{}) (interface{}, error) {
+	js, err := json.Marshal(dataModel)
+	if err != nil {
+		return nil, err
+	}
+
+	d := json.NewDecoder(bytes.NewReader(js))
+	d.UseNumber()
+	var generic interface{}
+	err = d.Decode(&generic)
+	return generic, err
+}
+
+// RenderJSON returns a rendering function that converts some data into JSON.
+func RenderJSON(indent string) func(http.ResponseWriter, string, interface{}) error {
+	p := &jsonProcessor{indent: indent, newline: true}
+	return p.Process
 }
@@ -1,12 +1,15 @@
 package processor_test
 
 import (
+	"bytes"
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	. "github.com/onsi/gomega"
+	"github.com/rickb777/negotiator/header"
 	"github.com/rickb777/negotiator/processor"
 )
 
@@ -39,6 +42,38 @@ func TestJSONShouldSetContentTypeHeader(t *testing.T) {
 	g.Expect(p.ContentType()).To(Equal("application/foo"))
 }
 
+func TestJSONShouldEchoStructuredSuffixMediaType(t *testing.T) {
+	g := NewGomegaWithT(t)
+	cases := []struct {
+		matched  header.MediaRange
+		expected string
+	}{
+		{header.MediaRange{Type: "application", Subtype: "geo+json"}, "application/geo+json; charset=utf-8"},
+		{header.MediaRange{Type: "application", Subtype: "json"}, "application/json; charset=utf-8"},
+		{header.MediaRange{Type: "*", Subtype: "*"}, "application/json; charset=utf-8"},
+	}
+
+	p := processor.JSON()
+
+	for _, c := range cases {
+		actual := p.(processor.MediaRangeAware).ForMediaRange(c.matched)
+		g.Expect(actual.ContentType()).To(Equal(c.expected))
+	}
+
+	// the shared processor is unchanged
+	g.Expect(p.ContentType()).To(Equal("application/json; charset=utf-8"))
+}
+
+func TestJSONShouldNotEchoMediaTypeWhenDisabled(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	p := processor.JSON().(processor.EchoSettable).WithEcho(false)
+
+	actual := p.(processor.MediaRangeAware).ForMediaRange(header.MediaRange{Type: "application", Subtype: "geo+json"})
+
+	g.Expect(actual.ContentType()).To(Equal("application/json; charset=utf-8"))
+}
+
 func TestJSONShouldWriteResponseBody(t *testing.T) {
 	g := NewGomegaWithT(t)
 	recorder := httptest.NewRecorder()
@@ -73,6 +108,233 @@ func TestJSONShouldWriteResponseBodyIndented(t *testing.T) {
 	g.Expect(recorder.Body.String()).To(Equal("{\n  \"Name\": \"Joe Bloggs\"\n}\n"))
 }
 
+func TestJSONShouldWriteResponseBodyWithoutTrailingNewline(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	model := struct {
+		Name string
+	}{
+		"Joe Bloggs",
+	}
+
+	models := []struct {
+		p        processor.ResponseProcessor
+		expected string
+	}{
+		{processor.JSON(), "{\"Name\":\"Joe Bloggs\"}"},
+		{processor.JSON("  "), "{\n  \"Name\": \"Joe Bloggs\"\n}"},
+	}
+
+	for _, m := range models {
+		recorder := httptest.NewRecorder()
+		p := m.p.(processor.TrailingNewlineSettable).WithTrailingNewline(false)
+
+		err := p.Process(recorder, "", model)
+
+		g.Expect(err).NotTo(HaveOccurred())
+
+		g.Expect(recorder.Body.String()).To(Equal(m.expected))
+	}
+}
+
+func TestSmartJSONShouldIndentOnlyWhenRequested(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	model := struct {
+		Name string
+	}{
+		"Joe Bloggs",
+	}
+
+	models := []struct {
+		url      string
+		expected string
+	}{
+		{"/", "{\"Name\":\"Joe Bloggs\"}\n"},
+		{"/?pretty", "{\n  \"Name\": \"Joe Bloggs\"\n}\n"},
+		{"/?x=1&indent=true", "{\n  \"Name\": \"Joe Bloggs\"\n}\n"},
+	}
+
+	for _, m := range models {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", m.url, nil)
+		p := processor.SmartJSON().(processor.RequestAware).ForRequest(req)
+
+		err := p.Process(recorder, "", model)
+
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(recorder.Body.String()).To(Equal(m.expected), m.url)
+	}
+}
+
+func TestCanonicalJSONShouldSortKeys(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	type inner struct {
+		Zed   int
+		Alpha float64
+	}
+	model := struct {
+		Name  string
+		Big   uint64
+		Inner inner
+		Map   map[string]inner
+	}{
+		Name:  "Joe",
+		Big:   18446744073709551615,
+		Inner: inner{Zed: 1, Alpha: 0.1},
+		Map:   map[string]inner{"b": {Zed: 2}, "a": {Alpha: 1e21}},
+	}
+
+	p := processor.CanonicalJSON()
+
+	for i := 0; i < 3; i++ {
+		recorder := httptest.NewRecorder()
+		err := p.Process(recorder, "", model)
+
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(recorder.Body.String()).To(Equal(
+			`{"Big":18446744073709551615,"Inner":{"Alpha":0.1,"Zed":1},"Map":{"a":{"Alpha":1e+21,"Zed":0},"b":{"Alpha":0,"Zed":2}},"Name":"Joe"}` + "\n"))
+	}
+}
+
+func TestJSONLDShouldProcessOnlyJSONLD(t *testing.T) {
+	g := NewGomegaWithT(t)
+	var acceptTests = []struct {
+		acceptheader string
+		expected     bool
+	}{
+		{"application/ld+json", true},
+		{"Application/LD+JSON", true},
+		{"application/json", false},
+		{"application/vnd.api+json", false},
+	}
+
+	p := processor.JSONLD(nil)
+
+	for _, tt := range acceptTests {
+		result := p.CanProcess(tt.acceptheader, "")
+		g.Expect(result).To(Equal(tt.expected), "Should process "+tt.acceptheader)
+	}
+}
+
+func TestJSONLDShouldApplyFrame(t *testing.T) {
+	g := NewGomegaWithT(t)
+	recorder := httptest.NewRecorder()
+
+	frame := func(v interface{}) interface{} {
+		return map[string]interface{}{"@context": "https://schema.org", "@type": "Person", "name": v}
+	}
+	p := processor.JSONLD(frame)
+
+	err := p.Process(recorder, "", "Joe")
+
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(p.ContentType()).To(Equal("application/ld+json"))
+	g.Expect(recorder.Body.String()).To(Equal(`{"@context":"https://schema.org","@type":"Person","name":"Joe"}` + "\n"))
+}
+
+func TestJSONLDWithoutFrameShouldWriteData(t *testing.T) {
+	g := NewGomegaWithT(t)
+	recorder := httptest.NewRecorder()
+
+	err := processor.JSONLD(nil).Process(recorder, "", map[string]string{"@id": "urn:x"})
+
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(recorder.Body.String()).To(Equal(`{"@id":"urn:x"}` + "\n"))
+}
+
+func TestStreamingJSONArrayShouldWriteElementsAsOneArray(t *testing.T) {
+	g := NewGomegaWithT(t)
+	recorder := httptest.NewRecorder()
+
+	p := processor.StreamingJSONArray()
+
+	err := p.Process(recorder, "", []person{{Name: "Joe", Age: 42}, {Name: "Ann", Age: 37}})
+
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(p.ContentType()).To(Equal("application/json; charset=utf-8"))
+	g.Expect(recorder.Body.String()).To(Equal(`[{"Name":"Joe","Age":42},{"Name":"Ann","Age":37}]` + "\n"))
+	g.Expect(recorder.Flushed).To(BeTrue())
+}
+
+func TestStreamingJSONArrayShouldWriteChannelAndSeq(t *testing.T) {
+	g := NewGomegaWithT(t)
+	buf := &bytes.Buffer{}
+
+	ch := make(chan int, 3)
+	ch <- 1
+	ch <- 2
+	ch <- 3
+	close(ch)
+
+	p := processor.StreamingJSONArray().(processor.Renderer)
+
+	g.Expect(processor.StreamingJSONArray().(processor.Validator).ValidateData("", ch)).To(Succeed())
+	g.Expect(processor.JSON().(processor.Validator).ValidateData("", ch)).NotTo(Succeed())
+
+	err := p.RenderTo(buf, "", ch)
+
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(buf.String()).To(Equal("[1,2,3]\n"))
+
+	buf.Reset()
+	err = p.RenderTo(buf, "", &countdown{2})
+
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(buf.String()).To(Equal("[2,1]\n"))
+}
+
+func TestStreamingJSONArrayShouldWriteEmptyArray(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	for _, model := range []interface{}{[]int{}, make(chan int), &countdown{0}} {
+		if ch, ok := model.(chan int); ok {
+			close(ch)
+		}
+		buf := &bytes.Buffer{}
+
+		err := processor.StreamingJSONArray().(processor.Renderer).RenderTo(buf, "", model)
+
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(buf.String()).To(Equal("[]\n"), "%T", model)
+	}
+}
+
+func TestStreamingJSONArrayShouldWriteSingleValue(t *testing.T) {
+	g := NewGomegaWithT(t)
+	buf := &bytes.Buffer{}
+
+	p := processor.StreamingJSONArray().(processor.TrailingNewlineSettable).WithTrailingNewline(false)
+
+	err := p.(processor.Renderer).RenderTo(buf, "", person{Name: "Joe", Age: 42})
+
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(buf.String()).To(Equal(`{"Name":"Joe","Age":42}`))
+}
+
+func TestStreamingJSONArrayShouldStopAtError(t *testing.T) {
+	g := NewGomegaWithT(t)
+	recorder := httptest.NewRecorder()
+
+	err := processor.StreamingJSONArray().Process(recorder, "", []interface{}{1, &User{"Joe Bloggs"}, 3})
+
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(recorder.Body.String()).To(Equal("[1"))
+}
+
+func TestJSONShouldRenderToWriter(t *testing.T) {
+	g := NewGomegaWithT(t)
+	buf := &bytes.Buffer{}
+
+	p := processor.JSON().(processor.Renderer)
+
+	err := p.RenderTo(buf, "", []int{1, 2, 3})
+
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(buf.String()).To(Equal("[1,2,3]\n"))
+}
+
 func TestJSONShouldReturnError(t *testing.T) {
 	g := NewGomegaWithT(t)
 	recorder := httptest.NewRecorder()
@@ -88,6 +350,16 @@ func TestJSONShouldReturnError(t *testing.T) {
 	g.Expect(err).To(HaveOccurred())
 }
 
+func TestJSONShouldDecode(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	var model map[string]string
+	err := processor.JSON().(processor.Decoder).Decode(strings.NewReader(`{"Name":"Joe"}`), &model)
+
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(model).To(Equal(map[string]string{"Name": "Joe"}))
+}
+
 type User struct {
 	Name string
 }
@@ -0,0 +1,93 @@
+package processor
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/rickb777/negotiator/header"
+)
+
+const (
+	defaultMarkdownContentType = "text/markdown; charset=utf-8"
+	defaultHTMLContentType     = "text/html; charset=utf-8"
+)
+
+type markdownProcessor struct {
+	contentType string
+	convert     func([]byte) []byte
+	html        bool
+}
+
+// Markdown creates an output processor for "text/markdown" and "text/x-markdown". The model
+// value should be a string or []byte containing the markdown source, which is written as is.
+func Markdown() ResponseProcessor {
+	return &markdownProcessor{contentType: defaultMarkdownContentType}
+}
+
+// MarkdownToHTML creates an output processor that is like Markdown, but also matches
+// "text/html". When "text/html" is requested, the markdown source is converted to HTML using
+// the convert function. So one offer can serve both raw markdown and rendered HTML, e.g.
+//
+//	n := negotiator.New(processor.MarkdownToHTML(toHTML), processor.JSON())
+//	n.Negotiate(w, req, negotiator.Of(markdownSource))
+func MarkdownToHTML(convert func([]byte) []byte) ResponseProcessor {
+	return &markdownProcessor{contentType: defaultMarkdownContentType, convert: convert}
+}
+
+func (p *markdownProcessor) ContentType() string {
+	return p.contentType
+}
+
+// WithContentType implements ContentTypeSettable for this type.
+func (p *markdownProcessor) WithContentType(contentType string) ResponseProcessor {
+	p.contentType = contentType
+	return p
+}
+
+// ForMediaRange implements MediaRangeAware for this type.
+func (p *markdownProcessor) ForMediaRange(matched header.MediaRange) ResponseProcessor {
+	if p.convert == nil || !isHTML(matched.Type+"/"+matched.Subtype) {
+		return p
+	}
+
+	cp := *p
+	cp.contentType = defaultHTMLContentType
+	cp.html = true
+	return &cp
+}
+
+func (p *markdownProcessor) CanProcess(mediaRange string, lang string) bool {
+	return strings.EqualFold(mediaRange, "text/markdown") ||
+		strings.EqualFold(mediaRange, "text/x-markdown") ||
+		(p.convert != nil && isHTML(mediaRange))
+}
+
+func isHTML(mediaRange string) bool {
+	return strings.EqualFold(mediaRange, "text/html")
+}
+
+func (p *markdownProcessor) Process(w http.ResponseWriter, template string, dataModel interface{}) error {
+	return p.RenderTo(w, template, dataModel)
+}
+
+// RenderTo implements Renderer for this type.
+func (p *markdownProcessor) RenderTo(w io.Writer, _ string, dataModel interface{}) error {
+	var source []byte
+	switch v := dataModel.(type) {
+	case string:
+		source = []byte(v)
+	case []byte:
+		source = v
+	default:
+		return fmt.Errorf("Unsupported type for Markdown: %T", dataModel)
+	}
+
+	if p.html {
+		source = p.convert(source)
+	}
+
+	_, err := w.Write(source)
+	return err
+}
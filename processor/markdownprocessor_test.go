@@ -0,0 +1,90 @@
+package processor_test
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/rickb777/negotiator/header"
+	"github.com/rickb777/negotiator/processor"
+)
+
+func toHTML(md []byte) []byte {
+	return append([]byte("<h1>"), append(bytes.TrimPrefix(md, []byte("# ")), "</h1>"...)...)
+}
+
+func TestMarkdownShouldProcessAcceptHeader(t *testing.T) {
+	g := NewGomegaWithT(t)
+	var acceptTests = []struct {
+		acceptheader string
+		markdown     bool
+		toHTML       bool
+	}{
+		{"text/markdown", true, true},
+		{"text/x-markdown", true, true},
+		{"text/html", false, true},
+		{"text/plain", false, false},
+	}
+
+	md := processor.Markdown()
+	mh := processor.MarkdownToHTML(toHTML)
+
+	for _, tt := range acceptTests {
+		g.Expect(md.CanProcess(tt.acceptheader, "")).To(Equal(tt.markdown), "Should process "+tt.acceptheader)
+		g.Expect(mh.CanProcess(tt.acceptheader, "")).To(Equal(tt.toHTML), "Should process "+tt.acceptheader)
+	}
+}
+
+func TestMarkdownShouldWriteSource(t *testing.T) {
+	g := NewGomegaWithT(t)
+	models := []interface{}{"# Hello", []byte("# Hello")}
+
+	p := processor.Markdown()
+
+	for _, m := range models {
+		recorder := httptest.NewRecorder()
+		err := p.Process(recorder, "", m)
+
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(p.ContentType()).To(Equal("text/markdown; charset=utf-8"))
+		g.Expect(recorder.Body.String()).To(Equal("# Hello"))
+	}
+}
+
+func TestMarkdownToHTMLShouldConvertOnlyForHTML(t *testing.T) {
+	g := NewGomegaWithT(t)
+	models := []struct {
+		matched     header.MediaRange
+		contentType string
+		expected    string
+	}{
+		{header.MediaRange{Type: "text", Subtype: "html"}, "text/html; charset=utf-8", "<h1>Hello</h1>"},
+		{header.MediaRange{Type: "text", Subtype: "markdown"}, "text/markdown; charset=utf-8", "# Hello"},
+		{header.MediaRange{Type: "*", Subtype: "*"}, "text/markdown; charset=utf-8", "# Hello"},
+	}
+
+	p := processor.MarkdownToHTML(toHTML)
+
+	for _, m := range models {
+		recorder := httptest.NewRecorder()
+		pm := p.(processor.MediaRangeAware).ForMediaRange(m.matched)
+		err := pm.Process(recorder, "", "# Hello")
+
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(pm.ContentType()).To(Equal(m.contentType))
+		g.Expect(recorder.Body.String()).To(Equal(m.expected))
+	}
+
+	// the shared processor is unchanged
+	g.Expect(p.ContentType()).To(Equal("text/markdown; charset=utf-8"))
+}
+
+func TestMarkdownShouldReturnErrorForUnsupportedType(t *testing.T) {
+	g := NewGomegaWithT(t)
+	recorder := httptest.NewRecorder()
+
+	err := processor.Markdown().Process(recorder, "", 123)
+
+	g.Expect(err).To(HaveOccurred())
+}
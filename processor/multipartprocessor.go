@@ -0,0 +1,138 @@
+package processor
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// Part is one part of a multipart response. Its media type is used to choose the processor
+// that renders it, in the same way as for an offer.
+type Part struct {
+	MediaType   string // e.g. "application/json"
+	Language    string // blank if not relevant
+	Template    string // blank if not relevant
+	ContentType string // blank to use the processor's content type
+	Data        interface{}
+}
+
+type multipartProcessor struct {
+	boundary   string
+	processors []ResponseProcessor
+}
+
+// Multipart creates an output processor that writes a multipart/mixed response. The model
+// value should be a []Part; each part is rendered by the first of the processors that can
+// process its media type, with that processor's Content-Type as the part header. For
+// example
+//
+//	processor.Multipart(processor.JSON(), processor.XML(), processor.TXT())
+//
+// The boundary is generated randomly when the processor is created and is included in the
+// Content-Type.
+func Multipart(processors ...ResponseProcessor) ResponseProcessor {
+	return &multipartProcessor{boundary: randomBoundary(), processors: processors}
+}
+
+func randomBoundary() string {
+	var buf [30]byte
+	_, err := io.ReadFull(rand.Reader, buf[:])
+	if err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("%x", buf[:])
+}
+
+func (p *multipartProcessor) ContentType() string {
+	return "multipart/mixed; boundary=" + p.boundary
+}
+
+func (*multipartProcessor) CanProcess(mediaRange string, lang string) bool {
+	return strings.EqualFold(mediaRange, "multipart/mixed") || strings.EqualFold(mediaRange, "multipart/*")
+}
+
+func (p *multipartProcessor) Process(w http.ResponseWriter, template string, dataModel interface{}) error {
+	return p.RenderTo(w, template, dataModel)
+}
+
+// RenderTo implements Renderer for this type.
+func (p *multipartProcessor) RenderTo(w io.Writer, _ string, dataModel interface{}) error {
+	parts, ok := dataModel.([]Part)
+	if !ok {
+		return fmt.Errorf("Unsupported type for multipart: %T", dataModel)
+	}
+
+	mw := multipart.NewWriter(w)
+	err := mw.SetBoundary(p.boundary)
+	if err != nil {
+		return err
+	}
+
+	for _, part := range parts {
+		err = p.writePart(mw, part)
+		if err != nil {
+			return err
+		}
+	}
+
+	return mw.Close()
+}
+
+func (p *multipartProcessor) writePart(mw *multipart.Writer, part Part) error {
+	rp := p.processorFor(part)
+	if rp == nil {
+		return fmt.Errorf("no processor for multipart media type %q", part.MediaType)
+	}
+
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Type", rp.ContentType())
+	if part.ContentType != "" {
+		h.Set("Content-Type", part.ContentType)
+	}
+	if part.Language != "" && part.Language != "*" {
+		h.Set("Content-Language", part.Language)
+	}
+
+	pw, err := mw.CreatePart(h)
+	if err != nil {
+		return err
+	}
+
+	if part.Data == nil {
+		return nil
+	}
+
+	if r, ok := rp.(Renderer); ok {
+		return r.RenderTo(pw, part.Template, part.Data)
+	}
+	return rp.Process(partWriter{Writer: pw}, part.Template, part.Data)
+}
+
+func (p *multipartProcessor) processorFor(part Part) ResponseProcessor {
+	mediaType := strings.ToLower(strings.TrimSpace(part.MediaType))
+	for _, rp := range p.processors {
+		if rp.CanProcess(mediaType, part.Language) {
+			if la, ok := rp.(LanguageAware); ok && part.Language != "" {
+				return la.ForLanguage(part.Language)
+			}
+			return rp
+		}
+	}
+	return nil
+}
+
+// partWriter adapts a multipart part for processors that need an http.ResponseWriter.
+// Headers set by the processor are ignored.
+type partWriter struct {
+	io.Writer
+}
+
+func (partWriter) Header() http.Header {
+	return make(http.Header)
+}
+
+func (partWriter) WriteHeader(int) {}
@@ -0,0 +1,81 @@
+package processor_test
+
+import (
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/rickb777/negotiator/processor"
+)
+
+func TestMultipartShouldProcessAcceptHeader(t *testing.T) {
+	g := NewGomegaWithT(t)
+	var acceptTests = []struct {
+		acceptheader string
+		expected     bool
+	}{
+		{"multipart/mixed", true},
+		{"multipart/*", true},
+		{"multipart/form-data", false},
+		{"application/json", false},
+	}
+
+	p := processor.Multipart(processor.JSON())
+
+	for _, tt := range acceptTests {
+		result := p.CanProcess(tt.acceptheader, "")
+		g.Expect(result).To(Equal(tt.expected), "Should process "+tt.acceptheader)
+	}
+}
+
+func TestMultipartShouldWriteEachPartWithItsProcessor(t *testing.T) {
+	g := NewGomegaWithT(t)
+	recorder := httptest.NewRecorder()
+
+	p := processor.Multipart(processor.JSON(), processor.TXT())
+
+	err := p.Process(recorder, "", []processor.Part{
+		{MediaType: "application/json", Data: map[string]int{"a": 1}},
+		{MediaType: "text/plain", Language: "en", Data: "hello"},
+		{MediaType: "application/json", ContentType: "application/vnd.foo+json", Data: "foo"},
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	mediaType, params, err := mime.ParseMediaType(p.ContentType())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(mediaType).To(Equal("multipart/mixed"))
+
+	expected := []struct {
+		contentType, language, body string
+	}{
+		{"application/json; charset=utf-8", "", "{\"a\":1}\n"},
+		{"text/plain; charset=utf-8", "en", "hello\n"},
+		{"application/vnd.foo+json", "", "\"foo\"\n"},
+	}
+
+	mr := multipart.NewReader(recorder.Body, params["boundary"])
+	for _, e := range expected {
+		part, err := mr.NextPart()
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(part.Header.Get("Content-Type")).To(Equal(e.contentType))
+		g.Expect(part.Header.Get("Content-Language")).To(Equal(e.language))
+		body, err := ioutil.ReadAll(part)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(string(body)).To(Equal(e.body))
+	}
+
+	_, err = mr.NextPart()
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestMultipartShouldReturnError(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	p := processor.Multipart(processor.JSON())
+
+	g.Expect(p.Process(httptest.NewRecorder(), "", "not parts")).To(HaveOccurred())
+	g.Expect(p.Process(httptest.NewRecorder(), "", []processor.Part{{MediaType: "text/csv", Data: "x"}})).To(HaveOccurred())
+}
@@ -0,0 +1,79 @@
+package processor
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	problemJSONContentType = "application/problem+json"
+	problemXMLContentType  = "application/problem+xml"
+)
+
+// ProblemDetails describes an error in an HTTP API response, as in RFC 7807. RequestID is an
+// extension member for a correlation ID, e.g. from negotiator.Negotiator.RequestID.
+type ProblemDetails struct {
+	XMLName   xml.Name `json:"-" xml:"urn:ietf:rfc:7807 problem"`
+	Type      string   `json:"type,omitempty" xml:"type,omitempty"`
+	Title     string   `json:"title,omitempty" xml:"title,omitempty"`
+	Status    int      `json:"status,omitempty" xml:"status,omitempty"`
+	Detail    string   `json:"detail,omitempty" xml:"detail,omitempty"`
+	Instance  string   `json:"instance,omitempty" xml:"instance,omitempty"`
+	RequestID string   `json:"requestId,omitempty" xml:"requestId,omitempty"`
+}
+
+type problemProcessor struct {
+	contentType string
+	encode      func(w io.Writer, problem *ProblemDetails) error
+}
+
+// ProblemJSON creates a processor for "application/problem+json" error responses (RFC 7807).
+// Model values should be ProblemDetails or *ProblemDetails.
+//
+// This must be placed before the JSON processor, which would otherwise match the media type.
+func ProblemJSON() ResponseProcessor {
+	return &problemProcessor{contentType: problemJSONContentType, encode: func(w io.Writer, problem *ProblemDetails) error {
+		return json.NewEncoder(w).Encode(problem)
+	}}
+}
+
+// ProblemXML creates a processor for "application/problem+xml" error responses (RFC 7807).
+// Model values should be ProblemDetails or *ProblemDetails.
+//
+// This must be placed before the XML processor, which would otherwise match the media type.
+func ProblemXML() ResponseProcessor {
+	return &problemProcessor{contentType: problemXMLContentType, encode: func(w io.Writer, problem *ProblemDetails) error {
+		x, err := xml.Marshal(problem)
+		if err != nil {
+			return err
+		}
+		return WriteWithNewline(w, x)
+	}}
+}
+
+func (p *problemProcessor) ContentType() string {
+	return p.contentType
+}
+
+func (p *problemProcessor) CanProcess(mediaRange string, lang string) bool {
+	return strings.EqualFold(mediaRange, p.contentType)
+}
+
+func (p *problemProcessor) Process(w http.ResponseWriter, template string, dataModel interface{}) error {
+	return p.RenderTo(w, template, dataModel)
+}
+
+// RenderTo implements Renderer for this type.
+func (p *problemProcessor) RenderTo(w io.Writer, _ string, dataModel interface{}) error {
+	switch v := dataModel.(type) {
+	case ProblemDetails:
+		return p.encode(w, &v)
+	case *ProblemDetails:
+		return p.encode(w, v)
+	}
+	return fmt.Errorf("Unsupported type for %s: %T", p.contentType, dataModel)
+}
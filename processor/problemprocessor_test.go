@@ -0,0 +1,70 @@
+package processor_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/rickb777/negotiator/processor"
+)
+
+var problem = processor.ProblemDetails{
+	Type:   "https://example.com/probs/out-of-credit",
+	Title:  "You do not have enough credit.",
+	Status: 403,
+	Detail: "Your current balance is 30, but that costs 50.",
+}
+
+func TestProblemShouldProcessAcceptHeader(t *testing.T) {
+	g := NewGomegaWithT(t)
+	var acceptTests = []struct {
+		acceptheader string
+		json, xml    bool
+	}{
+		{"application/problem+json", true, false},
+		{"application/problem+xml", false, true},
+		{"application/json", false, false},
+		{"application/xml", false, false},
+	}
+
+	pj := processor.ProblemJSON()
+	px := processor.ProblemXML()
+
+	for _, tt := range acceptTests {
+		g.Expect(pj.CanProcess(tt.acceptheader, "")).To(Equal(tt.json), "JSON should process "+tt.acceptheader)
+		g.Expect(px.CanProcess(tt.acceptheader, "")).To(Equal(tt.xml), "XML should process "+tt.acceptheader)
+	}
+	g.Expect(pj.ContentType()).To(Equal("application/problem+json"))
+	g.Expect(px.ContentType()).To(Equal("application/problem+xml"))
+}
+
+func TestProblemShouldWriteResponseBody(t *testing.T) {
+	g := NewGomegaWithT(t)
+	models := []struct {
+		p        processor.ResponseProcessor
+		data     interface{}
+		expected string
+	}{
+		{processor.ProblemJSON(), problem,
+			`{"type":"https://example.com/probs/out-of-credit","title":"You do not have enough credit.","status":403,"detail":"Your current balance is 30, but that costs 50."}` + "\n"},
+		{processor.ProblemJSON(), &processor.ProblemDetails{Status: 404}, `{"status":404}` + "\n"},
+		{processor.ProblemXML(), &processor.ProblemDetails{Title: "Not found", Status: 404},
+			`<problem xmlns="urn:ietf:rfc:7807"><title>Not found</title><status>404</status></problem>` + "\n"},
+	}
+
+	for _, m := range models {
+		recorder := httptest.NewRecorder()
+		err := m.p.Process(recorder, "", m.data)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(recorder.Body.String()).To(Equal(m.expected))
+	}
+}
+
+func TestProblemShouldReturnErrorForOtherTypes(t *testing.T) {
+	g := NewGomegaWithT(t)
+	recorder := httptest.NewRecorder()
+
+	err := processor.ProblemJSON().Process(recorder, "", map[string]string{"title": "oops"})
+
+	g.Expect(err).To(MatchError("Unsupported type for application/problem+json: map[string]string"))
+}
@@ -2,7 +2,13 @@
 // JSON, XML, CSV and plain text.
 package processor
 
-import "net/http"
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/rickb777/negotiator/header"
+)
 
 // ResponseProcessor interface creates the contract for custom content negotiation.
 type ResponseProcessor interface {
@@ -11,13 +17,175 @@ type ResponseProcessor interface {
 	CanProcess(mediaRange string, lang string) bool
 	// ContentType returns the content type for this response.
 	ContentType() string
-	// Process renders the data model to the response writer, without setting any headers.
+	// Process renders the data model to the response writer, without setting any headers
+	// or calling WriteHeader, because the status code has already been chosen.
 	// If the processor encounters an error, it should panic.
 	Process(w http.ResponseWriter, template string, dataModel interface{}) error
 }
 
+// Renderer interface provides for those response processors that can write the data model
+// to any io.Writer, not just to an http.ResponseWriter. This allows serialisation to be
+// used independently of HTTP, e.g. for message queue payloads.
+type Renderer interface {
+	// RenderTo renders the data model to the writer.
+	RenderTo(w io.Writer, template string, dataModel interface{}) error
+}
+
+// Decoder interface provides for those response processors that can also read their format,
+// e.g. to unmarshal request bodies. Decode unmarshals the data from the reader into v, which
+// should be a pointer.
+type Decoder interface {
+	Decode(r io.Reader, v interface{}) error
+}
+
+// MediaRangeAware interface provides for those response processors that adapt their output
+// to the media range that was matched during negotiation, e.g. to echo the requested media
+// type in the Content-Type header. The processor returned by ForMediaRange is used instead
+// for that response only; it must not modify the original processor.
+type MediaRangeAware interface {
+	ForMediaRange(matched header.MediaRange) ResponseProcessor
+}
+
+// LanguageAware interface provides for those response processors that adapt their output
+// to the language that was chosen during negotiation. The processor returned by ForLanguage
+// is used instead for that response only; it must not modify the original processor.
+type LanguageAware interface {
+	ForLanguage(language string) ResponseProcessor
+}
+
+// TemplateAware interface provides for those response processors that adapt their output,
+// including the Content-Type, to the template name of the chosen offer. The processor returned
+// by ForTemplate is used instead for that response only; it must not modify the original
+// processor.
+type TemplateAware interface {
+	ForTemplate(template string) ResponseProcessor
+}
+
+// RequestAware interface provides for those response processors that adapt their output
+// to the request, e.g. to its query parameters. The processor returned by ForRequest is used
+// instead for that response only; it must not modify the original processor. It is not
+// used by RenderValues, which has no request.
+type RequestAware interface {
+	ForRequest(req *http.Request) ResponseProcessor
+}
+
+// Validator interface provides for those response processors that can check in advance
+// whether they are able to render a data model, e.g. at startup. ValidateData returns an
+// error describing why the data model cannot be rendered, or nil if it is probably fine.
+type Validator interface {
+	ValidateData(template string, dataModel interface{}) error
+}
+
 // ContentTypeSettable interface provides for those response processors that allow the
 // response Content-Type to be set explicitly.
 type ContentTypeSettable interface {
 	WithContentType(contentType string) ResponseProcessor
 }
+
+// TrailingNewlineSettable interface provides for those response processors that allow the
+// trailing newline at the end of the response body to be suppressed.
+type TrailingNewlineSettable interface {
+	WithTrailingNewline(newline bool) ResponseProcessor
+}
+
+// Downloadable interface provides for those response processors whose output is normally
+// saved as a file by the client, e.g. CSV. When the negotiated offer has a filename,
+// the response will include a suitable Content-Disposition header.
+//
+// IsDownload returns a value rather than the interface being a mere marker so that
+// processors that wrap other processors can report what the wrapped processor does.
+type Downloadable interface {
+	IsDownload() bool
+}
+
+// Verbatim interface provides for those response processors that write []byte and
+// io.Reader data unchanged, e.g. Binary. Only then can byte ranges of the data be served
+// (see negotiator.WithRangeSupport), because a part of the data is then a part of the
+// response body.
+//
+// IsVerbatim returns a value rather than the interface being a mere marker so that
+// processors that wrap other processors can report what the wrapped processor does.
+type Verbatim interface {
+	IsVerbatim() bool
+}
+
+// EchoSettable interface provides for those response processors that can echo the matched
+// media type as the response Content-Type. This can be disabled if not needed.
+type EchoSettable interface {
+	WithEcho(echo bool) ResponseProcessor
+}
+
+// TableSettable interface provides for those response processors that write tables and can
+// pad the columns so that they line up, which is easier to read in a terminal.
+type TableSettable interface {
+	WithAlignedColumns(aligned bool) ResponseProcessor
+}
+
+// BOMSettable interface provides for those response processors that can start their
+// output with a UTF-8 byte-order mark, which some spreadsheet programs need.
+type BOMSettable interface {
+	WithBOM(bom bool) ResponseProcessor
+}
+
+// WithCharset sets the charset parameter of the Content-Type of a processor that is
+// ContentTypeSettable, replacing any existing charset parameter, e.g.
+//
+//	processor.WithCharset(processor.TXT(), "iso-8859-1")
+//
+// gives "text/plain; charset=iso-8859-1". An empty charset removes the parameter. Other
+// parameters are kept. Processors that are not ContentTypeSettable are returned unchanged.
+func WithCharset(p ResponseProcessor, charset string) ResponseProcessor {
+	settable, ok := p.(ContentTypeSettable)
+	if !ok {
+		return p
+	}
+	return settable.WithContentType(replaceCharset(p.ContentType(), charset))
+}
+
+// MatchesSuffix tests whether a media range has a structured syntax suffix (RFC 6839), e.g.
+// "application/geo+json" has the suffix "json". The suffix may be given with or without
+// its leading "+". Case is ignored, as are any parameters.
+func MatchesSuffix(mediaRange, suffix string) bool {
+	mediaType, _ := split(mediaRange, ';')
+	mediaType = strings.TrimSpace(mediaType)
+	suffix = "+" + strings.TrimPrefix(suffix, "+")
+	return len(mediaType) >= len(suffix) &&
+		strings.EqualFold(mediaType[len(mediaType)-len(suffix):], suffix)
+}
+
+// replaceMediaType substitutes the media type in a content type, keeping its parameters.
+func replaceMediaType(contentType, mediaType string) string {
+	i := strings.IndexByte(contentType, ';')
+	if i < 0 {
+		return mediaType
+	}
+	return mediaType + contentType[i:]
+}
+
+// replaceCharset removes any charset parameters from a content type, then appends the
+// charset unless it is blank.
+func replaceCharset(contentType, charset string) string {
+	parts := strings.Split(contentType, ";")
+	kept := []string{strings.TrimSpace(parts[0])}
+	for _, param := range parts[1:] {
+		key, _ := split(param, '=')
+		param = strings.TrimSpace(param)
+		if param != "" && !strings.EqualFold(strings.TrimSpace(key), "charset") {
+			kept = append(kept, param)
+		}
+	}
+
+	charset = strings.TrimSpace(charset)
+	if charset != "" {
+		kept = append(kept, "charset="+charset)
+	}
+	return strings.Join(kept, "; ")
+}
+
+func split(value string, b byte) (string, string) {
+	i := strings.IndexByte(value, b)
+	if i < 0 {
+		return value, ""
+	}
+	return value[:i], value[i+1:]
+}
@@ -0,0 +1,53 @@
+package processor_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/rickb777/negotiator/processor"
+)
+
+func TestWithCharsetShouldReplaceCharsetParameter(t *testing.T) {
+	g := NewGomegaWithT(t)
+	models := []struct {
+		p        func() processor.ResponseProcessor
+		charset  string
+		expected string
+	}{
+		{func() processor.ResponseProcessor { return processor.JSON() }, "utf-16", "application/json; charset=utf-16"},
+		{func() processor.ResponseProcessor { return processor.XML() }, "iso-8859-1", "application/xml; charset=iso-8859-1"},
+		{func() processor.ResponseProcessor { return processor.CSV() }, "windows-1252", "text/csv; charset=windows-1252"},
+		{func() processor.ResponseProcessor { return processor.TXT() }, "utf-8", "text/plain; charset=utf-8"},
+		{func() processor.ResponseProcessor { return processor.YAML() }, "utf-8", "application/yaml; charset=utf-8"},
+		{func() processor.ResponseProcessor { return processor.TXT() }, "", "text/plain"},
+		{func() processor.ResponseProcessor {
+			return processor.TXT().(processor.ContentTypeSettable).WithContentType("text/plain;format=flowed; Charset=utf-8")
+		}, "us-ascii", "text/plain; format=flowed; charset=us-ascii"},
+		{func() processor.ResponseProcessor {
+			return processor.TXT().(processor.ContentTypeSettable).WithContentType("text/plain; charset=utf-8; charset=latin1")
+		}, "utf-8", "text/plain; charset=utf-8"},
+	}
+
+	for _, m := range models {
+		p := processor.WithCharset(m.p(), m.charset)
+
+		g.Expect(p.ContentType()).To(Equal(m.expected))
+	}
+}
+
+func TestWithCharsetShouldNotDuplicateCharset(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	p := processor.WithCharset(processor.WithCharset(processor.JSON(), "utf-8"), "UTF-8")
+
+	g.Expect(p.ContentType()).To(Equal("application/json; charset=UTF-8"))
+}
+
+func TestWithCharsetShouldIgnoreProcessorsWithFixedContentType(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	p := processor.ProblemJSON()
+
+	g.Expect(processor.WithCharset(p, "utf-8")).To(BeIdenticalTo(p))
+	g.Expect(p.ContentType()).To(Equal("application/problem+json"))
+}
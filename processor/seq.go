@@ -0,0 +1,59 @@
+package processor
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Seq is a lazy source of values for streaming processors, such as YAMLStream. Next returns
+// each value in turn, then false when there are no more. Unlike a slice, the values need not
+// all be in memory at once, and unlike a channel, no goroutine is needed to produce them.
+type Seq interface {
+	Next() (interface{}, bool)
+}
+
+// ForEach calls fn for each value of a Seq, a slice, an array or a receivable channel, in
+// order, stopping at the first error. A channel is read until it is closed. This is how
+// streaming processors consume their data models. The result is false, without calling fn,
+// if the data model is not one of these kinds; streaming processors then usually render it
+// as a single value.
+func ForEach(dataModel interface{}, fn func(i int, v interface{}) error) (bool, error) {
+	if seq, ok := dataModel.(Seq); ok {
+		for i := 0; ; i++ {
+			v, more := seq.Next()
+			if !more {
+				return true, nil
+			}
+			if err := fn(i, v); err != nil {
+				return true, err
+			}
+		}
+	}
+
+	value := reflect.ValueOf(dataModel)
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			if err := fn(i, value.Index(i).Interface()); err != nil {
+				return true, err
+			}
+		}
+		return true, nil
+
+	case reflect.Chan:
+		if value.Type().ChanDir()&reflect.RecvDir == 0 {
+			return true, fmt.Errorf("Unsupported type for streaming: %T", dataModel)
+		}
+		for i := 0; ; i++ {
+			v, ok := value.Recv()
+			if !ok {
+				return true, nil
+			}
+			if err := fn(i, v.Interface()); err != nil {
+				return true, err
+			}
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,76 @@
+package processor_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/rickb777/negotiator/processor"
+)
+
+// countdown is a Seq of the integers from n down to 1.
+type countdown struct {
+	n int
+}
+
+func (c *countdown) Next() (interface{}, bool) {
+	if c.n == 0 {
+		return nil, false
+	}
+	c.n--
+	return c.n + 1, true
+}
+
+func TestForEachShouldVisitEachValueInOrder(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	ch := make(chan int, 3)
+	ch <- 3
+	ch <- 2
+	ch <- 1
+	close(ch)
+
+	models := []interface{}{
+		&countdown{3},
+		[]int{3, 2, 1},
+		[3]int{3, 2, 1},
+		ch,
+	}
+
+	for _, m := range models {
+		var visited []interface{}
+		ok, err := processor.ForEach(m, func(i int, v interface{}) error {
+			g.Expect(i).To(Equal(len(visited)))
+			visited = append(visited, v)
+			return nil
+		})
+
+		g.Expect(ok).To(BeTrue())
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(visited).To(Equal([]interface{}{3, 2, 1}))
+	}
+}
+
+func TestForEachShouldStopAtFirstError(t *testing.T) {
+	g := NewGomegaWithT(t)
+	seq := &countdown{3}
+
+	ok, err := processor.ForEach(seq, func(i int, v interface{}) error {
+		return errors.New("stop")
+	})
+
+	g.Expect(ok).To(BeTrue())
+	g.Expect(err).To(MatchError("stop"))
+	g.Expect(seq.n).To(Equal(2))
+}
+
+func TestForEachShouldIgnoreOtherValues(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	ok, err := processor.ForEach("abc", func(i int, v interface{}) error {
+		return errors.New("not called")
+	})
+
+	g.Expect(ok).To(BeFalse())
+	g.Expect(err).NotTo(HaveOccurred())
+}
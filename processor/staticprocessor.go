@@ -0,0 +1,69 @@
+package processor
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DefaultLanguage is the key used by Static for content that is used when there is
+// no content for the negotiated language.
+const DefaultLanguage = "*"
+
+type staticProcessor struct {
+	contentType string
+	byLang      map[string][]byte
+	content     []byte
+}
+
+// Static creates a processor that serves pre-rendered content. The data model is ignored;
+// instead, the content for the negotiated language is written. If there is no content for
+// that language, the content for its primary language subtag is used (e.g. "en" for "en-GB"),
+// or else the content for the DefaultLanguage key.
+//
+// CanProcess matches the media type of the content type, which is also used as the response
+// Content-Type. Note that offers still need non-nil data, otherwise the response will be
+// 204-No Content as usual.
+func Static(contentType string, byLang map[string][]byte) ResponseProcessor {
+	return &staticProcessor{contentType: contentType, byLang: byLang, content: byLang[DefaultLanguage]}
+}
+
+func (p *staticProcessor) ContentType() string {
+	return p.contentType
+}
+
+func (p *staticProcessor) CanProcess(mediaRange string, lang string) bool {
+	mediaType, _ := split(p.contentType, ';')
+	return strings.EqualFold(mediaRange, strings.TrimSpace(mediaType))
+}
+
+// ForLanguage implements LanguageAware for this type.
+func (p *staticProcessor) ForLanguage(language string) ResponseProcessor {
+	content, ok := p.byLang[language]
+	if !ok {
+		primary, _ := split(language, '-')
+		content, ok = p.byLang[primary]
+	}
+	if !ok {
+		return p
+	}
+
+	cp := *p
+	cp.content = content
+	return &cp
+}
+
+func (p *staticProcessor) Process(w http.ResponseWriter, template string, dataModel interface{}) error {
+	return p.RenderTo(w, template, dataModel)
+}
+
+// RenderTo implements Renderer for this type.
+func (p *staticProcessor) RenderTo(w io.Writer, _ string, _ interface{}) error {
+	if p.content == nil {
+		return fmt.Errorf("no static %s content", p.contentType)
+	}
+
+	_, err := w.Write(p.content)
+	return err
+}
@@ -0,0 +1,72 @@
+package processor_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/rickb777/negotiator/processor"
+)
+
+var staticPages = map[string][]byte{
+	"en":                      []byte("<p>Hello</p>"),
+	"fr":                      []byte("<p>Bonjour</p>"),
+	"de-CH":                   []byte("<p>Grüezi</p>"),
+	processor.DefaultLanguage: []byte("<p>Hi</p>"),
+}
+
+func TestStaticShouldProcessAcceptHeader(t *testing.T) {
+	g := NewGomegaWithT(t)
+	var acceptTests = []struct {
+		acceptheader string
+		expected     bool
+	}{
+		{"text/html", true},
+		{"TEXT/HTML", true},
+		{"text/*", false},
+		{"text/plain", false},
+	}
+
+	p := processor.Static("text/html; charset=utf-8", staticPages)
+
+	for _, tt := range acceptTests {
+		result := p.CanProcess(tt.acceptheader, "")
+		g.Expect(result).To(Equal(tt.expected), "Should process "+tt.acceptheader)
+	}
+	g.Expect(p.ContentType()).To(Equal("text/html; charset=utf-8"))
+}
+
+func TestStaticShouldWriteContentForLanguage(t *testing.T) {
+	g := NewGomegaWithT(t)
+	models := []struct {
+		lang     string
+		expected string
+	}{
+		{"en", "<p>Hello</p>"},
+		{"fr", "<p>Bonjour</p>"},
+		{"en-GB", "<p>Hello</p>"},
+		{"de-CH", "<p>Grüezi</p>"},
+		{"de", "<p>Hi</p>"},
+		{"*", "<p>Hi</p>"},
+	}
+
+	p := processor.Static("text/html", staticPages)
+
+	for _, m := range models {
+		recorder := httptest.NewRecorder()
+		err := p.(processor.LanguageAware).ForLanguage(m.lang).Process(recorder, "", "ignored")
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(recorder.Body.String()).To(Equal(m.expected), m.lang)
+	}
+}
+
+func TestStaticShouldReturnErrorWithoutContent(t *testing.T) {
+	g := NewGomegaWithT(t)
+	recorder := httptest.NewRecorder()
+
+	p := processor.Static("text/html", map[string][]byte{"en": []byte("Hello")})
+
+	err := p.(processor.LanguageAware).ForLanguage("fr").Process(recorder, "", "ignored")
+
+	g.Expect(err).To(HaveOccurred())
+}
@@ -0,0 +1,89 @@
+package processor
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/rickb777/negotiator/header"
+)
+
+type suffixed struct {
+	ResponseProcessor
+	suffixes []string
+}
+
+// decodingSuffixed is a suffixed processor whose wrapped processor is a Decoder, so that
+// only such wrappers claim to be Decoders themselves.
+type decodingSuffixed struct {
+	*suffixed
+}
+
+// Suffixed wraps a processor so that it also processes media ranges with any of the given
+// structured syntax suffixes (RFC 6839), e.g. Suffixed(cbor, "cbor") processes
+// "application/senml+cbor" as well as whatever the cbor processor handles itself.
+// See MatchesSuffix.
+//
+// The wrapper passes on the Renderer, Decoder, MediaRangeAware, LanguageAware, Downloadable
+// and Verbatim capabilities of the wrapped processor. Other settings should be applied to the wrapped
+// processor before it is wrapped.
+func Suffixed(base ResponseProcessor, suffixes ...string) ResponseProcessor {
+	return wrapSuffixed(base, suffixes)
+}
+
+func wrapSuffixed(base ResponseProcessor, suffixes []string) ResponseProcessor {
+	p := &suffixed{ResponseProcessor: base, suffixes: suffixes}
+	if _, ok := base.(Decoder); ok {
+		return decodingSuffixed{suffixed: p}
+	}
+	return p
+}
+
+func (p *suffixed) CanProcess(mediaRange string, lang string) bool {
+	for _, suffix := range p.suffixes {
+		if MatchesSuffix(mediaRange, suffix) {
+			return true
+		}
+	}
+	return p.ResponseProcessor.CanProcess(mediaRange, lang)
+}
+
+// RenderTo implements Renderer for this type.
+func (p *suffixed) RenderTo(w io.Writer, template string, dataModel interface{}) error {
+	if r, ok := p.ResponseProcessor.(Renderer); ok {
+		return r.RenderTo(w, template, dataModel)
+	}
+	return fmt.Errorf("%T is not a Renderer", p.ResponseProcessor)
+}
+
+// Decode implements Decoder for this type.
+func (p decodingSuffixed) Decode(r io.Reader, v interface{}) error {
+	return p.ResponseProcessor.(Decoder).Decode(r, v)
+}
+
+// ForMediaRange implements MediaRangeAware for this type.
+func (p *suffixed) ForMediaRange(matched header.MediaRange) ResponseProcessor {
+	if mra, ok := p.ResponseProcessor.(MediaRangeAware); ok {
+		return wrapSuffixed(mra.ForMediaRange(matched), p.suffixes)
+	}
+	return p
+}
+
+// ForLanguage implements LanguageAware for this type.
+func (p *suffixed) ForLanguage(language string) ResponseProcessor {
+	if la, ok := p.ResponseProcessor.(LanguageAware); ok {
+		return wrapSuffixed(la.ForLanguage(language), p.suffixes)
+	}
+	return p
+}
+
+// IsDownload implements Downloadable for this type.
+func (p *suffixed) IsDownload() bool {
+	d, ok := p.ResponseProcessor.(Downloadable)
+	return ok && d.IsDownload()
+}
+
+// IsVerbatim implements Verbatim for this type.
+func (p *suffixed) IsVerbatim() bool {
+	v, ok := p.ResponseProcessor.(Verbatim)
+	return ok && v.IsVerbatim()
+}
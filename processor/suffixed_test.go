@@ -0,0 +1,78 @@
+package processor_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/rickb777/negotiator/header"
+	"github.com/rickb777/negotiator/processor"
+)
+
+func TestMatchesSuffix(t *testing.T) {
+	g := NewGomegaWithT(t)
+	var suffixTests = []struct {
+		mediaRange, suffix string
+		expected           bool
+	}{
+		{"application/geo+json", "json", true},
+		{"application/geo+json", "+json", true},
+		{"Application/LD+JSON; profile=x", "json", true},
+		{"application/json", "json", false},
+		{"+json", "json", true},
+		{"application/geo+json", "xml", false},
+		{"image/svg+xml", "xml", true},
+	}
+
+	for _, tt := range suffixTests {
+		result := processor.MatchesSuffix(tt.mediaRange, tt.suffix)
+		g.Expect(result).To(Equal(tt.expected), tt.mediaRange+" "+tt.suffix)
+	}
+}
+
+func TestSuffixedShouldProcessSuffixesAndBaseMediaTypes(t *testing.T) {
+	g := NewGomegaWithT(t)
+	var acceptTests = []struct {
+		acceptheader string
+		expected     bool
+	}{
+		{"text/plain", true},
+		{"application/senml+cbor", true},
+		{"application/cbor", false},
+		{"application/json", false},
+	}
+
+	p := processor.Suffixed(processor.TXT(), "cbor")
+
+	for _, tt := range acceptTests {
+		result := p.CanProcess(tt.acceptheader, "")
+		g.Expect(result).To(Equal(tt.expected), "Should process "+tt.acceptheader)
+	}
+	g.Expect(p.ContentType()).To(Equal("text/plain; charset=utf-8"))
+
+	buf := &bytes.Buffer{}
+	err := p.(processor.Renderer).RenderTo(buf, "", "hello")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(buf.String()).To(Equal("hello\n"))
+}
+
+func TestSuffixedShouldBeDecoderOnlyIfBaseIs(t *testing.T) {
+	g := NewGomegaWithT(t)
+	json := header.MediaRange{Type: "application", Subtype: "vnd.x+json"}
+
+	_, ok := processor.Suffixed(processor.TXT(), "json").(processor.Decoder)
+	g.Expect(ok).To(BeFalse())
+
+	p := processor.Suffixed(processor.JSON(), "json")
+	_, ok = p.(processor.Decoder)
+	g.Expect(ok).To(BeTrue())
+
+	_, ok = p.(processor.MediaRangeAware).ForMediaRange(json).(processor.Decoder)
+	g.Expect(ok).To(BeTrue())
+
+	var model map[string]string
+	err := p.(processor.Decoder).Decode(strings.NewReader(`{"Name":"Joe"}`), &model)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(model).To(Equal(map[string]string{"Name": "Joe"}))
+}
@@ -0,0 +1,81 @@
+package processor
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// TemplateExecutor is implemented by both *html/template.Template and *text/template.Template.
+type TemplateExecutor interface {
+	ExecuteTemplate(w io.Writer, name string, data interface{}) error
+}
+
+type templateProcessor struct {
+	ts                  TemplateExecutor
+	mediaTypeByTemplate map[string]string
+	contentType         string
+}
+
+// TemplateSet creates a processor that renders data using the template named by the offer,
+// e.g. "email.html" or "email.txt". The map gives the content type of each template, e.g.
+// "text/html; charset=utf-8"; this is used for the Content-Type response header.
+//
+// CanProcess matches any media type in the map, so offers should specify both the media type
+// and the template, e.g.
+//
+//	negotiator.Of(data).As("text/plain").WithTemplate("email.txt")
+func TemplateSet(ts TemplateExecutor, mediaTypeByTemplate map[string]string) ResponseProcessor {
+	p := &templateProcessor{ts: ts, mediaTypeByTemplate: mediaTypeByTemplate}
+
+	// the default content type doesn't depend on map iteration order
+	names := make([]string, 0, len(mediaTypeByTemplate))
+	for name := range mediaTypeByTemplate {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) > 0 {
+		p.contentType = mediaTypeByTemplate[names[0]]
+	}
+	return p
+}
+
+func (p *templateProcessor) ContentType() string {
+	return p.contentType
+}
+
+// ForTemplate implements TemplateAware for this type.
+func (p *templateProcessor) ForTemplate(template string) ResponseProcessor {
+	contentType, ok := p.mediaTypeByTemplate[template]
+	if !ok {
+		return p
+	}
+
+	cp := *p
+	cp.contentType = contentType
+	return &cp
+}
+
+func (p *templateProcessor) CanProcess(mediaRange string, lang string) bool {
+	for _, contentType := range p.mediaTypeByTemplate {
+		mediaType, _ := split(contentType, ';')
+		if strings.EqualFold(mediaRange, strings.TrimSpace(mediaType)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *templateProcessor) Process(w http.ResponseWriter, template string, dataModel interface{}) error {
+	return p.RenderTo(w, template, dataModel)
+}
+
+// RenderTo implements Renderer for this type.
+func (p *templateProcessor) RenderTo(w io.Writer, template string, dataModel interface{}) error {
+	if _, ok := p.mediaTypeByTemplate[template]; !ok {
+		return fmt.Errorf("Unknown template %q", template)
+	}
+	return p.ts.ExecuteTemplate(w, template, dataModel)
+}
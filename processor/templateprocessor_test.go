@@ -0,0 +1,77 @@
+package processor_test
+
+import (
+	htmltemplate "html/template"
+	"net/http/httptest"
+	"testing"
+	texttemplate "text/template"
+
+	. "github.com/onsi/gomega"
+	"github.com/rickb777/negotiator/processor"
+)
+
+var emailTypes = map[string]string{
+	"email.html": "text/html; charset=utf-8",
+	"email.txt":  "text/plain; charset=utf-8",
+}
+
+func TestTemplateSetShouldProcessAcceptHeader(t *testing.T) {
+	g := NewGomegaWithT(t)
+	var acceptTests = []struct {
+		acceptheader string
+		expected     bool
+	}{
+		{"text/html", true},
+		{"TEXT/PLAIN", true},
+		{"text/*", false},
+		{"application/json", false},
+	}
+
+	p := processor.TemplateSet(htmltemplate.New("x"), emailTypes)
+
+	for _, tt := range acceptTests {
+		result := p.CanProcess(tt.acceptheader, "")
+		g.Expect(result).To(Equal(tt.expected), "Should process "+tt.acceptheader)
+	}
+	g.Expect(p.ContentType()).To(Equal("text/html; charset=utf-8"))
+}
+
+func TestTemplateSetShouldUseTemplateForContentTypeAndBody(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	ts := texttemplate.Must(texttemplate.New("email.html").Parse(`<p>Hello {{.}}</p>`))
+	texttemplate.Must(ts.New("email.txt").Parse(`Hello {{.}}`))
+
+	models := []struct {
+		template, contentType, expected string
+	}{
+		{"email.html", "text/html; charset=utf-8", "<p>Hello Joe</p>"},
+		{"email.txt", "text/plain; charset=utf-8", "Hello Joe"},
+	}
+
+	p := processor.TemplateSet(ts, emailTypes)
+
+	for _, m := range models {
+		recorder := httptest.NewRecorder()
+		pt := p.(processor.TemplateAware).ForTemplate(m.template)
+		err := pt.Process(recorder, m.template, "Joe")
+
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(pt.ContentType()).To(Equal(m.contentType))
+		g.Expect(recorder.Body.String()).To(Equal(m.expected))
+	}
+
+	// the shared processor is unchanged
+	g.Expect(p.ContentType()).To(Equal("text/html; charset=utf-8"))
+}
+
+func TestTemplateSetShouldReturnErrorForUnknownTemplate(t *testing.T) {
+	g := NewGomegaWithT(t)
+	recorder := httptest.NewRecorder()
+
+	p := processor.TemplateSet(htmltemplate.New("x"), emailTypes)
+
+	err := p.Process(recorder, "other", "Joe")
+
+	g.Expect(err).To(MatchError(`Unknown template "other"`))
+}
@@ -3,6 +3,7 @@ package processor
 import (
 	"encoding"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 )
@@ -39,11 +40,21 @@ func (*txtProcessor) CanProcess(mediaRange string, lang string) bool {
 	return strings.EqualFold(mediaRange, "text/plain") || strings.EqualFold(mediaRange, "text/*")
 }
 
-func (p *txtProcessor) Process(w http.ResponseWriter, _ string, dataModel interface{}) error {
-	return p.doProcess(w, "", dataModel)
+func (p *txtProcessor) Process(w http.ResponseWriter, template string, dataModel interface{}) error {
+	return p.RenderTo(w, template, dataModel)
 }
 
-func (p *txtProcessor) doProcess(w http.ResponseWriter, _ string, dataModel interface{}) error {
+// ValidateData implements Validator for this type.
+func (p *txtProcessor) ValidateData(_ string, dataModel interface{}) error {
+	switch dataModel.(type) {
+	case string, fmt.Stringer, encoding.TextMarshaler:
+		return nil
+	}
+	return fmt.Errorf("Unsupported type for TXT: %T", dataModel)
+}
+
+// RenderTo implements Renderer for this type.
+func (p *txtProcessor) RenderTo(w io.Writer, _ string, dataModel interface{}) error {
 	s, ok := dataModel.(string)
 	if ok {
 		return WriteWithNewline(w, []byte(s))
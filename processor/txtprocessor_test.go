@@ -1,6 +1,7 @@
 package processor_test
 
 import (
+	"bytes"
 	"net/http/httptest"
 	"testing"
 
@@ -55,6 +56,18 @@ func TestTXTShouldSetResponseBody(t *testing.T) {
 	}
 }
 
+func TestTXTShouldRenderToWriter(t *testing.T) {
+	g := NewGomegaWithT(t)
+	buf := &bytes.Buffer{}
+
+	p := processor.TXT().(processor.Renderer)
+
+	err := p.RenderTo(buf, "", "Joe Bloggs")
+
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(buf.String()).To(Equal("Joe Bloggs\n"))
+}
+
 func TestTXTShouldReturnError(t *testing.T) {
 	g := NewGomegaWithT(t)
 	recorder := httptest.NewRecorder()
@@ -66,6 +79,16 @@ func TestTXTShouldReturnError(t *testing.T) {
 	g.Expect(err).To(HaveOccurred())
 }
 
+func TestTXTShouldValidateData(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	p := processor.TXT().(processor.Validator)
+
+	g.Expect(p.ValidateData("", "Joe Bloggs")).NotTo(HaveOccurred())
+	g.Expect(p.ValidateData("", tm{"Joe Bloggs"})).NotTo(HaveOccurred())
+	g.Expect(p.ValidateData("", make(chan int, 0))).To(HaveOccurred())
+}
+
 type tm struct {
 	s string
 }
@@ -5,6 +5,8 @@ import (
 	"io"
 	"net/http"
 	"strings"
+
+	"github.com/rickb777/negotiator/header"
 )
 
 const defaultXMLContentType = "application/xml; charset=utf-8"
@@ -12,16 +14,37 @@ const defaultXMLContentType = "application/xml; charset=utf-8"
 type xmlProcessor struct {
 	indent      string
 	contentType string
+	newline     bool
+	echo        bool
+	root        string
 }
 
-// XML creates a new processor for XML without indentation.
+// XML creates a new processor for XML without indentation. Its output never has a trailing
+// newline, so TrailingNewlineSettable has no effect on it.
+//
+// When the request matched a "+xml" media type, e.g. "image/svg+xml", or an "xml-" media
+// type, e.g. "application/xml-dtd", that media type is echoed in the Content-Type response
+// header by default, instead of "application/xml". Use EchoSettable to disable this.
 func XML() ResponseProcessor {
-	return &xmlProcessor{contentType: defaultXMLContentType}
+	return &xmlProcessor{contentType: defaultXMLContentType, newline: true, echo: true}
 }
 
 // IndentedXML creates a new processor for XML with a specified indentation.
+// It echoes the matched media type in the same way as XML.
 func IndentedXML(index string) ResponseProcessor {
-	return &xmlProcessor{indent: index, contentType: defaultXMLContentType}
+	return &xmlProcessor{indent: index, contentType: defaultXMLContentType, newline: true, echo: true}
+}
+
+// XMLDocument creates a new processor for complete XML documents without indentation. The
+// output starts with the XML declaration and the model is wrapped in a root element with
+// the given name, so a slice model becomes a sequence of child elements, e.g.
+//
+//	<?xml version="1.0" encoding="UTF-8"?>
+//	<users><User>...</User><User>...</User></users>
+//
+// Otherwise, it behaves like XML.
+func XMLDocument(rootName string) ResponseProcessor {
+	return &xmlProcessor{contentType: defaultXMLContentType, newline: true, echo: true, root: rootName}
 }
 
 func (p *xmlProcessor) ContentType() string {
@@ -34,19 +57,56 @@ func (p *xmlProcessor) WithContentType(contentType string) ResponseProcessor {
 	return p
 }
 
+// WithTrailingNewline implements TrailingNewlineSettable for this type.
+// By default, indented output is terminated by a newline. This has no effect
+// on non-indented output, which never has a trailing newline.
+func (p *xmlProcessor) WithTrailingNewline(newline bool) ResponseProcessor {
+	p.newline = newline
+	return p
+}
+
+// WithEcho implements EchoSettable for this type.
+func (p *xmlProcessor) WithEcho(echo bool) ResponseProcessor {
+	p.echo = echo
+	return p
+}
+
+// ForMediaRange implements MediaRangeAware for this type.
+func (p *xmlProcessor) ForMediaRange(matched header.MediaRange) ResponseProcessor {
+	if !p.echo || matched.Type == "*" {
+		return p
+	}
+
+	mediaType := matched.Type + "/" + matched.Subtype
+	if !MatchesSuffix(mediaType, "xml") &&
+		!strings.HasPrefix(mediaType, "application/xml-") &&
+		!strings.HasPrefix(mediaType, "text/xml-") {
+		return p
+	}
+
+	cp := *p
+	cp.contentType = replaceMediaType(p.contentType, mediaType)
+	return &cp
+}
+
 func (*xmlProcessor) CanProcess(mediaRange string, lang string) bool {
 	// see https://tools.ietf.org/html/rfc7303 XML Media Types
 	return mediaRange == "application/xml" || mediaRange == "text/xml" ||
-		strings.HasSuffix(mediaRange, "+xml") ||
+		MatchesSuffix(mediaRange, "xml") ||
 		strings.HasPrefix(mediaRange, "application/xml-") ||
 		strings.HasPrefix(mediaRange, "text/xml-")
 }
 
-func (p *xmlProcessor) Process(w http.ResponseWriter, _ string, dataModel interface{}) error {
-	return p.doProcess(w, "", dataModel)
+func (p *xmlProcessor) Process(w http.ResponseWriter, template string, dataModel interface{}) error {
+	return p.RenderTo(w, template, dataModel)
 }
 
-func (p *xmlProcessor) doProcess(w http.ResponseWriter, _ string, dataModel interface{}) error {
+// RenderTo implements Renderer for this type.
+func (p *xmlProcessor) RenderTo(w io.Writer, _ string, dataModel interface{}) error {
+	if p.root != "" {
+		return p.renderDocument(w, dataModel)
+	}
+
 	if p.indent == "" {
 		return xml.NewEncoder(w).Encode(dataModel)
 	}
@@ -56,9 +116,48 @@ func (p *xmlProcessor) doProcess(w http.ResponseWriter, _ string, dataModel inte
 		return err
 	}
 
+	if !p.newline {
+		_, err = w.Write(x)
+		return err
+	}
+
 	return WriteWithNewline(w, x)
 }
 
+// Decode implements Decoder for this type.
+func (p *xmlProcessor) Decode(r io.Reader, v interface{}) error {
+	return xml.NewDecoder(r).Decode(v)
+}
+
+// renderDocument writes the XML declaration followed by the model wrapped in the root element.
+func (p *xmlProcessor) renderDocument(w io.Writer, dataModel interface{}) error {
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	root := xml.StartElement{Name: xml.Name{Local: p.root}}
+	enc := xml.NewEncoder(w)
+	err = enc.EncodeToken(root)
+	if err != nil {
+		return err
+	}
+
+	if dataModel != nil {
+		err = enc.Encode(dataModel)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = enc.EncodeToken(root.End())
+	if err != nil {
+		return err
+	}
+
+	return enc.Flush()
+}
+
 // WriteWithNewline is a helper function that writes some bytes to a Writer. If the
 // byte slice is empty or if the last byte is *not* newline, an extra newline is
 // also written, as required for HTTP responses.
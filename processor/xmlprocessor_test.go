@@ -1,13 +1,16 @@
 package processor_test
 
 import (
+	"bytes"
 	"encoding/xml"
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	. "github.com/onsi/gomega"
+	"github.com/rickb777/negotiator/header"
 	"github.com/rickb777/negotiator/processor"
 )
 
@@ -39,6 +42,39 @@ func TestXMLShouldSetContentTypeHeader(t *testing.T) {
 	g.Expect(p.ContentType()).To(Equal("application/my+xml"))
 }
 
+func TestXMLShouldEchoXMLMediaTypes(t *testing.T) {
+	g := NewGomegaWithT(t)
+	cases := []struct {
+		matched  header.MediaRange
+		expected string
+	}{
+		{header.MediaRange{Type: "image", Subtype: "svg+xml"}, "image/svg+xml; charset=utf-8"},
+		{header.MediaRange{Type: "application", Subtype: "xml-dtd"}, "application/xml-dtd; charset=utf-8"},
+		{header.MediaRange{Type: "text", Subtype: "xml"}, "application/xml; charset=utf-8"},
+		{header.MediaRange{Type: "*", Subtype: "*"}, "application/xml; charset=utf-8"},
+	}
+
+	p := processor.XML()
+
+	for _, c := range cases {
+		actual := p.(processor.MediaRangeAware).ForMediaRange(c.matched)
+		g.Expect(actual.ContentType()).To(Equal(c.expected))
+	}
+
+	// the shared processor is unchanged
+	g.Expect(p.ContentType()).To(Equal("application/xml; charset=utf-8"))
+}
+
+func TestXMLShouldNotEchoMediaTypeWhenDisabled(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	p := processor.XML().(processor.EchoSettable).WithEcho(false)
+
+	actual := p.(processor.MediaRangeAware).ForMediaRange(header.MediaRange{Type: "image", Subtype: "svg+xml"})
+
+	g.Expect(actual.ContentType()).To(Equal("application/xml; charset=utf-8"))
+}
+
 func TestXMLShouldSetResponseBody(t *testing.T) {
 	g := NewGomegaWithT(t)
 	recorder := httptest.NewRecorder()
@@ -67,6 +103,43 @@ func TestXMlShouldSetResponseBodyWithIndentation(t *testing.T) {
 	g.Expect(recorder.Body.String()).To(Equal("<ValidXMLUser>\n  <Name>Joe Bloggs</Name>\n</ValidXMLUser>\n"))
 }
 
+func TestXMlShouldSetResponseBodyWithoutTrailingNewline(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	model := &ValidXMLUser{Name: "Joe Bloggs"}
+
+	models := []struct {
+		p        processor.ResponseProcessor
+		expected string
+	}{
+		{processor.XML(), "<ValidXMLUser><Name>Joe Bloggs</Name></ValidXMLUser>"},
+		{processor.IndentedXML("  "), "<ValidXMLUser>\n  <Name>Joe Bloggs</Name>\n</ValidXMLUser>"},
+	}
+
+	for _, m := range models {
+		recorder := httptest.NewRecorder()
+		p := m.p.(processor.TrailingNewlineSettable).WithTrailingNewline(false)
+
+		err := p.Process(recorder, "", model)
+
+		g.Expect(err).NotTo(HaveOccurred())
+
+		g.Expect(recorder.Body.String()).To(Equal(m.expected))
+	}
+}
+
+func TestXMLShouldRenderToWriter(t *testing.T) {
+	g := NewGomegaWithT(t)
+	buf := &bytes.Buffer{}
+
+	p := processor.IndentedXML("  ").(processor.Renderer)
+
+	err := p.RenderTo(buf, "", &ValidXMLUser{Name: "Joe Bloggs"})
+
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(buf.String()).To(Equal("<ValidXMLUser>\n  <Name>Joe Bloggs</Name>\n</ValidXMLUser>\n"))
+}
+
 func TestXMLShouldRPanicOnError(t *testing.T) {
 	g := NewGomegaWithT(t)
 	recorder := httptest.NewRecorder()
@@ -80,6 +153,51 @@ func TestXMLShouldRPanicOnError(t *testing.T) {
 	g.Expect(err).To(HaveOccurred())
 }
 
+func TestXMLDocumentShouldWrapSliceInRootElement(t *testing.T) {
+	g := NewGomegaWithT(t)
+	recorder := httptest.NewRecorder()
+
+	model := []ValidXMLUser{{Name: "Joe Bloggs"}, {Name: "Ann Other"}}
+
+	p := processor.XMLDocument("users")
+
+	err := p.Process(recorder, "", model)
+
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(p.ContentType()).To(Equal("application/xml; charset=utf-8"))
+	g.Expect(recorder.Body.String()).To(Equal(`<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+		"<users><ValidXMLUser><Name>Joe Bloggs</Name></ValidXMLUser><ValidXMLUser><Name>Ann Other</Name></ValidXMLUser></users>"))
+}
+
+func TestXMLDocumentShouldWriteEmptyRootElementForNil(t *testing.T) {
+	g := NewGomegaWithT(t)
+	buf := &bytes.Buffer{}
+
+	err := processor.XMLDocument("users").(processor.Renderer).RenderTo(buf, "", nil)
+
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(buf.String()).To(Equal(`<?xml version="1.0" encoding="UTF-8"?>` + "\n<users></users>"))
+}
+
+func TestXMLDocumentShouldReturnErrorFromModel(t *testing.T) {
+	g := NewGomegaWithT(t)
+	recorder := httptest.NewRecorder()
+
+	err := processor.XMLDocument("users").Process(recorder, "", []*XMLUser{{Name: "Joe Bloggs"}})
+
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestXMLShouldDecode(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	var model ValidXMLUser
+	err := processor.XML().(processor.Decoder).Decode(strings.NewReader("<ValidXMLUser><Name>Joe</Name></ValidXMLUser>"), &model)
+
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(model.Name).To(Equal("Joe"))
+}
+
 type ValidXMLUser struct {
 	Name string
 }
@@ -0,0 +1,98 @@
+package processor
+
+import (
+	"io"
+	"net/http"
+
+	"gopkg.in/yaml.v2"
+)
+
+const defaultYAMLContentType = "application/yaml"
+
+var yamlDocumentSeparator = []byte("---\n")
+
+type yamlProcessor struct {
+	contentType string
+	stream      bool
+}
+
+// YAML creates a new processor for YAML. The data is written as a single YAML document.
+func YAML() ResponseProcessor {
+	return &yamlProcessor{contentType: defaultYAMLContentType}
+}
+
+// YAMLStream creates a new processor for a stream of YAML documents. The model value should
+// be a Seq, a slice, an array or a receivable channel (see ForEach); each element is written
+// as a separate YAML document, with "---" separators between them, e.g. for "kubectl"-style
+// multi-document output. If the response writer is an http.Flusher, it is flushed after
+// each document. Any other model value is written as a single document.
+func YAMLStream() ResponseProcessor {
+	return &yamlProcessor{contentType: defaultYAMLContentType, stream: true}
+}
+
+func (p *yamlProcessor) ContentType() string {
+	return p.contentType
+}
+
+// WithContentType implements ContentTypeSettable for this type.
+func (p *yamlProcessor) WithContentType(contentType string) ResponseProcessor {
+	p.contentType = contentType
+	return p
+}
+
+func (*yamlProcessor) CanProcess(mediaRange string, lang string) bool {
+	// see https://www.rfc-editor.org/rfc/rfc9512 YAML Media Type
+	return mediaRange == "application/yaml" || mediaRange == "application/x-yaml" ||
+		mediaRange == "text/yaml" || mediaRange == "text/x-yaml" ||
+		MatchesSuffix(mediaRange, "yaml")
+}
+
+func (p *yamlProcessor) Process(w http.ResponseWriter, template string, dataModel interface{}) error {
+	return p.RenderTo(w, template, dataModel)
+}
+
+// RenderTo implements Renderer for this type.
+func (p *yamlProcessor) RenderTo(w io.Writer, _ string, dataModel interface{}) error {
+	if !p.stream {
+		return writeYAML(w, dataModel)
+	}
+
+	ok, err := ForEach(dataModel, func(i int, v interface{}) error {
+		return writeYAMLDocument(w, i, v)
+	})
+	if ok {
+		return err
+	}
+
+	return writeYAML(w, dataModel)
+}
+
+// writeYAMLDocument writes the i'th document of a stream, preceded by a separator unless it
+// is the first, then flushes the writer if possible.
+func writeYAMLDocument(w io.Writer, i int, dataModel interface{}) error {
+	if i > 0 {
+		_, err := w.Write(yamlDocumentSeparator)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := writeYAML(w, dataModel)
+	if err != nil {
+		return err
+	}
+
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+func writeYAML(w io.Writer, dataModel interface{}) error {
+	y, err := yaml.Marshal(dataModel)
+	if err != nil {
+		return err
+	}
+
+	return WriteWithNewline(w, y)
+}
@@ -0,0 +1,110 @@
+package processor_test
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/rickb777/negotiator/processor"
+)
+
+type person struct {
+	Name string
+	Age  int
+}
+
+func TestYAMLShouldProcessAcceptHeader(t *testing.T) {
+	g := NewGomegaWithT(t)
+	var acceptTests = []struct {
+		acceptheader string
+		expected     bool
+	}{
+		{"application/yaml", true},
+		{"application/x-yaml", true},
+		{"text/yaml", true},
+		{"application/vnd.foo+yaml", true},
+		{"application/json", false},
+	}
+
+	p := processor.YAMLStream()
+
+	for _, tt := range acceptTests {
+		result := p.CanProcess(tt.acceptheader, "")
+		g.Expect(result).To(Equal(tt.expected), "Should process "+tt.acceptheader)
+	}
+}
+
+func TestYAMLShouldWriteSingleDocument(t *testing.T) {
+	g := NewGomegaWithT(t)
+	recorder := httptest.NewRecorder()
+
+	p := processor.YAML()
+
+	err := p.Process(recorder, "", person{Name: "Joe", Age: 42})
+
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(p.ContentType()).To(Equal("application/yaml"))
+	g.Expect(recorder.Body.String()).To(Equal("name: Joe\nage: 42\n"))
+}
+
+func TestYAMLStreamShouldWriteSliceAsSeparateDocuments(t *testing.T) {
+	g := NewGomegaWithT(t)
+	recorder := httptest.NewRecorder()
+
+	p := processor.YAMLStream()
+
+	err := p.Process(recorder, "", []person{{Name: "Joe", Age: 42}, {Name: "Ann", Age: 37}})
+
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(p.ContentType()).To(Equal("application/yaml"))
+	g.Expect(recorder.Body.String()).To(Equal("name: Joe\nage: 42\n---\nname: Ann\nage: 37\n"))
+	g.Expect(recorder.Flushed).To(BeTrue())
+}
+
+func TestYAMLStreamShouldWriteChannelAsSeparateDocuments(t *testing.T) {
+	g := NewGomegaWithT(t)
+	buf := &bytes.Buffer{}
+
+	ch := make(chan person, 3)
+	ch <- person{Name: "Joe", Age: 42}
+	ch <- person{Name: "Ann", Age: 37}
+	ch <- person{Name: "Sam", Age: 8}
+	close(ch)
+
+	p := processor.YAMLStream().(processor.Renderer)
+
+	err := p.RenderTo(buf, "", ch)
+
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(buf.String()).To(Equal("name: Joe\nage: 42\n---\nname: Ann\nage: 37\n---\nname: Sam\nage: 8\n"))
+}
+
+func TestYAMLStreamShouldWriteSeqAsSeparateDocuments(t *testing.T) {
+	g := NewGomegaWithT(t)
+	recorder := httptest.NewRecorder()
+
+	err := processor.YAMLStream().Process(recorder, "", &countdown{3})
+
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(recorder.Body.String()).To(Equal("3\n---\n2\n---\n1\n"))
+}
+
+func TestYAMLStreamShouldWriteOtherValuesAsOneDocument(t *testing.T) {
+	g := NewGomegaWithT(t)
+	recorder := httptest.NewRecorder()
+
+	err := processor.YAMLStream().Process(recorder, "", person{Name: "Joe", Age: 42})
+
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(recorder.Body.String()).To(Equal("name: Joe\nage: 42\n"))
+}
+
+func TestYAMLStreamShouldRejectSendOnlyChannel(t *testing.T) {
+	g := NewGomegaWithT(t)
+	recorder := httptest.NewRecorder()
+
+	err := processor.YAMLStream().Process(recorder, "", make(chan<- person))
+
+	g.Expect(err).To(HaveOccurred())
+}
@@ -0,0 +1,191 @@
+package negotiator
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Range is the request header for part of a representation (RFC 7233).
+	Range = "Range"
+	// IfRange is the request header that makes a Range request conditional on the ETag.
+	IfRange = "If-Range"
+)
+
+// WithRangeSupport enables byte-range requests for offers whose data is an io.ReadSeeker,
+// e.g. a generated file, when the chosen processor writes the data verbatim, i.e. it is a
+// processor.Verbatim such as processor.Binary. Such responses have an "Accept-Ranges: bytes"
+// header; other processors transform the data, so ranges of it are not offered. When a GET
+// request has a Range header with a single byte range, the response is 206-Partial Content
+// with a Content-Range header, and only that part of the data is written verbatim, without
+// any content coding. A range that starts beyond the end of the data gives 416-Range Not
+// Satisfiable via the error handler.
+//
+// Requests with several ranges, malformed ranges or an If-Range header that does not match
+// the offer's ETag get the whole data as usual. Data that is not seekable ignores ranges.
+func (n *Negotiator) WithRangeSupport() *Negotiator {
+	c := n.Clone()
+	c.ranges = true
+	return c
+}
+
+// checkRange serves part of the chosen offer if the request has a satisfiable Range header.
+func (n *Negotiator) checkRange(rv requestValues, r *renderer) CodedRender {
+	rs, ok := r.data.(io.ReadSeeker)
+	if !ok || !r.verbatim {
+		return r
+	}
+
+	r.acceptRanges = true
+	if rv.req == nil || rv.req.Method != http.MethodGet {
+		return r
+	}
+
+	spec := headerValue(rv.req, Range)
+	if spec == "" || !ifRangeMatches(rv.req, r.offer) {
+		return r
+	}
+
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err == nil {
+		_, err = rs.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		return r
+	}
+
+	start, end, valid, satisfiable := parseRange(spec, size)
+	if !valid {
+		return r
+	}
+
+	if !satisfiable {
+		info2("416 range not satisfiable", "Range", spec, "Size", size)
+		eh, contentType := n.errorHandlerFor(rv, Offers{r.offer})
+		return rangeNotSatisfiable{errorHandler: eh, contentType: contentType, size: size, reason: rv.reason(RangeNotSatisfiable, "")}
+	}
+
+	return &partialContent{renderer: r, data: rs, start: start, end: end, size: size}
+}
+
+// ifRangeMatches tests whether there is no If-Range header or it matches the strong ETag of
+// the offer. Dates are not supported, so they never match.
+func ifRangeMatches(req *http.Request, offer Offer) bool {
+	ifRange := req.Header.Get(IfRange)
+	if ifRange == "" {
+		return true
+	}
+	etag := entityTag(offer.ETag)
+	return offer.ETag != "" && !strings.HasPrefix(etag, "W/") && strings.TrimSpace(ifRange) == etag
+}
+
+// parseRange parses a Range header with a single byte range, e.g. "bytes=0-499", "bytes=500-"
+// or "bytes=-500", giving the first and last positions. The result is not valid if the
+// header is malformed or has several ranges; these are ignored.
+func parseRange(spec string, size int64) (start, end int64, valid, satisfiable bool) {
+	const prefix = "bytes="
+	if len(spec) < len(prefix) || !strings.EqualFold(spec[:len(prefix)], prefix) {
+		return 0, 0, false, false
+	}
+
+	first, last := split(strings.TrimSpace(spec[len(prefix):]), '-')
+	if strings.IndexByte(last, ',') >= 0 || strings.IndexByte(spec, '-') < 0 {
+		return 0, 0, false, false
+	}
+	first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+
+	if first == "" {
+		// suffix range, i.e. the last n bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, false, false
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, true, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size - 1, true, true
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false, false
+	}
+
+	end = size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+
+	if start >= size {
+		return 0, 0, true, false
+	}
+	return start, end, true, true
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// partialContent is the 206 response for a satisfiable byte range.
+type partialContent struct {
+	*renderer
+	data       io.ReadSeeker
+	start, end int64
+	size       int64
+}
+
+func (r *partialContent) StatusCode() int {
+	return http.StatusPartialContent
+}
+
+func (r *partialContent) WriteContentType(w http.ResponseWriter) {
+	r.renderer.WriteContentType(w)
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", r.start, r.end, r.size))
+	w.Header().Set("Content-Length", strconv.FormatInt(r.end-r.start+1, 10))
+}
+
+func (r *partialContent) Render(w http.ResponseWriter) error {
+	_, err := r.data.Seek(r.start, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(w, r.data, r.end-r.start+1)
+	return err
+}
+
+//-------------------------------------------------------------------------------------------------
+
+type rangeNotSatisfiable struct {
+	errorHandler ErrorHandler
+	contentType  string
+	size         int64
+	reason       Reason
+}
+
+func (r rangeNotSatisfiable) Empty() bool {
+	return false
+}
+
+func (r rangeNotSatisfiable) StatusCode() int {
+	return http.StatusRequestedRangeNotSatisfiable
+}
+
+func (r rangeNotSatisfiable) WriteContentType(w http.ResponseWriter) {
+	writeErrorContentType(w, r.contentType)
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", r.size))
+}
+
+func (r rangeNotSatisfiable) Render(w http.ResponseWriter) error {
+	r.errorHandler(w, "the requested range is not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+	return nil
+}
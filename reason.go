@@ -0,0 +1,115 @@
+package negotiator
+
+import (
+	"net/http"
+
+	"github.com/rickb777/negotiator/header"
+)
+
+// Cause is the reason why no offer was chosen.
+type Cause int
+
+const (
+	// Acceptable means that an offer was chosen, i.e. there was no problem.
+	Acceptable Cause = iota
+	// NoProcessor means that no processor can render the offers that were accepted.
+	NoProcessor
+	// MediaTypeMismatch means that the accepted media ranges do not match any offer.
+	MediaTypeMismatch
+	// LanguageMismatch means that some offers have an accepted media type, but none of
+	// these is in an accepted language.
+	LanguageMismatch
+	// CharsetMismatch means that some offers have an accepted media type and language, but
+	// none of their processors uses an accepted charset, given by Accept-Charset or by a
+	// charset parameter in the Accept header.
+	CharsetMismatch
+	// EncodingMismatch means that the chosen offer is pre-encoded with a coding that the
+	// client does not accept and that cannot be decoded.
+	EncodingMismatch
+	// AllExcluded means that the client excluded every offer with a zero quality, e.g. "*/*;q=0".
+	AllExcluded
+	// MalformedHeader means that a request header could not be parsed, giving 400-Bad Request.
+	MalformedHeader
+	// PreconditionFailed means that the If-Match header did not match the ETag of the chosen
+	// offer, giving 412-Precondition Failed.
+	PreconditionFailed
+	// RangeNotSatisfiable means that the Range header did not overlap the data of the chosen
+	// offer, giving 416-Range Not Satisfiable.
+	RangeNotSatisfiable
+)
+
+var causeNames = []string{"acceptable", "no processor", "media type mismatch", "language mismatch",
+	"charset mismatch", "encoding mismatch", "excluded", "malformed header",
+	"precondition failed", "range not satisfiable"}
+
+func (c Cause) String() string {
+	if c < 0 || int(c) >= len(causeNames) {
+		return "unknown"
+	}
+	return causeNames[c]
+}
+
+// Reason describes why a request was not satisfied, along with the request headers that
+// were involved. It is returned by RenderResult.
+type Reason struct {
+	Cause          Cause
+	Accept         string
+	AcceptLanguage string
+	AcceptCharset  string
+	// Message describes the problem with a malformed header; otherwise it is blank.
+	Message string
+}
+
+// RenderResult is like Render except that it also describes why the response is an error,
+// if it is one, e.g. so that clients can be given a more helpful error message. If an offer
+// was chosen, the Reason's Cause is Acceptable.
+func (n *Negotiator) RenderResult(req *http.Request, offers ...Offer) (CodedRender, Reason) {
+	cr := n.Render(req, offers...)
+	switch r := cr.(type) {
+	case unacceptable:
+		return cr, r.reason
+	case badRequest:
+		return cr, r.reason
+	case preconditionFailed:
+		return cr, r.reason
+	case rangeNotSatisfiable:
+		return cr, r.reason
+	}
+	return cr, Reason{Cause: Acceptable}
+}
+
+func (rv requestValues) reason(cause Cause, message string) Reason {
+	return Reason{
+		Cause:          cause,
+		Accept:         rv.accept,
+		AcceptLanguage: rv.acceptLanguage,
+		AcceptCharset:  rv.acceptCharset,
+		Message:        message,
+	}
+}
+
+// diagnose finds out why none of the offers was chosen. The remaining offers are those that
+// were not excluded.
+func diagnose(offers, remaining Offers, mrs header.MediaRanges, languages, charsets header.PrecedenceValues) Cause {
+	if len(remaining) == 0 && len(offers) > 0 {
+		return AllExcluded
+	}
+
+	cause := MediaTypeMismatch
+	for _, offer := range remaining {
+		for _, accepted := range mrs {
+			if accepted.Quality > 0 && nearMatch(accepted, header.PrecedenceValue{Value: "*"}, offer) {
+				cause = LanguageMismatch
+				for _, lang := range languages {
+					if lang.Quality > 0 && equalOrPrefix(lang.Value, offer.Language) {
+						if len(charsets) > 0 || paramValue(accepted.Params, "charset") != "" {
+							return CharsetMismatch
+						}
+						return NoProcessor
+					}
+				}
+			}
+		}
+	}
+	return cause
+}
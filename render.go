@@ -1,7 +1,16 @@
 package negotiator
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rickb777/negotiator/encoding"
 )
 
 // Render defines the interface for content renderers.
@@ -21,35 +30,321 @@ type CodedRender interface {
 	StatusCode() int
 }
 
+// EmptyReporter is implemented by the CodedRender values returned by Render. Empty is true
+// when there is no response body, i.e. for 204-No Content responses. This allows middleware
+// to skip work such as compression without relying on the status code, e.g.
+//
+//	if e, ok := cr.(negotiator.EmptyReporter); ok && e.Empty() { ... }
+type EmptyReporter interface {
+	Empty() bool
+}
+
 //-------------------------------------------------------------------------------------------------
 
 type renderer struct {
+	offer       Offer
 	data        interface{}
 	language    string
 	template    string
 	contentType string
+	filename    string
 	process     func(w http.ResponseWriter, template string, dataModel interface{}) error
+
+	preferenceApplied string
+
+	coding          encoding.Coding
+	contentEncoding string // of pre-encoded data
+	vary            []string
+	datetime        time.Time
+	maxBodySize     int64
+	verbatim        bool // the processor writes reader data unchanged
+	acceptRanges    bool
+}
+
+func (r renderer) Empty() bool {
+	return false
 }
 
 func (r renderer) StatusCode() int {
 	return http.StatusOK
 }
 
+// contentLanguage lists the language of the offer followed by any other languages that
+// the content contains.
+func (r *renderer) contentLanguage() string {
+	var languages []string
+	if r.language != "" && r.language != "*" {
+		languages = append(languages, r.language)
+	}
+	languages = append(languages, r.offer.Languages...)
+	return strings.Join(languages, ", ")
+}
+
 func (r *renderer) WriteContentType(w http.ResponseWriter) {
 	w.Header().Set("Content-Type", r.contentType)
-	if r.language != "" && r.language != "*" {
-		w.Header().Set("Content-Language", r.language)
+	if cl := r.contentLanguage(); cl != "" {
+		w.Header().Set("Content-Language", cl)
+	}
+	if r.preferenceApplied != "" {
+		w.Header().Set(PreferenceApplied, r.preferenceApplied)
+	}
+	if r.filename != "" {
+		w.Header().Set("Content-Disposition", contentDisposition(r.filename))
+	}
+	for _, v := range r.vary {
+		w.Header().Add("Vary", v)
+	}
+	if r.offer.ETag != "" {
+		w.Header().Set("ETag", entityTag(r.offer.ETag))
+	}
+	if !r.datetime.IsZero() {
+		w.Header().Set(MementoDatetime, r.datetime.UTC().Format(http.TimeFormat))
+	}
+	if r.acceptRanges && r.coding.NewWriter == nil {
+		w.Header().Set("Accept-Ranges", "bytes")
+	}
+	if r.coding.NewWriter != nil {
+		w.Header().Set("Content-Encoding", r.coding.Name)
+		w.Header().Del("Content-Length")
+	} else if r.contentEncoding != "" {
+		w.Header().Set("Content-Encoding", r.contentEncoding)
 	}
 }
 
 func (r *renderer) Render(w http.ResponseWriter) error {
-	return r.process(w, r.template, r.data)
+	if r.coding.NewWriter == nil {
+		return r.process(r.limit(w), r.template, r.data)
+	}
+
+	cw, err := r.coding.NewWriter(w)
+	if err != nil {
+		return err
+	}
+
+	err = r.process(r.limit(encodedResponseWriter{ResponseWriter: w, w: cw}), r.template, r.data)
+	if err != nil {
+		cw.Close()
+		return err
+	}
+	return cw.Close()
+}
+
+// limit applies the maximum body size, if there is one.
+func (r *renderer) limit(w http.ResponseWriter) http.ResponseWriter {
+	if r.maxBodySize <= 0 {
+		return w
+	}
+	return &limitedResponseWriter{ResponseWriter: w, remaining: r.maxBodySize}
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// bufferedRenderer holds a response that has already been rendered.
+type bufferedRenderer struct {
+	*renderer
+	body []byte
+	err  error
+}
+
+func bufferRendering(r *renderer) *bufferedRenderer {
+	w := &bufferedResponseWriter{header: make(http.Header)}
+	err := r.Render(w)
+	return &bufferedRenderer{renderer: r, body: w.buf.Bytes(), err: err}
+}
+
+func (r *bufferedRenderer) StatusCode() int {
+	if r.err != nil {
+		return http.StatusInternalServerError
+	}
+	return http.StatusOK
+}
+
+func (r *bufferedRenderer) WriteContentType(w http.ResponseWriter) {
+	if r.err == nil {
+		r.renderer.WriteContentType(w)
+		w.Header().Set("Content-Length", strconv.Itoa(len(r.body)))
+	}
+}
+
+func (r *bufferedRenderer) Render(w http.ResponseWriter) error {
+	if r.err != nil {
+		return r.err
+	}
+	_, err := w.Write(r.body)
+	return err
+}
+
+// bufferedResponseWriter collects the response body; its headers are discarded.
+type bufferedResponseWriter struct {
+	header http.Header
+	buf    bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedResponseWriter) Write(b []byte) (int, error) {
+	return w.buf.Write(b)
+}
+
+func (w *bufferedResponseWriter) WriteHeader(int) {}
+
+//-------------------------------------------------------------------------------------------------
+
+// CapturedResponse is a response captured by NegotiateCapture instead of being sent.
+type CapturedResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// captureResponseWriter collects the status code, headers and body of a response.
+type captureResponseWriter struct {
+	captured *CapturedResponse
+	buf      bytes.Buffer
+}
+
+func (w *captureResponseWriter) Header() http.Header {
+	return w.captured.Header
+}
+
+func (w *captureResponseWriter) Write(b []byte) (int, error) {
+	if w.captured.StatusCode == 0 {
+		w.captured.StatusCode = http.StatusOK
+	}
+	return w.buf.Write(b)
+}
+
+func (w *captureResponseWriter) WriteHeader(code int) {
+	if w.captured.StatusCode == 0 {
+		w.captured.StatusCode = code
+	}
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// deferredHeaderWriter writes a predetermined status code when the body is first written,
+// so that headers set while rendering are not lost. Other WriteHeader calls are ignored.
+type deferredHeaderWriter struct {
+	http.ResponseWriter
+	status  int
+	written bool
+}
+
+func (w *deferredHeaderWriter) writeHeader() {
+	if !w.written {
+		w.written = true
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+func (w *deferredHeaderWriter) WriteHeader(int) {
+	w.writeHeader()
+}
+
+func (w *deferredHeaderWriter) Write(b []byte) (int, error) {
+	w.writeHeader()
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher, which streaming processors use if it is available.
+func (w *deferredHeaderWriter) Flush() {
+	w.writeHeader()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// ErrBodyTooLarge is the error when a response body exceeds the limit set by WithMaxBodySize.
+var ErrBodyTooLarge = errors.New("the response body is too large")
+
+// limitedResponseWriter fails any write that would take the body beyond its limit.
+type limitedResponseWriter struct {
+	http.ResponseWriter
+	remaining int64
+}
+
+func (w *limitedResponseWriter) Write(b []byte) (int, error) {
+	if int64(len(b)) > w.remaining {
+		w.remaining = 0
+		return 0, ErrBodyTooLarge
+	}
+	w.remaining -= int64(len(b))
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher, which streaming processors use if it is available.
+func (w *limitedResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// encodedResponseWriter writes the response body through a compressor.
+type encodedResponseWriter struct {
+	http.ResponseWriter
+	w io.Writer
+}
+
+func (w encodedResponseWriter) Write(b []byte) (int, error) {
+	return w.w.Write(b)
+}
+
+// contentDisposition formats an attachment header with a quoted filename. Names that are
+// not plain ASCII also get the RFC 5987 "filename*" parameter, with an ASCII fallback.
+func contentDisposition(filename string) string {
+	buf := &strings.Builder{}
+	ascii := true
+	buf.WriteString(`attachment; filename="`)
+	for _, c := range filename {
+		switch {
+		case c == '"' || c == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(c)
+		case c < ' ' || c > '~':
+			buf.WriteByte('_')
+			ascii = false
+		default:
+			buf.WriteRune(c)
+		}
+	}
+	buf.WriteByte('"')
+
+	if !ascii {
+		buf.WriteString("; filename*=UTF-8''")
+		for _, b := range []byte(filename) {
+			if isAttrChar(b) {
+				buf.WriteByte(b)
+			} else {
+				fmt.Fprintf(buf, "%%%02X", b)
+			}
+		}
+	}
+	return buf.String()
+}
+
+// isAttrChar tests for the characters allowed unencoded in RFC 5987 extended values.
+func isAttrChar(b byte) bool {
+	return ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z') || ('0' <= b && b <= '9') ||
+		strings.IndexByte("!#$&+-.^_`|~", b) >= 0
 }
 
 //-------------------------------------------------------------------------------------------------
 
 type unacceptable struct {
 	errorHandler ErrorHandler
+	contentType  string
+	available    []string
+	reason       Reason
+}
+
+func (r unacceptable) Empty() bool {
+	return false
 }
 
 func (r unacceptable) StatusCode() int {
@@ -57,7 +352,10 @@ func (r unacceptable) StatusCode() int {
 }
 
 func (r unacceptable) WriteContentType(w http.ResponseWriter) {
-	// does nothing
+	writeErrorContentType(w, r.contentType)
+	if len(r.available) > 0 {
+		w.Header().Set(XAvailableTypes, strings.Join(r.available, ", "))
+	}
 }
 
 func (r unacceptable) Render(w http.ResponseWriter) error {
@@ -67,16 +365,88 @@ func (r unacceptable) Render(w http.ResponseWriter) error {
 
 //-------------------------------------------------------------------------------------------------
 
-type emptyCode int
+type badRequest struct {
+	errorHandler ErrorHandler
+	contentType  string
+	message      string
+	reason       Reason
+}
+
+func (r badRequest) Empty() bool {
+	return false
+}
+
+func (r badRequest) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+func (r badRequest) WriteContentType(w http.ResponseWriter) {
+	writeErrorContentType(w, r.contentType)
+}
+
+func (r badRequest) Render(w http.ResponseWriter) error {
+	r.errorHandler(w, r.message, http.StatusBadRequest)
+	return nil
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// multipleChoices is the 300 response listing the alternative media types.
+type multipleChoices struct {
+	alternatives []string
+	hideOffered  bool
+}
+
+func (r multipleChoices) Empty() bool {
+	return false
+}
+
+func (r multipleChoices) StatusCode() int {
+	return http.StatusMultipleChoices
+}
+
+func (r multipleChoices) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Add("Vary", Accept)
+	if !r.hideOffered {
+		w.Header().Set(XAvailableTypes, strings.Join(r.alternatives, ", "))
+	}
+}
+
+func (r multipleChoices) Render(w http.ResponseWriter) error {
+	_, err := io.WriteString(w, strings.Join(r.alternatives, "\n")+"\n")
+	return err
+}
+
+// writeErrorContentType sets the content type of an error response, if known. Otherwise,
+// this is left to the error handler.
+func writeErrorContentType(w http.ResponseWriter, contentType string) {
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+	}
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// noContent is the 204 response for an offer without data.
+type noContent struct {
+	offer Offer
+}
+
+func (r noContent) Empty() bool {
+	return true
+}
 
-func (r emptyCode) StatusCode() int {
-	return int(r)
+func (r noContent) StatusCode() int {
+	return http.StatusNoContent
 }
 
-func (r emptyCode) WriteContentType(w http.ResponseWriter) {
+func (r noContent) WriteContentType(w http.ResponseWriter) {
 	// does nothing
 }
 
-func (r emptyCode) Render(w http.ResponseWriter) error {
+func (r noContent) Render(w http.ResponseWriter) error {
 	return nil
 }
@@ -0,0 +1,49 @@
+package negotiator
+
+// Decision is the outcome of a step in the negotiation, as recorded in a TraceEvent.
+type Decision string
+
+const (
+	// Compared means that an accepted media range and language were compared with an offer.
+	Compared Decision = "compared"
+	// Matched means that an offer was chosen for the response.
+	Matched Decision = "matched"
+	// Excluded means that an offer was excluded by a zero-quality media range.
+	Excluded Decision = "excluded"
+	// Rejected means that no offer was acceptable, so the response is 406-Not Acceptable.
+	Rejected Decision = "rejected"
+)
+
+// TraceEvent describes a step in the negotiation. Accepted and Language are the media range
+// and language range that were used; for Rejected events, they list all the accepted ranges
+// and Offer is empty.
+type TraceEvent struct {
+	Decision Decision
+	Accepted string
+	Language string
+	Offer    Offer
+}
+
+// WithTrace sets a function that receives structured events describing each step of the
+// negotiation. Unlike the global Printer, this applies only to this Negotiator (and those
+// derived from it), so it is suitable for request-scoped logging and parallel tests.
+func (n *Negotiator) WithTrace(tracer func(event TraceEvent)) *Negotiator {
+	c := n.Clone()
+	c.tracer = tracer
+	return c
+}
+
+// trace logs a step via the Printer and also sends it to the tracer, if any.
+func (n *Negotiator) trace(msg string, decision Decision, accepted, lang string, offer Offer) {
+	info(msg, accepted, lang, offer)
+	if n.tracer != nil {
+		n.tracer(TraceEvent{Decision: decision, Accepted: accepted, Language: lang, Offer: offer})
+	}
+}
+
+// traceRejected sends a Rejected event to the tracer, if any.
+func (n *Negotiator) traceRejected(accepted, lang string) {
+	if n.tracer != nil {
+		n.tracer(TraceEvent{Decision: Rejected, Accepted: accepted, Language: lang})
+	}
+}
@@ -0,0 +1,53 @@
+package negotiator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rickb777/negotiator/processor"
+)
+
+// Validate checks that the offers could be rendered by the processors that negotiation might
+// choose for them, using any processors that implement processor.Validator. This is intended
+// for use in tests or at startup, so that unsuitable data models are found early instead of
+// when a request arrives.
+//
+// Offers with a wildcard or blank media type are checked against every processor. Offers
+// whose Data is nil, or is a function, are not checked because their data is known only
+// during negotiation. The first problem found is returned.
+func (n *Negotiator) Validate(offers ...Offer) error {
+	for i, offer := range offers {
+		if offer.Data == nil || isDataProvider(offer.Data) {
+			continue
+		}
+
+		mediaType := offer.normalisedMediaType()
+		if mediaType == "" || strings.Contains(mediaType, "*") {
+			for _, p := range n.processors {
+				if err := validate(p, offer); err != nil {
+					return fmt.Errorf("offer %d (%s): %w", i, offer.MediaType, err)
+				}
+			}
+		} else if p, ok := n.ProcessorFor(mediaType, offer.Language); ok {
+			if err := validate(p, offer); err != nil {
+				return fmt.Errorf("offer %d (%s): %w", i, offer.MediaType, err)
+			}
+		}
+	}
+	return nil
+}
+
+func validate(p processor.ResponseProcessor, offer Offer) error {
+	if v, ok := p.(processor.Validator); ok {
+		return v.ValidateData(offer.Template, offer.Data)
+	}
+	return nil
+}
+
+func isDataProvider(data interface{}) bool {
+	switch data.(type) {
+	case func() interface{}, func(string) interface{}, func(string, string) (interface{}, bool), func() Seq:
+		return true
+	}
+	return false
+}